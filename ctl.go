@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"copy/internal/ctl"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// defaultSocket returns the per-user control socket, empty if there is no
+// place for it
+func defaultSocket() string {
+	path, err := ctl.SocketPath()
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// runCtl implements `iocopy ctl [flags] command [args]`
+func runCtl(args []string) error {
+	fs := flag.NewFlagSet("ctl", flag.ExitOnError)
+	socket := fs.String("socket", defaultSocket(), "Control socket of the running instance")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s ctl [flags] command [args]\n\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "Commands:\n")
+		fmt.Fprintf(fs.Output(), "  scan                    list reachable receivers\n")
+		fmt.Fprintf(fs.Output(), "  peers                   list known devices\n")
+		fmt.Fprintf(fs.Output(), "  connect target [code]   control a receiver, target is host[:port], a ws:// URL or a relay peer ID\n")
+		fmt.Fprintf(fs.Output(), "  disconnect              end the control session\n")
+		fmt.Fprintf(fs.Output(), "  status                  show what the instance is doing\n")
+		fmt.Fprintf(fs.Output(), "  send-text [text]        type text on the controlled receiver, stdin when no text is given\n")
+		fmt.Fprintf(fs.Output(), "  relative on|off         move the receiver's pointer by deltas or to positions\n")
+		fmt.Fprintf(fs.Output(), "  events [name...]        stream events, one JSON object per line\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *socket == "" {
+		return fmt.Errorf("no control socket, pass -socket")
+	}
+
+	client, err := ctl.Dial(*socket)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	command, rest := fs.Arg(0), fs.Args()[1:]
+	switch command {
+	case "scan":
+		return printCall(client, ctl.MethodScan, nil)
+	case "peers":
+		return printCall(client, ctl.MethodPeers, nil)
+	case "connect":
+		if len(rest) < 1 || len(rest) > 2 {
+			return fmt.Errorf("usage: connect target [code]")
+		}
+		params := ctl.ConnectParams{Target: rest[0]}
+		if len(rest) == 2 {
+			params.Code = rest[1]
+		}
+		return printCall(client, ctl.MethodConnect, &params)
+	case "disconnect":
+		return client.Call(ctl.MethodDisconnect, nil, nil)
+	case "status":
+		return printCall(client, ctl.MethodStatus, nil)
+	case "send-text":
+		text := strings.Join(rest, " ")
+		if len(rest) == 0 {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return fmt.Errorf("failed to read text: %w", err)
+			}
+			text = string(data)
+		}
+		return client.Call(ctl.MethodSendText, &ctl.SendTextParams{Text: text}, nil)
+	case "relative":
+		if len(rest) != 1 || (rest[0] != "on" && rest[0] != "off") {
+			return fmt.Errorf("usage: relative on|off")
+		}
+		return client.Call(ctl.MethodRelative, &ctl.RelativeParams{On: rest[0] == "on"}, nil)
+	case "events":
+		enc := json.NewEncoder(os.Stdout)
+		return client.Subscribe(rest, func(event *ctl.Event) bool {
+			return enc.Encode(event) == nil
+		})
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	return nil
+}
+
+// printCall calls method and prints its result as indented JSON
+func printCall(client *ctl.Client, method string, params any) error {
+	var result json.RawMessage
+	if err := client.Call(method, params, &result); err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, result, "", "  "); err != nil {
+		return err
+	}
+	fmt.Println(out.String())
+	return nil
+}
@@ -0,0 +1,158 @@
+export namespace hotkey {
+	
+	export class Binding {
+	    action: string;
+	    chord: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new Binding(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.action = source["action"];
+	        this.chord = source["chord"];
+	    }
+	}
+
+}
+
+export namespace layout {
+	
+	export class Placement {
+	    peer: string;
+	    of: string;
+	    edge: string;
+	    offset?: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new Placement(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.peer = source["peer"];
+	        this.of = source["of"];
+	        this.edge = source["edge"];
+	        this.offset = source["offset"];
+	    }
+	}
+	export class Layout {
+	    screens: Placement[];
+	
+	    static createFrom(source: any = {}) {
+	        return new Layout(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.screens = this.convertValues(source["screens"], Placement);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+}
+
+export namespace wire {
+	
+	export class KnownPeer {
+	    id: string;
+	    name: string;
+	    last_addr: string;
+	    // Go type: time
+	    first_seen: any;
+	    // Go type: time
+	    last_seen: any;
+	    named?: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new KnownPeer(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	        this.last_addr = source["last_addr"];
+	        this.first_seen = this.convertValues(source["first_seen"], null);
+	        this.last_seen = this.convertValues(source["last_seen"], null);
+	        this.named = source["named"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class SessionInfo {
+	    id: number;
+	    remote_addr: string;
+	    fingerprint: string;
+	    hostname: string;
+	    // Go type: time
+	    since: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new SessionInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.remote_addr = source["remote_addr"];
+	        this.fingerprint = source["fingerprint"];
+	        this.hostname = source["hostname"];
+	        this.since = this.convertValues(source["since"], null);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+}
+
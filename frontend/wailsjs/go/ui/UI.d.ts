@@ -1,8 +1,51 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
+import {hotkey} from '../models';
+import {layout} from '../models';
+import {wire} from '../models';
 
-export function Connect(arg1:string):Promise<void>;
+export function AcceptKeyChange(arg1:string,arg2:string):Promise<void>;
+
+export function Cancel():Promise<void>;
+
+export function Connect(arg1:string,arg2:string):Promise<void>;
+
+export function ConnectLayout():Promise<void>;
+
+export function DialOut(arg1:string):Promise<void>;
+
+export function DialOutTarget():Promise<string>;
+
+export function FloorHolder():Promise<number>;
+
+export function HandOver(arg1:number):Promise<void>;
+
+export function Hotkeys():Promise<Array<hotkey.Binding>>;
+
+export function KnownPeers():Promise<Array<wire.KnownPeer>>;
+
+export function Layout():Promise<layout.Layout>;
+
+export function LocalFingerprint():Promise<string>;
 
 export function LocalIP():Promise<string>;
 
+export function PairingCode():Promise<string>;
+
+export function RelativeMotion():Promise<boolean>;
+
+export function RenamePeer(arg1:string,arg2:string):Promise<void>;
+
+export function ReverseListenAddr():Promise<string>;
+
+export function RevokePeer(arg1:string):Promise<void>;
+
+export function SaveLayout(arg1:layout.Layout):Promise<void>;
+
 export function ScanPeers():Promise<Array<string>>;
+
+export function Sessions():Promise<Array<wire.SessionInfo>>;
+
+export function SetRelativeMotion(arg1:boolean):Promise<void>;
+
+export function WaitForPeer(arg1:string,arg2:string,arg3:string):Promise<void>;
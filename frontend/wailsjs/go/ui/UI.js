@@ -2,14 +2,94 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
-export function Connect(arg1) {
-  return window['go']['ui']['UI']['Connect'](arg1);
+export function AcceptKeyChange(arg1, arg2) {
+  return window['go']['ui']['UI']['AcceptKeyChange'](arg1, arg2);
+}
+
+export function Cancel() {
+  return window['go']['ui']['UI']['Cancel']();
+}
+
+export function Connect(arg1, arg2) {
+  return window['go']['ui']['UI']['Connect'](arg1, arg2);
+}
+
+export function ConnectLayout() {
+  return window['go']['ui']['UI']['ConnectLayout']();
+}
+
+export function DialOut(arg1) {
+  return window['go']['ui']['UI']['DialOut'](arg1);
+}
+
+export function DialOutTarget() {
+  return window['go']['ui']['UI']['DialOutTarget']();
+}
+
+export function FloorHolder() {
+  return window['go']['ui']['UI']['FloorHolder']();
+}
+
+export function HandOver(arg1) {
+  return window['go']['ui']['UI']['HandOver'](arg1);
+}
+
+export function Hotkeys() {
+  return window['go']['ui']['UI']['Hotkeys']();
+}
+
+export function KnownPeers() {
+  return window['go']['ui']['UI']['KnownPeers']();
+}
+
+export function Layout() {
+  return window['go']['ui']['UI']['Layout']();
+}
+
+export function LocalFingerprint() {
+  return window['go']['ui']['UI']['LocalFingerprint']();
 }
 
 export function LocalIP() {
   return window['go']['ui']['UI']['LocalIP']();
 }
 
+export function PairingCode() {
+  return window['go']['ui']['UI']['PairingCode']();
+}
+
+export function RelativeMotion() {
+  return window['go']['ui']['UI']['RelativeMotion']();
+}
+
+export function RenamePeer(arg1, arg2) {
+  return window['go']['ui']['UI']['RenamePeer'](arg1, arg2);
+}
+
+export function ReverseListenAddr() {
+  return window['go']['ui']['UI']['ReverseListenAddr']();
+}
+
+export function RevokePeer(arg1) {
+  return window['go']['ui']['UI']['RevokePeer'](arg1);
+}
+
+export function SaveLayout(arg1) {
+  return window['go']['ui']['UI']['SaveLayout'](arg1);
+}
+
 export function ScanPeers() {
   return window['go']['ui']['UI']['ScanPeers']();
 }
+
+export function Sessions() {
+  return window['go']['ui']['UI']['Sessions']();
+}
+
+export function SetRelativeMotion(arg1) {
+  return window['go']['ui']['UI']['SetRelativeMotion'](arg1);
+}
+
+export function WaitForPeer(arg1, arg2, arg3) {
+  return window['go']['ui']['UI']['WaitForPeer'](arg1, arg2, arg3);
+}
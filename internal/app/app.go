@@ -1,12 +1,21 @@
 package app
 
 import (
+	"context"
+	"copy/internal/control"
+	"copy/internal/ctl"
+	"copy/internal/hotkey"
+	"copy/internal/layout"
+	"copy/internal/pairing"
 	"copy/internal/shared"
 	"copy/internal/ui"
 	"copy/internal/wire"
 	"fmt"
 	"log"
 	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -14,34 +23,141 @@ import (
 
 const defaultPort = "8080"
 
+// shutdownTimeout bounds how long controllers get to be told goodbye
+const shutdownTimeout = 3 * time.Second
+
+// Config holds the settings the app is started with
+type Config struct {
+	Port     string
+	Insecure bool   // Disable TLS
+	Codec    string // Preferred wire codec, see wire.CodecByName
+
+	CompressThreshold int // Deflate messages at least this large when the peer supports it, 0 disables
+
+	DialTimeout      time.Duration // Bound on connecting to a peer
+	HandshakeTimeout time.Duration // Bound on TLS, hello and pairing with a peer
+	IdleTimeout      time.Duration // Drop a peer without heartbeats after this long without traffic, 0 disables
+
+	HeartbeatInterval time.Duration
+	PeerTimeout       time.Duration // Silence after which a peer is dropped
+	ReconnectTimeout  time.Duration // How long to keep redialing a lost peer, 0 disables
+	UDPMotion         bool          // Offer the UDP side channel for pointer motion
+	RecordDir         string        // Where session captures go, empty disables recording
+
+	SwitchEdge string // Edge of our screen the receiver sits behind, input switches when the pointer crosses it. Empty hands over all input
+	DeadCorner int    // Pixels at each end of a screen edge that do not switch screens
+
+	PointerMapping string // How our pointer lands on a receiver's screen of another size, see control.Map*
+	RelativeMotion bool   // Move the receiver's pointer by deltas, for games and apps that lock the pointer
+	Hotkeys        string // Hotkey bindings over the defaults, see hotkey.Parse
+
+	FloorPolicy  string // What happens to controllers arriving while another has input, see control.Floor*
+	PriorityPeer string // Fingerprint or IP of a controller that may always take over
+
+	RelayAddr string // Relay to register at and reach peers through, empty disables
+	RelayID   string // Peer ID to register under at the relay, the hostname when empty
+
+	ReverseTo     string // Controller to connect out to as a receiver, empty disables
+	ReverseListen string // Where the UI waits for receivers connecting out to us, empty disables
+	ReversePeer   string // Fingerprint of the receiver to wait for, a known peer when empty
+
+	ControlSocket string // Unix socket serving the local control API, empty disables
+}
+
 type App struct {
+	cfg    Config
 	port   string
+	codec  wire.Codec
 	server *wire.Server
+	sec    *wire.Security
+	pairer *pairing.Pairer
+	floor  *control.Floor
+	ui     *ui.UI
+
+	// controlMu guards cancelControl, which ends the outgoing session or
+	// the attempt to establish it, and what the control API reports of it
+	controlMu     sync.Mutex
+	cancelControl context.CancelFunc
+	// controlPointer asks the receivers of the session to report their
+	// pointer, the screen layout needs it
+	controlPointer bool
+	controlStatus  ctl.ControlStatus
+	controller     *control.Controller
+	// relative is whether control sessions move the receiver's pointer by
+	// deltas, it can be switched while one runs
+	relative atomic.Bool
+	// hotkeys are the bindings every control session catches
+	hotkeys hotkey.Bindings
+
+	// ctl serves the local control API, nil when disabled
+	ctl     *ctl.Server
+	stopCtl context.CancelFunc
+
+	// reverseMu guards the listener dialing out to a controller
+	reverseMu     sync.Mutex
+	reverseLn     *wire.ReverseListener
+	reverseTarget string
 }
 
-func NewApp(port string) (*App, error) {
+func NewApp(cfg Config) (*App, error) {
+	codec := wire.CodecByName(cfg.Codec)
+	if codec == nil {
+		return nil, fmt.Errorf("unknown codec %q", cfg.Codec)
+	}
+	if err := layout.ValidateEdge(cfg.SwitchEdge); err != nil {
+		return nil, err
+	}
+	if err := control.ValidateMapping(cfg.PointerMapping); err != nil {
+		return nil, err
+	}
+	hotkeys, err := hotkey.Parse(cfg.Hotkeys)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hotkeys: %w", err)
+	}
+	if cfg.RelayAddr != "" && cfg.Insecure {
+		// Without TLS the relay would see every keystroke
+		return nil, fmt.Errorf("relaying requires TLS, drop -insecure or -relay")
+	}
+
 	// Don't create server immediately - create it lazily when needed
 	// This prevents issues when Wails tries to generate bindings
-	return &App{
-		port: port,
-	}, nil
+	a := &App{
+		cfg:     cfg,
+		port:    cfg.Port,
+		codec:   codec,
+		hotkeys: hotkeys,
+
+		controlStatus: ctl.ControlStatus{State: ctl.StateIdle, Since: time.Now()},
+	}
+
+	a.relative.Store(cfg.RelativeMotion)
+
+	floor, err := control.NewFloor(cfg.FloorPolicy, cfg.PriorityPeer, func() {
+		a.emit("floor:changed")
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.floor = floor
+	return a, nil
 }
 
 func (a *App) Run() error {
 	log.Printf("[app] Starting on %s", runtime.GOOS)
 	log.Printf("[app] Local IP: %s", shared.GetLocalIP())
 
+	a.ui = ui.NewUI(a, a.port)
+
 	if err := a.startServer(); err != nil {
 		return err
 	}
+	a.startCtl()
 
 	assetServer, err := ui.NewAssetServer()
 	if err != nil {
 		return fmt.Errorf("failed to create asset server: %v", err)
 	}
 
-	ui := ui.NewUI(a, a.port)
-
 	return wails.Run(&options.App{
 		Title:  "IOCopy",
 		Width:  420,
@@ -49,9 +165,59 @@ func (a *App) Run() error {
 
 		AssetServer: assetServer.GetServer(),
 
-		OnStartup: ui.Startup,
+		OnStartup:  a.ui.Startup,
+		OnShutdown: a.shutdown,
 		Bind: []interface{}{
-			ui,
+			a.ui,
 		},
 	})
 }
+
+// shutdown ends every session cleanly before the process exits
+func (a *App) shutdown(context.Context) {
+	if a.stopCtl != nil {
+		a.stopCtl()
+	}
+	if a.server == nil {
+		return
+	}
+	log.Printf("[app] Shutting down server")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := a.server.Shutdown(ctx); err != nil {
+		log.Printf("[app] Server did not shut down cleanly: %v", err)
+	}
+}
+
+// limits returns the frame limits and timeouts for new connections
+func (a *App) limits() wire.Limits {
+	limits := wire.DefaultLimits()
+	limits.ReadTimeout = a.cfg.IdleTimeout
+	return limits
+}
+
+// handshakeTimeout returns how long a peer gets to finish TLS, hello and
+// pairing
+func (a *App) handshakeTimeout() time.Duration {
+	if a.cfg.HandshakeTimeout > 0 {
+		return a.cfg.HandshakeTimeout
+	}
+	return wire.HandshakeTimeout
+}
+
+// heartbeatConfig returns the liveness settings for new connections, RTT
+// updates are forwarded to the UI
+func (a *App) heartbeatConfig() wire.HeartbeatConfig {
+	cfg := wire.DefaultHeartbeatConfig()
+	if a.cfg.HeartbeatInterval > 0 {
+		cfg.Interval = a.cfg.HeartbeatInterval
+	}
+	if a.cfg.PeerTimeout > 0 {
+		cfg.Timeout = a.cfg.PeerTimeout
+	}
+	cfg.OnRTT = func(rtt time.Duration) {
+		a.emit("session:rtt", rtt.Milliseconds())
+	}
+	return cfg
+}
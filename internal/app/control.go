@@ -1,34 +1,167 @@
 package app
 
 import (
+	"context"
 	"copy/internal/control"
+	"copy/internal/ctl"
+	"copy/internal/hotkey"
+	"copy/internal/layout"
+	"copy/internal/pairing"
+	"copy/internal/relay"
 	"copy/internal/wire"
+	"errors"
 	"fmt"
 	"log"
+	"maps"
+	"net"
+	"sync"
 )
 
-// runControl establishes control over the remote peer's keyboard and mouse
-func (a *App) RunControl(targetIP, port string) error {
+// runControl establishes control over the remote peer's keyboard and mouse.
+// code is the receiver's pairing code, it may be empty if we paired before.
+// CancelControl ends it at any point, including while still connecting
+func (a *App) RunControl(targetIP, port, code string) error {
 	log.Printf("[control] Attempting to connect to %s:%s...", targetIP, port)
-	client, err := wire.NewClient(targetIP, port)
+	return a.control(targetIP, func(ctx context.Context, code string) (*wire.Client, *wire.Session, error) {
+		return a.dialPeer(ctx, targetIP, port, code)
+	}, code, nil)
+}
+
+// connectFunc opens and authenticates a connection to the peer, code is
+// empty once we are paired
+type connectFunc func(ctx context.Context, code string) (*wire.Client, *wire.Session, error)
+
+// control runs a control session over the connection opened by connect,
+// which is called again to reconnect. target names the peer in logs.
+// established, if set, is called once input flows to the peer
+func (a *App) control(target string, connect connectFunc, code string, established func()) (err error) {
+	ctx, end, err := a.beginControl(target, a.cfg.SwitchEdge != "")
+	if err != nil {
+		return err
+	}
+	defer func() { end(err) }()
+
+	client, session, err := connect(ctx, code)
 	if err != nil {
-		return fmt.Errorf("failed to connect: %w", err)
+		if errors.Is(err, context.Canceled) {
+			log.Printf("[control] Connecting to %s cancelled", target)
+			return fmt.Errorf("connecting to %s cancelled", target)
+		}
+		return err
 	}
 	defer func() {
 		client.Close()
 		log.Printf("[control] Client connection closed")
 	}()
 
-	log.Printf("[control] Connected to %s:%s", targetIP, port)
 	log.Printf("[control] Gaining control over remote device...")
-	log.Printf("[control] Press Ctrl+Shift+B to stop control")
+	log.Printf("[control] Press %s to stop control", a.releaseHotkey())
 
 	// Create input controller
-	controller := control.NewController(client)
+	controller := control.NewController(control.Peer{
+		Name:      target,
+		Client:    client,
+		Session:   session,
+		Reconnect: a.reconnect(connect),
+	})
+	if a.cfg.SwitchEdge != "" {
+		// The receiver is a layout of one screen behind the switching edge
+		controller.Layout = &layout.Layout{Screens: []layout.Placement{
+			{Peer: target, Of: layout.LocalScreen, Edge: a.cfg.SwitchEdge},
+		}}
+		controller.DeadCorner = a.cfg.DeadCorner
+	}
+	controller.Mapping = a.cfg.PointerMapping
+	controller.Relative = a.relative.Load()
+	controller.Hotkeys = a.hotkeys
+	return a.runController(ctx, controller, ctl.ControlStatus{
+		State:       control.StatusConnected,
+		Peer:        target,
+		Hostname:    session.Remote.Hostname,
+		Fingerprint: client.PeerFingerprint(),
+	}, established)
+}
+
+// beginControl claims the outgoing control session for target, there is
+// only one at a time. pointer asks receivers to report their pointer. The
+// returned ctx ends on CancelControl, end releases the session recording
+// err as why it ended
+func (a *App) beginControl(target string, pointer bool) (context.Context, func(err error), error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	a.controlMu.Lock()
+	if a.cancelControl != nil {
+		a.controlMu.Unlock()
+		cancel()
+		return nil, nil, errors.New("already controlling a peer")
+	}
+	a.cancelControl = cancel
+	a.controlPointer = pointer
+	a.controlMu.Unlock()
+	a.setControlStatus(ctl.ControlStatus{State: ctl.StateConnecting, Peer: target}, nil)
+
+	end := func(err error) {
+		cancel()
+		status := ctl.ControlStatus{State: ctl.StateIdle}
+		if err != nil {
+			status.Error = err.Error()
+		}
+		a.controlMu.Lock()
+		a.cancelControl = nil
+		a.controlPointer = false
+		a.controlMu.Unlock()
+		a.setControlStatus(status, nil)
+	}
+	return ctx, end, nil
+}
+
+// reconnect returns how a lost receiver is redialed through connect, nil
+// when reconnecting is disabled
+func (a *App) reconnect(connect connectFunc) *control.Reconnect {
+	if a.cfg.ReconnectTimeout <= 0 {
+		return nil
+	}
+	return &control.Reconnect{
+		// We are paired by now, so no code is needed to get back in
+		Dial: func(ctx context.Context) (*wire.Client, *wire.Session, error) {
+			return connect(ctx, "")
+		},
+		GiveUpAfter: a.cfg.ReconnectTimeout,
+	}
+}
+
+// runController drives input through controller until the session ends.
+// status describes the session, with Peers set the state of each receiver
+// is kept there. established, if set, is called once input flows
+func (a *App) runController(ctx context.Context, controller *control.Controller, status ctl.ControlStatus, established func()) error {
+	var statusMu sync.Mutex
+	controller.OnStatus = func(peer, state string) {
+		statusMu.Lock()
+		if status.Peers != nil {
+			// The published status keeps its own copy
+			status.Peers = maps.Clone(status.Peers)
+			status.Peers[peer] = state
+		} else {
+			status.State = state
+		}
+		current := status
+		statusMu.Unlock()
 
-	// Start controlling (this blocks until Ctrl+Shift+B or connection lost)
+		a.setControlStatus(current, controller)
+		a.emit("session:status", state, peer)
+	}
+	a.setControlStatus(status, controller)
+	if established != nil {
+		established()
+	}
+
+	// Start controlling (this blocks until the release hotkey or connection lost)
 	log.Printf("[control] Starting controller...")
-	err = controller.Start()
+	err := controller.Start(ctx)
+	if errors.Is(err, context.Canceled) {
+		log.Printf("[control] Control session cancelled")
+		return nil
+	}
 	if err != nil {
 		log.Printf("[control] Controller error: %v", err)
 		return fmt.Errorf("control session ended: %w", err)
@@ -37,3 +170,123 @@ func (a *App) RunControl(targetIP, port string) error {
 	log.Printf("[control] Control session ended normally")
 	return nil
 }
+
+// SetRelativeMotion chooses whether control sessions move the receiver's
+// pointer by deltas rather than to positions, the running one included
+func (a *App) SetRelativeMotion(on bool) {
+	a.relative.Store(on)
+	a.controlMu.Lock()
+	controller := a.controller
+	a.controlMu.Unlock()
+	if controller != nil {
+		controller.SetRelative(on)
+	}
+}
+
+// RelativeMotion reports whether control sessions move the receiver's
+// pointer by deltas
+func (a *App) RelativeMotion() bool {
+	return a.relative.Load()
+}
+
+// Hotkeys returns the hotkeys control sessions catch and their actions
+func (a *App) Hotkeys() hotkey.Bindings {
+	return a.hotkeys
+}
+
+// releaseHotkey names the chord that ends a control session
+func (a *App) releaseHotkey() string {
+	chord, _ := a.hotkeys.Chord(hotkey.ActionRelease)
+	return chord.String()
+}
+
+// CancelControl ends the outgoing control session, or abandons connecting
+// if it is still being established
+func (a *App) CancelControl() {
+	a.controlMu.Lock()
+	defer a.controlMu.Unlock()
+	if a.cancelControl != nil {
+		log.Printf("[control] Cancelling control session")
+		a.cancelControl()
+	}
+}
+
+// dialPeer connects to a receiver and runs the hello and pairing exchanges,
+// returning a connection ready to carry input. The whole setup is bounded
+// by the handshake timeout
+func (a *App) dialPeer(ctx context.Context, targetIP, port, code string) (*wire.Client, *wire.Session, error) {
+	sec, err := a.security()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.handshakeTimeout())
+	defer cancel()
+
+	dialer := wire.Dialer{Security: sec, Timeout: a.cfg.DialTimeout, HandshakeTimeout: a.handshakeTimeout()}
+	if a.viaRelay(targetIP) {
+		log.Printf("[control] Reaching %s through relay %s", targetIP, a.cfg.RelayAddr)
+		dialer.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return relay.Dial(ctx, a.cfg.RelayAddr, targetIP)
+		}
+	}
+	client, err := dialer.Dial(ctx, targetIP, port)
+	if err != nil {
+		a.warnKeyChanged(err)
+		return nil, nil, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	log.Printf("[control] Connected to %s:%s (fingerprint %s)", targetIP, port, client.PeerFingerprint())
+	return a.setupPeer(ctx, client, targetIP, code)
+}
+
+// setupPeer runs the hello and pairing exchanges on a fresh connection to
+// the receiver at targetIP and prepares it to carry input, telling the UI
+// once it is. client is closed on failure
+func (a *App) setupPeer(ctx context.Context, client *wire.Client, targetIP, code string) (*wire.Client, *wire.Session, error) {
+	client.SetLimits(a.limits())
+	capabilities := control.ControllerCapabilities()
+	a.controlMu.Lock()
+	pointer := a.controlPointer
+	a.controlMu.Unlock()
+	if pointer {
+		capabilities = append(capabilities, wire.CapPointer)
+	}
+	session, err := wire.ClientHello(ctx, client, a.localHello(capabilities))
+	if err != nil {
+		client.Close()
+		return nil, nil, fmt.Errorf("hello failed: %w", err)
+	}
+	client.SetCodec(wire.NegotiatedCodec(session))
+	log.Printf("[control] Peer %s runs %s %s (protocol %d), capabilities %v",
+		session.Remote.Hostname, session.Remote.OS, session.Remote.AppVersion, session.Version, session.Capabilities)
+
+	if err := pairing.Authenticate(ctx, client, code, a.LocalFingerprint(), client.PeerFingerprint()); err != nil {
+		client.Close()
+		return nil, nil, fmt.Errorf("pairing failed: %w", err)
+	}
+	a.observePeer(client.PeerFingerprint(), session.Remote.Hostname, targetIP)
+
+	if session.Supports(wire.CapMux) {
+		if err := client.Multiplex(control.InputChannel, wire.PriorityInput); err != nil {
+			client.Close()
+			return nil, nil, fmt.Errorf("failed to open input channel: %w", err)
+		}
+	}
+	// Pairing ran uncompressed, the session stream starts compressing now
+	if session.Supports(wire.CapDeflate) {
+		client.SetCompression(a.cfg.CompressThreshold)
+	}
+	if session.Supports(wire.CapHeartbeat) {
+		client.StartHeartbeat(a.heartbeatConfig())
+	}
+	client.SetRecorder(a.newRecorder(wire.RoleController, targetIP, session))
+	a.emit("peer:connected", targetIP, client.PeerFingerprint(), session.Remote.Hostname)
+	return client, session, nil
+}
+
+// viaRelay reports whether target is a relay peer ID rather than an address
+// we can dial
+func (a *App) viaRelay(target string) bool {
+	return a.cfg.RelayAddr != "" && net.ParseIP(target) == nil && !wire.IsWebSocketAddr(target)
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"context"
+	"copy/internal/control"
+	"copy/internal/ctl"
+	"copy/internal/wire"
+	"errors"
+	"log"
+	"time"
+)
+
+// sendTextTimeout bounds typing text on the peer through the control API
+const sendTextTimeout = 30 * time.Second
+
+// emit tells the UI and the control API subscribers about an app event
+func (a *App) emit(event string, args ...interface{}) {
+	a.ui.Emit(event, args...)
+	if a.ctl != nil {
+		a.ctl.Publish(event, args...)
+	}
+}
+
+// startCtl serves the control API on the configured socket. The app runs
+// without it if the socket cannot be opened
+func (a *App) startCtl() {
+	if a.cfg.ControlSocket == "" {
+		return
+	}
+	server, err := ctl.Listen(a.cfg.ControlSocket, ctlAPI{a})
+	if err != nil {
+		log.Printf("[ctl] Control API disabled: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.ctl = server
+	a.stopCtl = cancel
+	go func() {
+		if err := server.Serve(ctx); err != nil {
+			log.Printf("[ctl] Server error: %v", err)
+		}
+	}()
+}
+
+// setControlStatus records the state of the outgoing control session and
+// the controller driving it, nil while there is none
+func (a *App) setControlStatus(status ctl.ControlStatus, controller *control.Controller) {
+	status.Since = time.Now()
+	a.controlMu.Lock()
+	a.controlStatus = status
+	a.controller = controller
+	a.controlMu.Unlock()
+	a.emit("control:status", status)
+}
+
+// ctlAPI exposes the app to the control API
+type ctlAPI struct {
+	a *App
+}
+
+func (c ctlAPI) Scan() []string {
+	return c.a.FindReachableIPs(c.a.port)
+}
+
+func (c ctlAPI) KnownPeers() []wire.KnownPeer {
+	return c.a.KnownPeers()
+}
+
+// Connect starts controlling target, an address with an optional port, a
+// WebSocket URL or a relay peer ID. The session outlives the call
+func (c ctlAPI) Connect(target, code string) error {
+	host, port := c.a.splitTarget(target)
+
+	// Both established and control returning may send
+	result := make(chan error, 2)
+	go func() {
+		log.Printf("[control] Attempting to connect to %s:%s...", host, port)
+		result <- c.a.control(host, func(ctx context.Context, code string) (*wire.Client, *wire.Session, error) {
+			return c.a.dialPeer(ctx, host, port, code)
+		}, code, func() {
+			result <- nil
+		})
+	}()
+	return <-result
+}
+
+func (c ctlAPI) Disconnect() {
+	c.a.CancelControl()
+}
+
+func (c ctlAPI) Status() ctl.Status {
+	c.a.controlMu.Lock()
+	control := c.a.controlStatus
+	c.a.controlMu.Unlock()
+	return ctl.Status{
+		Control:  control,
+		Sessions: c.a.Sessions(),
+		DialOut:  c.a.DialOutTarget(),
+	}
+}
+
+func (c ctlAPI) SetRelative(on bool) {
+	c.a.SetRelativeMotion(on)
+}
+
+func (c ctlAPI) SendText(text string) error {
+	c.a.controlMu.Lock()
+	controller := c.a.controller
+	c.a.controlMu.Unlock()
+	if controller == nil {
+		return errors.New("not controlling a peer")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sendTextTimeout)
+	defer cancel()
+	return controller.Type(ctx, text)
+}
@@ -0,0 +1,33 @@
+package app
+
+import (
+	"copy/internal/display"
+	"copy/internal/shared"
+	"copy/internal/wire"
+	"log"
+	"os"
+	"runtime"
+)
+
+// localHello describes this device for the hello exchange, adding the
+// protocol features this app supports to the role specific capabilities
+func (a *App) localHello(capabilities []string) wire.Hello {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = shared.GetLocalIP()
+	}
+
+	screen, err := display.Geometry()
+	if err != nil {
+		log.Printf("[app] Could not determine screen geometry: %v", err)
+	}
+
+	capabilities = append(capabilities, wire.Capabilities(a.codec)...)
+	if a.cfg.CompressThreshold > 0 {
+		capabilities = append(capabilities, wire.CapDeflate)
+	}
+	if a.cfg.UDPMotion {
+		capabilities = append(capabilities, wire.CapUDPMotion)
+	}
+	return wire.NewHello(shared.Version, runtime.GOOS, hostname, screen, capabilities)
+}
@@ -37,6 +37,11 @@ func (a *App) FindReachableIPs(port string) []string {
 	wg.Wait()
 	log.Printf("[scan] All reachability checks completed")
 
+	// Peers on other networks are listed by their relay peer ID
+	if a.cfg.RelayAddr != "" {
+		reachableIPs = append(reachableIPs, a.relayPeers()...)
+	}
+
 	return reachableIPs
 }
 
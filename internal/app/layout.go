@@ -0,0 +1,159 @@
+package app
+
+import (
+	"context"
+	"copy/internal/control"
+	"copy/internal/ctl"
+	"copy/internal/layout"
+	"copy/internal/shared"
+	"copy/internal/wire"
+	"errors"
+	"log"
+	"net"
+	"path/filepath"
+	"sync"
+)
+
+// layoutTarget names a screen layout session in the control status
+const layoutTarget = "layout"
+
+func layoutPath() (string, error) {
+	dir, err := shared.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, layout.File), nil
+}
+
+// Layout returns the saved screen layout, empty when there is none
+func (a *App) Layout() (layout.Layout, error) {
+	path, err := layoutPath()
+	if err != nil {
+		return layout.Layout{}, err
+	}
+	l, err := layout.Load(path)
+	if err != nil {
+		return layout.Layout{}, err
+	}
+	return *l, nil
+}
+
+// SaveLayout checks and stores the screen layout used by RunLayout
+func (a *App) SaveLayout(l layout.Layout) error {
+	if err := l.Validate(); err != nil {
+		return err
+	}
+	path, err := layoutPath()
+	if err != nil {
+		return err
+	}
+	if err := l.Save(path); err != nil {
+		return err
+	}
+	log.Printf("[control] Saved layout of %d screens", len(l.Screens))
+	a.emit("layout:changed")
+	return nil
+}
+
+// RunLayout connects to every receiver of the saved layout at once and
+// controls the one whose screen the pointer is on. The receivers must be
+// paired already. Those that cannot be reached are left out
+func (a *App) RunLayout() (err error) {
+	l, err := a.Layout()
+	if err != nil {
+		return err
+	}
+	if len(l.Screens) == 0 {
+		return errors.New("the layout has no screens")
+	}
+	if err := l.Validate(); err != nil {
+		return err
+	}
+
+	ctx, end, err := a.beginControl(layoutTarget, true)
+	if err != nil {
+		return err
+	}
+	defer func() { end(err) }()
+
+	peers := a.dialLayout(ctx, &l)
+	if len(peers) == 0 {
+		if ctx.Err() != nil {
+			return errors.New("connecting to the layout cancelled")
+		}
+		return errors.New("no receiver of the layout could be reached")
+	}
+	defer func() {
+		for _, peer := range peers {
+			peer.Client.Close()
+		}
+		log.Printf("[control] Client connections closed")
+	}()
+
+	log.Printf("[control] Controlling %d of %d screens in the layout", len(peers), len(l.Screens))
+	log.Printf("[control] Press %s to stop control", a.releaseHotkey())
+
+	controller := control.NewController(peers...)
+	controller.Layout = &l
+	controller.DeadCorner = a.cfg.DeadCorner
+	controller.Hotkeys = a.hotkeys
+
+	status := ctl.ControlStatus{
+		State: control.StatusConnected,
+		Peer:  layoutTarget,
+		Peers: make(map[string]string),
+	}
+	for _, peer := range peers {
+		status.Peers[peer.Name] = control.StatusConnected
+	}
+	return a.runController(ctx, controller, status, nil)
+}
+
+// dialLayout connects to the receivers of l concurrently, returning those
+// that could be reached
+func (a *App) dialLayout(ctx context.Context, l *layout.Layout) []control.Peer {
+	results := make([]*control.Peer, len(l.Screens))
+	var wg sync.WaitGroup
+	for i, placement := range l.Screens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			host, port := a.splitTarget(placement.Peer)
+			connect := func(ctx context.Context, code string) (*wire.Client, *wire.Session, error) {
+				return a.dialPeer(ctx, host, port, code)
+			}
+			client, session, err := connect(ctx, "")
+			if err != nil {
+				log.Printf("[control] Leaving %s out of the layout: %v", placement.Peer, err)
+				return
+			}
+			results[i] = &control.Peer{
+				Name:      placement.Peer,
+				Client:    client,
+				Session:   session,
+				Reconnect: a.reconnect(connect),
+			}
+		}()
+	}
+	wg.Wait()
+
+	var peers []control.Peer
+	for _, peer := range results {
+		if peer != nil {
+			peers = append(peers, *peer)
+		}
+	}
+	return peers
+}
+
+// splitTarget splits an address with an optional port into host and port,
+// WebSocket URLs and relay peer IDs are kept whole
+func (a *App) splitTarget(target string) (host, port string) {
+	host, port = target, a.port
+	if !wire.IsWebSocketAddr(target) {
+		if h, p, err := net.SplitHostPort(target); err == nil {
+			host, port = h, p
+		}
+	}
+	return host, port
+}
@@ -0,0 +1,85 @@
+package app
+
+import (
+	"copy/internal/wire"
+	"errors"
+	"log"
+)
+
+// observePeer records that the peer with fingerprint id authenticated from
+// addr. A known address showing up with a different key is raised to the
+// UI as a security warning
+func (a *App) observePeer(id, hostname, addr string) {
+	if id == "" || a.sec == nil || a.sec.KnownPeers == nil {
+		return
+	}
+	err := a.sec.KnownPeers.Observe(id, hostname, addr)
+	a.emit("peers:changed")
+	if err != nil && !a.warnKeyChanged(err) {
+		log.Printf("[app] Failed to record peer %s: %v", addr, err)
+	}
+}
+
+// warnKeyChanged reports err to the UI as a security warning if it says a
+// known address presented a different key, along with the address and key
+// so the user can accept the change
+func (a *App) warnKeyChanged(err error) bool {
+	var changed *wire.KeyChangedError
+	if !errors.As(err, &changed) {
+		return false
+	}
+	a.emit("security:warning", changed.Error(), changed.Addr, changed.Presented)
+	return true
+}
+
+// AcceptKeyChange trusts key id at addr from now on, after the user
+// confirmed a changed key there is expected. The key itself is still only
+// remembered once it pairs
+func (a *App) AcceptKeyChange(addr, id string) error {
+	if a.sec == nil || a.sec.KnownPeers == nil {
+		return wire.ErrUnknownPeer
+	}
+	if err := a.sec.KnownPeers.AcceptKeyChange(addr, id); err != nil {
+		return err
+	}
+	a.emit("peers:changed")
+	return nil
+}
+
+// KnownPeers lists the peers whose identity we trust
+func (a *App) KnownPeers() []wire.KnownPeer {
+	if a.sec == nil || a.sec.KnownPeers == nil {
+		return nil
+	}
+	return a.sec.KnownPeers.List()
+}
+
+// RenamePeer gives a known peer a friendly name
+func (a *App) RenamePeer(id, name string) error {
+	if a.sec == nil || a.sec.KnownPeers == nil {
+		return wire.ErrUnknownPeer
+	}
+	if err := a.sec.KnownPeers.Rename(id, name); err != nil {
+		return err
+	}
+	a.emit("peers:changed")
+	return nil
+}
+
+// RevokePeer stops trusting a known peer. Its key is forgotten and it has
+// to pair again before it may control this device
+func (a *App) RevokePeer(id string) error {
+	if a.sec == nil || a.sec.KnownPeers == nil {
+		return wire.ErrUnknownPeer
+	}
+	if err := a.sec.KnownPeers.Revoke(id); err != nil {
+		return err
+	}
+	if a.pairer != nil {
+		if err := a.pairer.Forget(id); err != nil {
+			log.Printf("[app] Failed to forget pairing with %s: %v", id, err)
+		}
+	}
+	a.emit("peers:changed")
+	return nil
+}
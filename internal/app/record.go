@@ -0,0 +1,41 @@
+package app
+
+import (
+	"copy/internal/wire"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// newRecorder starts a capture of a session with peer when recording is
+// enabled. It returns nil, which records nothing, when disabled or when the
+// capture cannot be created
+func (a *App) newRecorder(role, peer string, session *wire.Session) *wire.Recorder {
+	if a.cfg.RecordDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(a.cfg.RecordDir, 0700); err != nil {
+		log.Printf("[app] Cannot record session: %v", err)
+		return nil
+	}
+
+	start := time.Now()
+	name := fmt.Sprintf("%s-%s-%s.iocap", start.Format("20060102-150405.000"), role, strings.NewReplacer(":", "_", "/", "_").Replace(peer))
+	path := filepath.Join(a.cfg.RecordDir, name)
+
+	rec, err := wire.CreateRecorder(path, wire.CaptureHeader{
+		Role:    role,
+		Peer:    peer,
+		Start:   start,
+		Session: session,
+	})
+	if err != nil {
+		log.Printf("[app] Cannot record session: %v", err)
+		return nil
+	}
+	log.Printf("[app] Recording session to %s", path)
+	return rec
+}
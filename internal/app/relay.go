@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+	"copy/internal/relay"
+	"log"
+	"os"
+	"time"
+)
+
+// relayListTimeout bounds asking the relay who is registered
+const relayListTimeout = 5 * time.Second
+
+// relayID returns the peer ID we register under at the relay
+func (a *App) relayID() string {
+	if a.cfg.RelayID != "" {
+		return a.cfg.RelayID
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Printf("[relay] Could not determine hostname: %v", err)
+		return ""
+	}
+	return hostname
+}
+
+// relayPeers lists the peers reachable through the relay, excluding us
+func (a *App) relayPeers() []string {
+	ctx, cancel := context.WithTimeout(context.Background(), relayListTimeout)
+	defer cancel()
+
+	ids, err := relay.Peers(ctx, a.cfg.RelayAddr)
+	if err != nil {
+		log.Printf("[scan] %v", err)
+		return nil
+	}
+
+	self := a.relayID()
+	var peers []string
+	for _, id := range ids {
+		if id != self {
+			peers = append(peers, id)
+		}
+	}
+	log.Printf("[scan] Relay %s knows %d other peers", a.cfg.RelayAddr, len(peers))
+	return peers
+}
@@ -0,0 +1,187 @@
+package app
+
+import (
+	"context"
+	"copy/internal/wire"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// defaultReversePort is where a controller waits for receivers that connect
+// out to it
+const defaultReversePort = "8081"
+
+// aLongTimeAgo is a deadline in the past, setting it on a listener makes a
+// blocked Accept return
+var aLongTimeAgo = time.Unix(1, 0)
+
+// withReversePort completes addr with defaultReversePort when it has none
+func withReversePort(addr string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(addr, defaultReversePort)
+}
+
+// DialOut makes this receiver connect out to the controller at addr, for
+// networks that refuse inbound connections. Controllers are still accepted
+// on our own port. It replaces the previous target, an empty addr stops
+// dialing out
+func (a *App) DialOut(addr string) error {
+	if a.server == nil {
+		return errors.New("server not started")
+	}
+
+	a.reverseMu.Lock()
+	defer a.reverseMu.Unlock()
+	if a.reverseLn != nil {
+		log.Printf("[server] No longer connecting out to %s", a.reverseTarget)
+		a.reverseLn.Close()
+		a.reverseLn = nil
+		a.reverseTarget = ""
+	}
+	if addr == "" {
+		return nil
+	}
+
+	addr = withReversePort(addr)
+	ln := wire.ListenReverse(addr, a.cfg.DialTimeout)
+	if err := a.server.Serve(ln); err != nil {
+		return fmt.Errorf("failed to connect out to %s: %w", addr, err)
+	}
+	a.reverseLn = ln
+	a.reverseTarget = addr
+	return nil
+}
+
+// DialOutTarget returns the controller this receiver connects out to, empty
+// when it does not
+func (a *App) DialOutTarget() string {
+	a.reverseMu.Lock()
+	defer a.reverseMu.Unlock()
+	return a.reverseTarget
+}
+
+// ReverseListenAddr returns the address to wait for receivers on given on
+// the command line, empty when none was
+func (a *App) ReverseListenAddr() string {
+	return a.cfg.ReverseListen
+}
+
+// RunReverseControl waits on addr for a receiver to connect out to us, then
+// controls it like one we dialed. Reconnects wait for it to connect again.
+// code is the receiver's pairing code, it may be empty if we paired before.
+// Anyone may connect to addr, so only the receiver with fingerprint peer is
+// accepted, ReversePeer when empty, else any peer we already trust. Once
+// one is accepted, reconnects must come from it
+func (a *App) RunReverseControl(addr, code, peer string) error {
+	sec, err := a.security()
+	if err != nil {
+		return err
+	}
+	if sec.Insecure {
+		return errors.New("waiting for receivers needs TLS to tell them from anyone else who connects")
+	}
+	if peer = strings.TrimSpace(peer); peer == "" {
+		peer = a.cfg.ReversePeer
+	}
+
+	addr = withReversePort(addr)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for receivers on %s: %w", addr, err)
+	}
+	defer ln.Close()
+
+	if peer != "" {
+		log.Printf("[control] Waiting for receiver %s to connect on %s...", peer, addr)
+	} else {
+		log.Printf("[control] Waiting for a known receiver to connect on %s...", addr)
+	}
+	return a.control("receiver on "+addr, func(ctx context.Context, code string) (*wire.Client, *wire.Session, error) {
+		client, session, err := a.acceptPeer(ctx, ln.(*net.TCPListener), sec, code, peer)
+		if err == nil {
+			peer = client.PeerFingerprint()
+		}
+		return client, session, err
+	}, code, nil)
+}
+
+// acceptPeer waits for the receiver with fingerprint peer, or any known
+// one when peer is empty, to connect on ln, then runs hello and pairing on
+// its connection. Connections from anyone else are dropped and the wait
+// goes on. Only the setup is bounded by the handshake timeout, the wait
+// lasts until ctx is done
+func (a *App) acceptPeer(ctx context.Context, ln *net.TCPListener, sec *wire.Security, code, peer string) (*wire.Client, *wire.Session, error) {
+	for {
+		conn, err := accept(ctx, ln)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		setupCtx, cancel := context.WithTimeout(ctx, a.handshakeTimeout())
+		client, host, err := a.handshakeReceiver(setupCtx, conn, sec, peer)
+		if err != nil {
+			cancel()
+			if ctx.Err() != nil {
+				return nil, nil, ctx.Err()
+			}
+			log.Printf("[control] Refused %s: %v", conn.RemoteAddr(), err)
+			continue
+		}
+		client, session, err := a.setupPeer(setupCtx, client, host, code)
+		cancel()
+		return client, session, err
+	}
+}
+
+// handshakeReceiver runs the client side of TLS on conn and checks the
+// receiver presented key peer, or a known one when peer is empty. It
+// returns the receiver's host, conn is closed on failure
+func (a *App) handshakeReceiver(ctx context.Context, conn net.Conn, sec *wire.Security, peer string) (*wire.Client, string, error) {
+	host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	log.Printf("[control] Receiver %s connected", host)
+
+	dialer := wire.Dialer{Security: sec, HandshakeTimeout: a.handshakeTimeout()}
+	client, err := dialer.Handshake(ctx, conn, host)
+	if err != nil {
+		a.warnKeyChanged(err)
+		return nil, "", fmt.Errorf("failed to connect: %w", err)
+	}
+
+	id := client.PeerFingerprint()
+	switch {
+	case peer != "" && !strings.EqualFold(id, peer):
+		client.Close()
+		return nil, "", fmt.Errorf("receiver presented key %s, waiting for %s", id, peer)
+	case peer == "" && !sec.KnownPeers.Known(id):
+		client.Close()
+		return nil, "", fmt.Errorf("receiver key %s is unknown, wait for its fingerprint to accept it", id)
+	}
+	log.Printf("[control] Connected to %s (fingerprint %s)", host, id)
+	return client, host, nil
+}
+
+// accept waits for the next connection on ln until ctx is done
+func accept(ctx context.Context, ln *net.TCPListener) (net.Conn, error) {
+	fired := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		ln.SetDeadline(aLongTimeAgo)
+		close(fired)
+	})
+	conn, err := ln.Accept()
+	if !stop() {
+		// Wait so the past deadline cannot land on the next Accept
+		<-fired
+		ln.SetDeadline(time.Time{})
+		if conn != nil {
+			conn.Close()
+		}
+		return nil, ctx.Err()
+	}
+	return conn, err
+}
@@ -0,0 +1,54 @@
+package app
+
+import (
+	"copy/internal/shared"
+	"copy/internal/wire"
+	"fmt"
+	"log"
+	"path/filepath"
+)
+
+// security lazily loads this installation's identity and known peers
+func (a *App) security() (*wire.Security, error) {
+	if a.sec != nil {
+		return a.sec, nil
+	}
+
+	if a.cfg.Insecure {
+		log.Printf("[app] WARNING: TLS disabled, input will cross the network in plaintext")
+		a.sec = &wire.Security{Insecure: true}
+		return a.sec, nil
+	}
+
+	dir, err := shared.ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := wire.LoadOrCreateIdentity(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load identity: %w", err)
+	}
+
+	knownPeers, err := wire.LoadKnownPeers(filepath.Join(dir, wire.KnownPeersFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known peers: %w", err)
+	}
+
+	log.Printf("[app] Local fingerprint: %s", identity.Fingerprint)
+	a.sec = &wire.Security{
+		Identity:   identity,
+		KnownPeers: knownPeers,
+	}
+	return a.sec, nil
+}
+
+// LocalFingerprint returns the fingerprint peers will see for this device,
+// empty when running without TLS
+func (a *App) LocalFingerprint() string {
+	sec, err := a.security()
+	if err != nil || sec.Identity == nil {
+		return ""
+	}
+	return sec.Identity.Fingerprint
+}
@@ -1,41 +1,149 @@
 package app
 
 import (
+	"context"
 	"copy/internal/control"
+	"copy/internal/model"
+	"copy/internal/pairing"
+	"copy/internal/relay"
+	"copy/internal/shared"
 	"copy/internal/wire"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"path/filepath"
+	"sync/atomic"
+	"time"
 )
 
+// abuseBanDuration is how long a peer that broke the protocol is refused
+const abuseBanDuration = 5 * time.Minute
+
+// controlSession is the receiver side state of one controller connection
+type controlSession struct {
+	id       uint64
+	peerID   string
+	remoteIP string
+	name     string
+	receiver *control.Receiver
+
+	// holding is set while this controller has the floor
+	holding atomic.Bool
+}
+
 func (a *App) startServer() error {
 	// Create server lazily when actually starting
 	if a.server == nil {
-		server, err := wire.NewServer(fmt.Sprintf(":%s", a.port))
+		sec, err := a.security()
+		if err != nil {
+			return err
+		}
+		server, err := wire.NewServer(fmt.Sprintf(":%s", a.port), sec)
 		if err != nil {
 			return fmt.Errorf("failed to start server on port %s: %w. Make sure no other instance is running or use a different port with -port flag", a.port, err)
 		}
+		server.SetHandshakeTimeout(a.handshakeTimeout())
 		a.server = server
 	}
 
-	err := a.server.Start(handleServerConnection)
+	if a.pairer == nil {
+		pairer, err := a.newPairer()
+		if err != nil {
+			return err
+		}
+		a.pairer = pairer
+	}
+
+	err := a.server.Start(context.Background(), a.handleServerConnection)
 	if err != nil {
 		return err
 	}
 	log.Printf("[app] Server listening on :%s", a.port)
+
+	if a.cfg.RelayAddr != "" {
+		ln, err := relay.Listen(a.cfg.RelayAddr, a.relayID())
+		if err != nil {
+			return fmt.Errorf("failed to register at relay: %w", err)
+		}
+		if err := a.server.Serve(ln); err != nil {
+			return err
+		}
+	}
+
+	if a.cfg.ReverseTo != "" {
+		if err := a.DialOut(a.cfg.ReverseTo); err != nil {
+			return err
+		}
+	}
 	return nil
 
 }
 
-func handleServerConnection(s *wire.Server, conn net.Conn) {
-	remoteAddr := conn.RemoteAddr().(*net.TCPAddr)
-	remoteIP := remoteAddr.IP.String()
+func (a *App) handleServerConnection(ctx context.Context, sess *wire.ServerSession) {
+	conn := sess.Conn()
+	// Relayed and WebSocket streams need not report a *net.TCPAddr
+	remoteIP := conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(remoteIP); err == nil {
+		remoteIP = host
+	}
+	fingerprint := wire.PeerFingerprint(conn)
+
+	log.Printf("[server] Connection accepted from %s (fingerprint %s)", remoteIP, fingerprint)
+
+	// Hello and pairing must complete promptly, a peer that connects and
+	// stalls should not hold a handler forever
+	conn.SetDeadline(time.Now().Add(a.handshakeTimeout()))
+
+	session, err := wire.ServerHello(conn, a.localHello(control.ReceiverCapabilities()))
+	if err != nil {
+		log.Printf("[server] Hello with %s failed: %v", remoteIP, err)
+		a.punish(remoteIP, err)
+		conn.Close()
+		return
+	}
+	codec := wire.NegotiatedCodec(session)
+	sess.SetPeer(fingerprint, session.Remote.Hostname)
+	log.Printf("[server] Peer %s runs %s %s (protocol %d), capabilities %v, codec %s",
+		session.Remote.Hostname, session.Remote.OS, session.Remote.AppVersion, session.Version, session.Capabilities, codec.Name())
+
+	// Peers are remembered by certificate when available, by IP otherwise
+	peerID := fingerprint
+	if peerID == "" {
+		peerID = remoteIP
+	}
+	if err := a.pairer.Verify(conn, peerID, a.LocalFingerprint()); err != nil {
+		log.Printf("[server] Pairing with %s failed: %v", remoteIP, err)
+		a.punish(remoteIP, err)
+		conn.Close()
+		return
+	}
+	a.observePeer(fingerprint, session.Remote.Hostname, remoteIP)
+
+	// With multiplexing the session runs on the controller's input channel,
+	// otherwise on the connection itself
+	stream := conn
+	if session.Supports(wire.CapMux) {
+		mux := wire.NewMux(conn, false)
+		defer mux.Close()
+
+		input := make(chan *wire.Channel, 1)
+		go a.acceptChannels(mux, remoteIP, input)
+		select {
+		case ch := <-input:
+			stream = ch
+		case <-mux.Done():
+			log.Printf("[server] %s did not open an input channel: %v", remoteIP, mux.Err())
+			a.punish(remoteIP, mux.Err())
+			return
+		}
+	}
+	conn.SetDeadline(time.Time{})
 
-	log.Printf("[server] Connection accepted from %s", remoteIP)
 	log.Printf("[server] Remote peer is taking control of this device")
 
 	// Create input receiver to execute received input events
-	receiver, err := control.NewReceiver()
+	receiver, err := control.NewReceiver(session)
 	if err != nil {
 		log.Printf("[server] Failed to create input receiver: %v", err)
 		conn.Close()
@@ -43,38 +151,245 @@ func handleServerConnection(s *wire.Server, conn net.Conn) {
 	}
 	defer receiver.Close()
 
-	// Handle connection immediately (already in a goroutine from server.Start)
+	cs := &controlSession{
+		id:       sess.Info().ID,
+		peerID:   peerID,
+		remoteIP: remoteIP,
+		name:     session.Remote.Hostname,
+		receiver: receiver,
+	}
+	if cs.name == "" {
+		cs.name = remoteIP
+	}
+	// Release what we pressed before the next controller gets the floor
+	defer a.floor.Release(cs.id)
+	defer receiver.ReleaseAll()
+
+	c := wire.NewConn(stream)
+	c.SetCodec(codec)
+	c.SetLimits(a.limits())
+	if session.Supports(wire.CapDeflate) {
+		c.SetCompression(a.cfg.CompressThreshold)
+	}
+	if session.Supports(wire.CapHeartbeat) {
+		c.StartHeartbeat(a.heartbeatConfig())
+	}
+	c.SetRecorder(a.newRecorder(wire.RoleReceiver, remoteIP, session))
+	// Datagrams cannot follow a relayed stream, the controller would aim
+	// them at the relay
+	if session.Supports(wire.CapUDPMotion) && !relay.IsRelayed(conn) {
+		motion, err := a.offerMotion(ctx, c, cs)
+		if err != nil {
+			log.Printf("[server] UDP motion unavailable for %s: %v", remoteIP, err)
+		} else {
+			defer motion.Close()
+		}
+	}
+
+	// An edge switching controller needs to know where our pointer went
+	if session.Supports(wire.CapPointer) {
+		reportCtx, stopReports := context.WithCancel(ctx)
+		defer stopReports()
+		go receiver.ReportPointer(reportCtx, func(pointer *wire.Pointer) error {
+			return c.Send(reportCtx, wire.MsgPointer, pointer)
+		})
+	}
+
+	// On shutdown tell the controller not to come back, closing the
+	// connection then ends Serve below
+	stop := context.AfterFunc(ctx, func() {
+		c.Send(context.Background(), wire.MsgBye, &wire.Bye{Reason: "receiver shutting down"})
+		c.Close()
+	})
+	defer stop()
+
+	a.emit("controller:connected", remoteIP, fingerprint, session.Remote.Hostname)
 	defer func() {
-		conn.Close()
+		c.Close()
+		a.emit("controller:disconnected", remoteIP)
 		log.Printf("[server] Connection closed with %s - control session ended", remoteIP)
 	}()
 
-	for {
-		var msg wire.Message
-		if err := wire.Receive(conn, &msg); err != nil {
-			log.Printf("[server] Read error from %s: %v", remoteIP, err)
+	if err := a.controlRouter(ctx, cs).Serve(ctx, c); err != nil {
+		if ctx.Err() != nil {
+			log.Printf("[server] Session with %s ended by shutdown", remoteIP)
 			return
 		}
+		log.Printf("[server] Session with %s ended: %v", remoteIP, err)
+		a.punish(remoteIP, err)
+	}
+}
 
-		// Handle different message types
-		switch msg.Type {
-		case "control_start":
-			log.Printf("[server] Control session started by %s", remoteIP)
-			// Acknowledge control start
-			ack := &wire.Message{
-				Type: "control_ack",
-				Data: "Control session acknowledged",
+// offerMotion opens the UDP side channel for this session and tells the
+// controller about it. The first datagram that gets through is confirmed
+// so the controller can switch pointer motion over
+func (a *App) offerMotion(ctx context.Context, c *wire.Conn, cs *controlSession) (*wire.MotionListener, error) {
+	motion, offer, err := wire.ListenMotion()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Send(ctx, wire.MsgUDPOffer, offer); err != nil {
+		motion.Close()
+		return nil, err
+	}
+
+	go func() {
+		ready := false
+		for {
+			event, err := motion.Read()
+			if err != nil {
+				return
 			}
-			if err := wire.Send(conn, ack); err != nil {
-				log.Printf("[server] Failed to send control ack: %v", err)
+			if !ready {
+				ready = true
+				log.Printf("[server] UDP motion path from %s is open", cs.remoteIP)
+				if err := c.Send(ctx, wire.MsgUDPReady, &wire.UDPReady{}); err != nil {
+					return
+				}
 			}
-		case "input_event":
-			if err := receiver.HandleMessage(&msg); err != nil {
+			if event == nil || !cs.holding.Load() {
+				continue
+			}
+			c.Recorder().Record(wire.DirIn, &wire.Message{Type: wire.MsgInputEvent, Event: event})
+			if err := cs.receiver.HandleEvent(event); err != nil {
 				log.Printf("[server] Failed to handle input event: %v", err)
-				// Continue processing other events
+			}
+		}
+	}()
+	return motion, nil
+}
+
+// acceptChannels hands the controller's input channel to the session and
+// turns away channels no subsystem serves
+func (a *App) acceptChannels(mux *wire.Mux, remoteIP string, input chan<- *wire.Channel) {
+	for {
+		ch, err := mux.Accept()
+		if err != nil {
+			return
+		}
+
+		switch ch.Name() {
+		case control.InputChannel:
+			select {
+			case input <- ch:
+			default:
+				log.Printf("[server] %s opened a second input channel", remoteIP)
+				ch.Close()
 			}
 		default:
-			log.Printf("[server] Received unknown message type from %s: %s", remoteIP, msg.Type)
+			log.Printf("[server] %s opened unknown channel %q", remoteIP, ch.Name())
+			ch.Close()
+		}
+	}
+}
+
+// controlRouter returns the handlers for a controller connection. Input is
+// only accepted while the controller holds the floor. Floor changes are
+// sent under ctx, the session's context
+func (a *App) controlRouter(ctx context.Context, cs *controlSession) *wire.Router {
+	router := wire.NewRouter()
+	router.Use(func(next wire.Handler) wire.Handler {
+		return func(ctx context.Context, c *wire.Conn, msg *wire.Message) error {
+			// Dropped input never reaches the capture, the input
+			// handler records what it executes
+			if msg.Type == wire.MsgInputEvent && !cs.holding.Load() {
+				return nil
+			}
+			return next(ctx, c, msg)
+		}
+	})
+
+	wire.Register(router, wire.MsgControlStart, func(_ context.Context, c *wire.Conn, _ *wire.ControlStart) error {
+		log.Printf("[server] Control session started by %s", cs.remoteIP)
+		if err := c.Send(ctx, wire.MsgControlAck, &wire.ControlAck{}); err != nil {
+			log.Printf("[server] Failed to send control ack: %v", err)
+		}
+
+		err := a.floor.Request(cs.id, cs.peerID, cs.name, func(state control.FloorState, holder string) {
+			a.floorChanged(ctx, c, cs, state, holder)
+		})
+		var busy *control.BusyError
+		if errors.As(err, &busy) {
+			log.Printf("[server] Turning %s away: %v", cs.remoteIP, busy)
+			c.Send(ctx, wire.MsgBye, &wire.Bye{Reason: busy.Error()})
+		}
+		return err
+	})
+	wire.Register(router, wire.MsgInputEvent, func(_ context.Context, c *wire.Conn, event *model.InputEvent) error {
+		c.Recorder().Record(wire.DirIn, &wire.Message{Type: wire.MsgInputEvent, Event: event})
+		if err := cs.receiver.HandleEvent(event); err != nil {
+			log.Printf("[server] Failed to handle input event: %v", err)
+			// Continue processing other events
 		}
+		return nil
+	})
+	return router
+}
+
+// floorChanged applies a floor decision to a controller connection and
+// tells the controller about it
+func (a *App) floorChanged(ctx context.Context, c *wire.Conn, cs *controlSession, state control.FloorState, holder string) {
+	log.Printf("[server] Floor %s for %s, held by %s", state, cs.remoteIP, holder)
+	cs.holding.Store(state == control.FloorGranted)
+	if state == control.FloorRevoked {
+		cs.receiver.ReleaseAll()
+	}
+	if err := c.Send(ctx, wire.MsgFloor, &wire.Floor{State: string(state), Holder: holder}); err != nil {
+		log.Printf("[server] Failed to send floor state to %s: %v", cs.remoteIP, err)
+	}
+}
+
+// punish bans the peer when err shows it broke the protocol. Disconnects,
+// timeouts and version mismatches are not held against it
+func (a *App) punish(remoteIP string, err error) {
+	var mismatch *wire.VersionMismatchError
+	if !wire.IsProtocolError(err) || errors.As(err, &mismatch) {
+		return
+	}
+	log.Printf("[server] Banning %s for %s: %v", remoteIP, abuseBanDuration, err)
+	a.server.Ban(remoteIP, abuseBanDuration)
+}
+
+func (a *App) newPairer() (*pairing.Pairer, error) {
+	dir, err := shared.ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := pairing.LoadStore(filepath.Join(dir, pairing.PairedPeersFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load paired peers: %w", err)
+	}
+
+	return pairing.NewPairer(store, func(code string) {
+		log.Printf("[server] Pairing code: %s", code)
+		a.emit("pairing:code", code)
+	})
+}
+
+// Sessions lists the controllers currently connected to us
+func (a *App) Sessions() []wire.SessionInfo {
+	if a.server == nil {
+		return nil
+	}
+	return a.server.Sessions()
+}
+
+// HandOver gives local input to the waiting controller of session id
+func (a *App) HandOver(id uint64) error {
+	return a.floor.HandOver(id)
+}
+
+// FloorHolder returns the session that currently controls this device, 0
+// when none does
+func (a *App) FloorHolder() uint64 {
+	return a.floor.Holder()
+}
+
+// PairingCode returns the one-time code a new controller must enter
+func (a *App) PairingCode() string {
+	if a.pairer == nil {
+		return ""
 	}
+	return a.pairer.Code()
 }
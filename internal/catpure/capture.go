@@ -5,5 +5,9 @@ import "copy/internal/model"
 // InputCapture captures local keyboard and mouse input
 type InputCapture interface {
 	Capture(eventCh chan<- model.InputEvent, stopCh <-chan struct{}) error
+	// RawMotion reports whether Capture also delivers the device's own
+	// motion as relative events, which go on when the pointer stops at the
+	// edge of the screen
+	RawMotion() bool
 	Close() error
 }
@@ -3,10 +3,10 @@ package capture
 import (
 	"bufio"
 	"copy/internal/model"
-	"encoding/json"
 	"fmt"
 	"log"
 	"os/exec"
+	"strconv"
 	"strings"
 )
 
@@ -92,16 +92,15 @@ func (l *LinuxInputCapture) captureKeyboard(deviceID string, eventCh chan<- mode
 				// Convert key code to key name (simplified)
 				keyName := keyCodeToName(keyCode)
 
-				kbEvent := model.KeyboardEvent{
+				kbEvent := &model.KeyboardEvent{
 					Key:       keyName,
 					Action:    action,
 					Modifiers: []string{}, // xinput test doesn't show modifiers easily
 				}
 
-				data, _ := json.Marshal(kbEvent)
 				eventCh <- model.InputEvent{
-					Type: "keyboard",
-					Data: string(data),
+					Type:     model.EventKeyboard,
+					Keyboard: kbEvent,
 				}
 			}
 		}
@@ -124,6 +123,17 @@ func (l *LinuxInputCapture) captureMouse(deviceID string, eventCh chan<- model.I
 
 	scanner := bufio.NewScanner(stdout)
 	var lastX, lastY int
+
+	// raw is the motion of the RawMotion event being read, its valuators
+	// follow on the next lines
+	var raw *model.MouseRelativeEvent
+	flushRaw := func() {
+		if raw != nil && (raw.DX != 0 || raw.DY != 0) {
+			eventCh <- model.InputEvent{Type: model.EventMouseRelative, MouseRelative: raw}
+		}
+		raw = nil
+	}
+
 	for scanner.Scan() {
 		select {
 		case <-stopCh:
@@ -133,17 +143,32 @@ func (l *LinuxInputCapture) captureMouse(deviceID string, eventCh chan<- model.I
 		}
 
 		line := scanner.Text()
+		if raw != nil && !strings.Contains(line, "EVENT") {
+			if strings.TrimSpace(line) == "" {
+				flushRaw()
+			} else {
+				parseRawValuator(line, raw)
+			}
+			continue
+		}
+		flushRaw()
+
+		// Application windows stop most Motion events reaching the root,
+		// so RawMotion polls the position below as well. The controller
+		// drops whichever of the two its motion mode does not use
+		if strings.Contains(line, "(RawMotion)") {
+			raw = &model.MouseRelativeEvent{}
+		}
+
 		// Parse mouse events from xinput test-xi2
 		// This is simplified - real implementation would parse XI2 events properly
 		if strings.Contains(line, "EVENT") {
 			// For now, get current mouse position
 			x, y, err := getMousePosition()
 			if err == nil && (x != lastX || y != lastY) {
-				moveEvent := model.MouseMoveEvent{X: x, Y: y}
-				data, _ := json.Marshal(moveEvent)
 				eventCh <- model.InputEvent{
-					Type: "mouse_move",
-					Data: string(data),
+					Type:      model.EventMouseMove,
+					MouseMove: &model.MouseMoveEvent{X: x, Y: y},
 				}
 				lastX, lastY = x, y
 			}
@@ -151,6 +176,34 @@ func (l *LinuxInputCapture) captureMouse(deviceID string, eventCh chan<- model.I
 	}
 }
 
+// parseRawValuator reads an axis of a RawMotion event into rel. Lines look
+// like "0: 1.56 (2.00)", the accelerated value then the device's own in
+// parentheses, axis 0 is x and 1 is y
+func parseRawValuator(line string, rel *model.MouseRelativeEvent) {
+	parts := strings.Fields(line)
+	if len(parts) < 2 {
+		return
+	}
+	value := parts[len(parts)-1]
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "("), ")")
+	delta, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return
+	}
+	switch parts[0] {
+	case "0:":
+		rel.DX = delta
+	case "1:":
+		rel.DY = delta
+	}
+}
+
+// RawMotion is true, xinput reports the device's motion as RawMotion
+// events
+func (l *LinuxInputCapture) RawMotion() bool {
+	return true
+}
+
 func getKeyboardID() (string, error) {
 	// Try to find a keyboard device
 	cmd2 := exec.Command("xinput", "list")
@@ -223,19 +276,36 @@ func getMousePosition() (int, int, error) {
 	return x, y, nil
 }
 
+// qwertyRows are the X keycodes of the digit and letter rows, from the
+// first key of each row
+var qwertyRows = []struct {
+	first int
+	keys  string
+}{
+	{10, "1234567890"},
+	{24, "qwertyuiop"},
+	{38, "asdfghjkl"},
+	{52, "zxcvbnm"},
+}
+
 func keyCodeToName(code string) string {
 	// Simplified key code mapping - in production, use proper X11 keycode mapping
 	keyMap := map[string]string{
 		"36": "Return", "37": "Control_L", "50": "Shift_L", "64": "Alt_L",
+		"105": "Control_R", "62": "Shift_R", "108": "Alt_R", "133": "Super_L",
 		"9": "Escape", "23": "Tab", "65": "space", "22": "BackSpace",
+		"119": "Delete", "115": "End",
 	}
 	if name, ok := keyMap[code]; ok {
 		return name
 	}
-	// For letters, try to map
-	if code >= "10" && code <= "35" {
-		// Rough mapping for a-z
-		return fmt.Sprintf("key_%s", code)
+	// Digits and letters, assuming a QWERTY layout
+	if n, err := strconv.Atoi(code); err == nil {
+		for _, row := range qwertyRows {
+			if i := n - row.first; i >= 0 && i < len(row.keys) {
+				return row.keys[i : i+1]
+			}
+		}
 	}
 	return code
 }
@@ -0,0 +1,44 @@
+package capture
+
+import (
+	"copy/internal/model"
+	"testing"
+)
+
+func TestParseRawValuator(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want model.MouseRelativeEvent
+	}{
+		{"x takes the device's value", "        0: 1.56 (2.00)", model.MouseRelativeEvent{DX: 2}},
+		{"y", "        1: -0.78 (-1.50)", model.MouseRelativeEvent{DY: -1.5}},
+		{"single value", "    0: 3.25", model.MouseRelativeEvent{DX: 3.25}},
+		{"other axis", "        3: 1.00 (1.00)", model.MouseRelativeEvent{}},
+		{"not a number", "        0: 1.00 (abc)", model.MouseRelativeEvent{}},
+		{"axis alone", "        0:", model.MouseRelativeEvent{}},
+		{"blank", "", model.MouseRelativeEvent{}},
+		{"valuator header", "    valuators:", model.MouseRelativeEvent{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got model.MouseRelativeEvent
+			parseRawValuator(tt.line, &got)
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRawValuatorEvent(t *testing.T) {
+	// Both axes of one RawMotion event land in the same delta
+	var rel model.MouseRelativeEvent
+	for _, line := range []string{"    valuators:", "        0: 4.00 (4.00)", "        1: -2.00 (-2.00)"} {
+		parseRawValuator(line, &rel)
+	}
+	if rel != (model.MouseRelativeEvent{DX: 4, DY: -2}) {
+		t.Errorf("got %+v", rel)
+	}
+}
@@ -3,7 +3,6 @@ package capture
 import (
 	"copy/internal/model"
 	"copy/pkg/windows"
-	"encoding/json"
 	"log"
 	"runtime"
 	"time"
@@ -78,6 +77,9 @@ func (w *WindowsInputCapture) captureKeyboard(eventCh chan<- model.InputEvent, s
 	for i := uint32(0x41); i <= 0x5A; i++ { // A-Z
 		keyNames[i] = string(rune('a' + (i - 0x41)))
 	}
+	for i := uint32(0x30); i <= 0x39; i++ { // 0-9
+		keyNames[i] = string(rune('0' + (i - 0x30)))
+	}
 	keyNames[windows.VK_CONTROL] = "Control_L"
 	keyNames[windows.VK_SHIFT] = "Shift_L"
 	keyNames[0x0D] = "Return"
@@ -85,6 +87,8 @@ func (w *WindowsInputCapture) captureKeyboard(eventCh chan<- model.InputEvent, s
 	keyNames[0x09] = "Tab"
 	keyNames[0x20] = "space"
 	keyNames[0x08] = "BackSpace"
+	keyNames[0x2E] = "Delete"
+	keyNames[0x23] = "End"
 	// Add more as needed
 
 	for {
@@ -123,7 +127,7 @@ func (w *WindowsInputCapture) captureKeyboard(eventCh chan<- model.InputEvent, s
 
 					// Only send events for actual key presses (not just modifier changes)
 					if vkCode != windows.VK_CONTROL && vkCode != windows.VK_SHIFT && vkCode != 0x12 {
-						kbEvent := model.KeyboardEvent{
+						kbEvent := &model.KeyboardEvent{
 							Key:       keyName,
 							Action:    "press",
 							Modifiers: modifiers,
@@ -132,10 +136,9 @@ func (w *WindowsInputCapture) captureKeyboard(eventCh chan<- model.InputEvent, s
 							kbEvent.Action = "release"
 						}
 
-						data, _ := json.Marshal(kbEvent)
 						eventCh <- model.InputEvent{
-							Type: "keyboard",
-							Data: string(data),
+							Type:     model.EventKeyboard,
+							Keyboard: kbEvent,
 						}
 					}
 				}
@@ -175,14 +178,12 @@ func (w *WindowsInputCapture) captureMouse(eventCh chan<- model.InputEvent, stop
 
 			// Check mouse movement
 			if pt.X != lastX || pt.Y != lastY {
-				moveEvent := model.MouseMoveEvent{
-					X: int(pt.X),
-					Y: int(pt.Y),
-				}
-				data, _ := json.Marshal(moveEvent)
 				eventCh <- model.InputEvent{
-					Type: "mouse_move",
-					Data: string(data),
+					Type: model.EventMouseMove,
+					MouseMove: &model.MouseMoveEvent{
+						X: int(pt.X),
+						Y: int(pt.Y),
+					},
 				}
 				lastX, lastY = pt.X, pt.Y
 			}
@@ -228,31 +229,29 @@ func (w *WindowsInputCapture) captureMouse(eventCh chan<- model.InputEvent, stop
 
 						if isDoubleClick {
 							// Send double-click event (executor will send full press/release/press/release sequence)
-							clickEvent := model.MouseClickEvent{
+							clickEvent := &model.MouseClickEvent{
 								Button:   buttonName,
 								Action:   "double",
 								X:        int(pt.X),
 								Y:        int(pt.Y),
 								IsDouble: true,
 							}
-							data, _ := json.Marshal(clickEvent)
 							eventCh <- model.InputEvent{
-								Type: "mouse_click",
-								Data: string(data),
+								Type:       model.EventMouseClick,
+								MouseClick: clickEvent,
 							}
 						} else {
 							// Normal single click press
-							clickEvent := model.MouseClickEvent{
+							clickEvent := &model.MouseClickEvent{
 								Button:   buttonName,
 								Action:   "press",
 								X:        int(pt.X),
 								Y:        int(pt.Y),
 								IsDouble: false,
 							}
-							data, _ := json.Marshal(clickEvent)
 							eventCh <- model.InputEvent{
-								Type: "mouse_click",
-								Data: string(data),
+								Type:       model.EventMouseClick,
+								MouseClick: clickEvent,
 							}
 						}
 
@@ -269,7 +268,7 @@ func (w *WindowsInputCapture) captureMouse(eventCh chan<- model.InputEvent, stop
 						}
 
 						// Normal single click release
-						clickEvent := model.MouseClickEvent{
+						clickEvent := &model.MouseClickEvent{
 							Button:   buttonName,
 							Action:   "release",
 							X:        int(pt.X),
@@ -277,10 +276,9 @@ func (w *WindowsInputCapture) captureMouse(eventCh chan<- model.InputEvent, stop
 							IsDouble: false,
 						}
 
-						data, _ := json.Marshal(clickEvent)
 						eventCh <- model.InputEvent{
-							Type: "mouse_click",
-							Data: string(data),
+							Type:       model.EventMouseClick,
+							MouseClick: clickEvent,
 						}
 					}
 				}
@@ -291,6 +289,11 @@ func (w *WindowsInputCapture) captureMouse(eventCh chan<- model.InputEvent, stop
 	}
 }
 
+// RawMotion is false, motion comes from polling the cursor position
+func (w *WindowsInputCapture) RawMotion() bool {
+	return false
+}
+
 func (w *WindowsInputCapture) Close() error {
 	return nil
 }
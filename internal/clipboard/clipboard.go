@@ -0,0 +1,18 @@
+package clipboard
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Text returns the text on the local clipboard, empty when it holds none
+func Text() (string, error) {
+	switch runtime.GOOS {
+	case "linux":
+		return linuxText()
+	case "windows":
+		return windowsText()
+	default:
+		return "", fmt.Errorf("unsupported OS: %s", runtime.GOOS)
+	}
+}
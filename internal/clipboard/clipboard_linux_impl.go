@@ -0,0 +1,20 @@
+package clipboard
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+func linuxText() (string, error) {
+	output, err := exec.Command("xclip", "-selection", "clipboard", "-out").Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			// xclip fails when the clipboard holds no text
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read clipboard: %w", err)
+	}
+	return string(output), nil
+}
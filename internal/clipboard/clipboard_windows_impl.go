@@ -0,0 +1,48 @@
+package clipboard
+
+import (
+	"copy/pkg/windows"
+	"fmt"
+	"runtime"
+	"unicode/utf16"
+	"unsafe"
+)
+
+func windowsText() (string, error) {
+	if runtime.GOOS != "windows" {
+		return "", nil
+	}
+	if err := windows.InitWindowsDLLs(); err != nil {
+		return "", err
+	}
+
+	// The clipboard belongs to one thread at a time
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if ok, _, err := windows.ProcOpenClipboard.Call(0); ok == 0 {
+		return "", fmt.Errorf("failed to open clipboard: %w", err)
+	}
+	defer windows.ProcCloseClipboard.Call()
+
+	handle, _, _ := windows.ProcGetClipboardData.Call(windows.CF_UNICODETEXT)
+	if handle == 0 {
+		return "", nil
+	}
+	data, _, err := windows.ProcGlobalLock.Call(handle)
+	if data == 0 {
+		return "", fmt.Errorf("failed to read clipboard: %w", err)
+	}
+	defer windows.ProcGlobalUnlock.Call(handle)
+
+	// The text is UTF-16 up to a zero, in memory Go does not manage
+	ptr := *(*unsafe.Pointer)(unsafe.Pointer(&data))
+	var text []uint16
+	for i := 0; ; i++ {
+		c := *(*uint16)(unsafe.Add(ptr, 2*i))
+		if c == 0 {
+			break
+		}
+		text = append(text, c)
+	}
+	return string(utf16.Decode(text)), nil
+}
@@ -3,13 +3,16 @@
 
 package control
 
-import "runtime"
+import (
+	"copy/internal/hotkey"
+	"runtime"
+)
 
 // BlackScreenWindow manages a fullscreen black window (Linux stub)
 type BlackScreenWindow struct{}
 
 // NewBlackScreenWindow creates a new black screen window manager (Linux stub)
-func NewBlackScreenWindow() (*BlackScreenWindow, error) {
+func NewBlackScreenWindow(release hotkey.Chord) (*BlackScreenWindow, error) {
 	if runtime.GOOS != "linux" {
 		return nil, nil
 	}
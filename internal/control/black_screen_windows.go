@@ -5,6 +5,7 @@ package control
 
 import (
 	"context"
+	"copy/internal/hotkey"
 	"embed"
 	"io/fs"
 	"log"
@@ -25,9 +26,15 @@ var blackScreenAssets embed.FS
 type BlackScreenApp struct {
 	ctx      context.Context
 	hotkeyCh chan struct{}
+	release  hotkey.Chord
 }
 
-// OnHotkey is called from JavaScript when Ctrl+Shift+B is pressed
+// ReleaseHotkey returns the chord JavaScript watches for
+func (a *BlackScreenApp) ReleaseHotkey() string {
+	return a.release.String()
+}
+
+// OnHotkey is called from JavaScript when the release hotkey is pressed
 func (a *BlackScreenApp) OnHotkey() {
 	log.Printf("[blackscreen] Hotkey pressed")
 	select {
@@ -42,17 +49,20 @@ type BlackScreenWindow struct {
 	wg       sync.WaitGroup
 	stopCh   chan struct{}
 	hotkeyCh chan struct{} // Channel to signal hotkey detected
+	release  hotkey.Chord
 	running  bool
 	mu       sync.Mutex
 	ctx      context.Context
 	cancel   context.CancelFunc
 }
 
-// NewBlackScreenWindow creates a new black screen window manager
-func NewBlackScreenWindow() (*BlackScreenWindow, error) {
+// NewBlackScreenWindow creates a new black screen window manager, pressing
+// release on it signals GetHotkeyChannel
+func NewBlackScreenWindow(release hotkey.Chord) (*BlackScreenWindow, error) {
 	return &BlackScreenWindow{
 		stopCh:   make(chan struct{}),
 		hotkeyCh: make(chan struct{}, 1),
+		release:  release,
 	}, nil
 }
 
@@ -84,6 +94,7 @@ func (b *BlackScreenWindow) Show() error {
 	// Create app struct
 	app := &BlackScreenApp{
 		hotkeyCh: b.hotkeyCh,
+		release:  b.release,
 	}
 
 	b.mu.Lock()
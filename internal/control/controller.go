@@ -1,44 +1,152 @@
 package control
 
 import (
+	"context"
 	capture "copy/internal/catpure"
+	"copy/internal/display"
+	"copy/internal/hotkey"
+	"copy/internal/layout"
 	"copy/internal/model"
-	"copy/internal/shared"
 	"copy/internal/wire"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"runtime"
+	"sync/atomic"
 )
 
-// Controller captures local input and sends it to the remote peer
+// InputChannel names the multiplexed channel that carries the control
+// session and input events
+const InputChannel = "input"
+
+// ErrPeerLeft is returned by Start when the receiver ended the session on
+// purpose, there is no point reconnecting then
+var ErrPeerLeft = errors.New("receiver ended the session")
+
+// ErrReleased is returned by Start when the user pressed the release hotkey
+var ErrReleased = errors.New("control stopped by user")
+
+// maxTextChunk bounds the text carried by one text event, longer text is
+// split so each event stays within the input event frame limit
+const maxTextChunk = 1024
+
+// typeRequest asks the running controller to type text on the receiver
+type typeRequest struct {
+	text   string
+	result chan error
+}
+
+// Controller captures local input and sends it to one or more receivers
 type Controller struct {
-	client      *wire.Client
+	peers       []*peerLink
 	stopCh      chan struct{}
+	done        chan struct{}
 	blackScreen *BlackScreenWindow
+	blanked     bool // The black screen is up
+
+	// desk follows the pointer across the screens of Layout, nil when all
+	// input goes to the only receiver
+	desk *desk
+	// target is the receiver input goes to, nil while it stays on our screen
+	target atomic.Pointer[peerLink]
+	// held is what is held down on target, released there when input moves
+	// to another screen
+	held *inputState
+
+	// OnStatus, if set, is told when a receiver's session goes offline and
+	// back, waits for another controller to give it up or goes to standby
+	OnStatus func(peer, status string)
+
+	// Layout, if set, places the receivers' screens around ours and input
+	// goes to the screen the pointer is on. The receivers must support
+	// wire.CapPointer. Without it there must be exactly one receiver, which
+	// gets all input
+	Layout *layout.Layout
+	// DeadCorner is how many pixels at each end of a screen edge do not
+	// switch screens
+	DeadCorner int
+	// Mapping is how our pointer lands on a receiver's screen without a
+	// layout, one of the Map* modes. Empty sends our pixels as they are
+	Mapping string
+	// Relative starts the session moving the receiver's pointer by deltas,
+	// for apps that lock or warp it. Not available with a layout
+	Relative bool
+	// Hotkeys are the chords caught before input is forwarded and the
+	// actions they trigger, hotkey.Defaults when nil
+	Hotkeys hotkey.Bindings
+
+	// keys catches Hotkeys in the captured input
+	keys *hotkey.Matcher
+
+	// relative is set while pointer motion goes out as deltas
+	relative    *relativeMotion
+	relativeCh  chan bool
+	canRelative bool // The receiver moves its pointer by deltas
+	rawMotion   bool // The capture delivers the device's motion
 }
 
-// NewController creates a new input controller
-func NewController(client *wire.Client) *Controller {
-	return &Controller{
-		client: client,
-		stopCh: make(chan struct{}),
+// NewController creates a new input controller driving peers
+func NewController(peers ...Peer) *Controller {
+	c := &Controller{
+		stopCh:     make(chan struct{}),
+		done:       make(chan struct{}),
+		held:       newInputState(),
+		keys:       hotkey.NewMatcher(),
+		relativeCh: make(chan bool, 1),
 	}
+	for _, peer := range peers {
+		p := newPeerLink(peer)
+		p.status = func(status string) {
+			if c.OnStatus != nil {
+				c.OnStatus(p.name, status)
+			}
+		}
+		p.holding = func() string {
+			if c.desk != nil && c.target.Load() != p {
+				return StatusStandby
+			}
+			return StatusConnected
+		}
+		c.peers = append(c.peers, p)
+	}
+	return c
+}
+
+// ControllerCapabilities returns what a controller advertises in its hello
+func ControllerCapabilities() []string {
+	return model.InputCapabilities
 }
 
-// Start begins capturing and forwarding input events
-func (c *Controller) Start() error {
+// peerResult is how a receiver's session ended
+type peerResult struct {
+	peer *peerLink
+	err  error
+}
+
+// Start begins capturing and forwarding input events. It returns once the
+// last receiver is gone, or ctx's error once ctx is done
+func (c *Controller) Start(ctx context.Context) error {
 	log.Printf("[input] Starting input controller...")
+	defer close(c.done)
+
+	if c.Hotkeys == nil {
+		c.Hotkeys = hotkey.Defaults()
+	}
+	if err := c.startDesk(); err != nil {
+		return err
+	}
 
-	// Create and show black screen window (Windows only)
+	// Create black screen window (Windows only), with a layout it is only
+	// shown while input goes to another screen
 	if runtime.GOOS == "windows" {
-		blackScreen, err := NewBlackScreenWindow()
+		release, _ := c.Hotkeys.Chord(hotkey.ActionRelease)
+		blackScreen, err := NewBlackScreenWindow(release)
 		if err != nil {
 			log.Printf("[input] Warning: Failed to create black screen: %v", err)
 		} else {
 			c.blackScreen = blackScreen
-			if err := blackScreen.Show(); err != nil {
-				log.Printf("[input] Warning: Failed to show black screen: %v", err)
+			if c.desk == nil {
+				c.showBlackScreen()
 			}
 		}
 		// Ensure black screen is destroyed when done
@@ -67,6 +175,8 @@ func (c *Controller) Start() error {
 	defer capt.Close()
 
 	log.Printf("[input] Input capture initialized successfully")
+	c.rawMotion = capt.RawMotion()
+	c.setRelative(c.Relative)
 
 	// Channel for input events
 	eventCh := make(chan model.InputEvent, 100)
@@ -87,23 +197,28 @@ func (c *Controller) Start() error {
 		}
 	}()
 
-	// Send initial control message to establish session
-	initMsg := &wire.Message{
-		Type: "control_start",
-		Data: "Control session started",
-	}
-	if err := c.client.Write(initMsg); err != nil {
-		return fmt.Errorf("failed to send control start message: %w", err)
+	// Drive every receiver, returning only once all of them let go
+	ctx, cancel := context.WithCancel(ctx)
+	peerDone := make(chan peerResult, len(c.peers))
+	for _, p := range c.peers {
+		go func() {
+			peerDone <- peerResult{p, p.run(ctx)}
+		}()
 	}
-	log.Printf("[input] Control session established")
-
-	// Check for hotkey from black screen window (Windows only)
-	var hotkeyCh <-chan struct{}
-	if runtime.GOOS == "windows" && c.blackScreen != nil {
-		hotkeyCh = c.blackScreen.GetHotkeyChannel()
+	live := len(c.peers)
+	defer func() {
+		cancel()
+		for ; live > 0; live-- {
+			<-peerDone
+		}
+	}()
+	if c.desk != nil {
+		for _, p := range c.peers {
+			p.status(StatusStandby)
+		}
 	}
 
-	// Forward events to remote peer
+	// Forward events to the receivers
 	for {
 		select {
 		case event, ok := <-eventCh:
@@ -120,50 +235,205 @@ func (c *Controller) Start() error {
 				}
 			}
 
-			// Serialize the full event to JSON
-			eventData, err := json.Marshal(event)
-			if err != nil {
-				log.Printf("[input] Failed to marshal event: %v", err)
+			// Hotkeys are caught before anything is forwarded
+			if action, ok := c.keys.Match(c.Hotkeys, event); ok {
+				if action == "" {
+					continue
+				}
+				if err := c.runHotkey(ctx, action); err != nil {
+					return err
+				}
 				continue
 			}
 
-			// Check for stop hotkey (Ctrl+Shift+B) - only if not from black screen
-			if event.Type == "keyboard" && hotkeyCh == nil {
-				var kbEvent model.KeyboardEvent
-				if err := json.Unmarshal([]byte(event.Data), &kbEvent); err == nil {
-					if kbEvent.Key == "b" &&
-						shared.Contains(kbEvent.Modifiers, "ctrl") &&
-						shared.Contains(kbEvent.Modifiers, "shift") &&
-						kbEvent.Action == "press" {
-						log.Printf("[input] Stop hotkey detected (Ctrl+Shift+B)")
-						return fmt.Errorf("control stopped by user")
-					}
-				}
+			if c.desk != nil {
+				c.routeDesk(ctx, event)
+				continue
 			}
-
-			// Send event to remote peer
-			msg := &wire.Message{
-				Type: "input_event",
-				Data: string(eventData),
+			event, ok = c.pointerMotion(event)
+			if !ok {
+				continue
+			}
+			if target := c.target.Load(); target != nil {
+				c.forward(ctx, target, event)
 			}
-			if err := c.client.Write(msg); err != nil {
-				log.Printf("[input] Failed to send input event: %v", err)
-				return fmt.Errorf("failed to send input event: %w", err)
+
+		case on := <-c.relativeCh:
+			c.setRelative(on)
+
+		case res := <-peerDone:
+			live--
+			if live == 0 {
+				return res.err
 			}
-			log.Printf("[input] Sent input event: %s", event.Type)
+			log.Printf("[input] Session with %s ended: %v", res.peer.name, res.err)
+			c.dropPeer(res.peer)
 
-		case <-hotkeyCh:
+		case <-c.hotkeys():
 			// Hotkey detected from black screen window
-			log.Printf("[input] Stop hotkey detected (Ctrl+Shift+B) from black screen")
-			return fmt.Errorf("control stopped by user")
+			log.Printf("[input] Release hotkey pressed on the black screen")
+			return ErrReleased
 
 		case <-c.stopCh:
 			log.Printf("[input] Controller stopped")
 			return nil
+
+		case <-ctx.Done():
+			log.Printf("[input] Controller cancelled")
+			return ctx.Err()
 		}
 	}
 }
 
+// startDesk lays out the screens when a layout is set, input then starts
+// on our screen. Without one, or when no receiver can be placed, all input
+// goes to the only receiver
+func (c *Controller) startDesk() error {
+	if c.Layout != nil {
+		var placed []*peerLink
+		for _, p := range c.peers {
+			if !p.session.Supports(wire.CapPointer) || !p.session.Supports(model.CapMouseMove) {
+				log.Printf("[input] %s cannot report its pointer, it gets no input", p.name)
+				continue
+			}
+			placed = append(placed, p)
+		}
+
+		local, err := display.Geometry()
+		if err != nil {
+			log.Printf("[input] Screen layout disabled, local screen size unknown: %v", err)
+		} else if d := newDesk(c.Layout, local, placed, c.DeadCorner); len(d.screens) > 1 {
+			c.desk = d
+			log.Printf("[input] Pointer is on this screen, move it onto another screen to control it. Press %s to lock it to a screen", c.hotkeyName(hotkey.ActionLock))
+			return nil
+		}
+	}
+
+	if len(c.peers) != 1 {
+		return errors.New("no screen layout for several receivers")
+	}
+	target := c.peers[0]
+	c.target.Store(target)
+	c.canRelative = target.session.Supports(model.CapMouseRelative)
+
+	if c.Mapping != "" {
+		local, err := display.Geometry()
+		if err == nil && !local.Known() {
+			err = errors.New("display reported no size")
+		}
+		if err != nil {
+			log.Printf("[input] Pointer mapping disabled, local screen size unknown: %v", err)
+			return nil
+		}
+		target.mapping = &pointerMap{mode: c.Mapping, local: local}
+		log.Printf("[input] Mapping pointer from %dx%d to %dx%d (%s)", local.Width, local.Height,
+			target.session.Remote.Screen.Width, target.session.Remote.Screen.Height, c.Mapping)
+	}
+	return nil
+}
+
+// forward sends event to receiver p, keeping track of what is held there
+func (c *Controller) forward(ctx context.Context, p *peerLink, event model.InputEvent) {
+	c.held.track(event)
+	p.send(ctx, event)
+}
+
+// setTarget moves input to p, nil for our screen. Whatever is still held
+// on the previous receiver is released there first
+func (c *Controller) setTarget(ctx context.Context, p *peerLink) {
+	prev := c.target.Load()
+	if prev == p {
+		return
+	}
+	if prev != nil {
+		for _, event := range c.held.releaseEvents() {
+			prev.send(ctx, event)
+		}
+		prev.status(StatusStandby)
+	}
+	c.target.Store(p)
+	if p != nil {
+		p.status(StatusConnected)
+	}
+}
+
+// Type makes the receiver input goes to type text as is, independent of
+// its keyboard layout. It fails when the receiver cannot inject text or is
+// offline
+func (c *Controller) Type(ctx context.Context, text string) error {
+	select {
+	case <-c.done:
+		return errors.New("controller stopped")
+	default:
+	}
+	p := c.target.Load()
+	if p == nil {
+		return errors.New("input is on this screen")
+	}
+
+	req := typeRequest{text: text, result: make(chan error, 1)}
+	select {
+	case p.typeCh <- req:
+	case <-p.done:
+		return fmt.Errorf("session with %s ended", p.name)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-req.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// showBlackScreen blanks our screen while input goes to the receiver
+// (Windows only)
+func (c *Controller) showBlackScreen() {
+	if c.blackScreen == nil || c.blanked {
+		return
+	}
+	// A black screen hidden before signals when it is gone, that is not
+	// the user asking to stop
+	select {
+	case <-c.blackScreen.GetHotkeyChannel():
+	default:
+	}
+	if err := c.blackScreen.Show(); err != nil {
+		log.Printf("[input] Warning: Failed to show black screen: %v", err)
+		return
+	}
+	c.blanked = true
+}
+
+// hideBlackScreen gives our screen back
+func (c *Controller) hideBlackScreen() {
+	if c.blackScreen == nil || !c.blanked {
+		return
+	}
+	if err := c.blackScreen.Hide(); err != nil {
+		log.Printf("[input] Warning: Failed to hide black screen: %v", err)
+	}
+	c.blanked = false
+}
+
+// hotkeyName returns the chord bound to action for messages
+func (c *Controller) hotkeyName(action string) string {
+	if chord, ok := c.Hotkeys.Chord(action); ok {
+		return chord.String()
+	}
+	return "the " + action + " hotkey"
+}
+
+// hotkeys returns the release hotkey signal of the black screen while it is
+// up, nil otherwise
+func (c *Controller) hotkeys() <-chan struct{} {
+	if !c.blanked {
+		return nil
+	}
+	return c.blackScreen.GetHotkeyChannel()
+}
+
 // Stop stops the input controller
 func (c *Controller) Stop() {
 	close(c.stopCh)
@@ -0,0 +1,459 @@
+package control
+
+import (
+	"context"
+	"copy/internal/display"
+	"copy/internal/layout"
+	"copy/internal/model"
+	"log"
+	"time"
+)
+
+const (
+	// DefaultDeadCorner is how many pixels at each end of a screen edge
+	// keep the pointer on its screen, so hot corners stay usable
+	DefaultDeadCorner = 40
+
+	// warpSettle is how long after recentering our pointer the capture may
+	// still deliver positions from before the warp
+	warpSettle = 100 * time.Millisecond
+)
+
+// point is a pointer position in pixels
+type point struct {
+	x, y int
+}
+
+// pointerReport is the last position a receiver told us about
+type pointerReport struct {
+	point
+	at time.Time
+}
+
+// report records where the receiver says its pointer is. It differs from
+// where we put it when the receiver clamped it or its screen is not what
+// its hello said
+func (p *peerLink) report(pt point) {
+	p.reported.Store(&pointerReport{point: pt, at: time.Now()})
+}
+
+// reportedAtEdge reports whether the receiver confirmed its pointer sits at
+// the edges of its screen, r in the desk, that dx and dy point through
+func (p *peerLink) reportedAtEdge(r layout.Rect, dx, dy int) bool {
+	report := p.reported.Load()
+	if report == nil {
+		return false
+	}
+	switch {
+	case dx < 0 && report.x > 1, dx > 0 && report.x < r.Width-2:
+		return false
+	case dy < 0 && report.y > 1, dy > 0 && report.y < r.Height-2:
+		return false
+	}
+	return true
+}
+
+// deskScreen is a screen of the desk, peer is nil for ours
+type deskScreen struct {
+	name string
+	peer *peerLink
+	rect layout.Rect
+}
+
+// desk lays the screens of a layout out in one coordinate space, ours at
+// the origin, and follows a cursor across them. Input goes to the screen
+// the cursor is on. While that is another screen our pointer is parked in
+// the middle of ours and only its motion counts
+type desk struct {
+	screens    []*deskScreen
+	local      *deskScreen
+	current    *deskScreen
+	cursor     point
+	deadCorner int
+	locked     bool
+
+	// last is our pointer position the previous motion was measured from
+	last     point
+	warpedAt time.Time
+	movedAt  time.Time
+}
+
+// newDesk places the screens of peers according to l. Peers the layout
+// cannot place are left off the desk
+func newDesk(l *layout.Layout, local model.ScreenGeometry, peers []*peerLink, deadCorner int) *desk {
+	sizes := make(map[string]model.ScreenGeometry)
+	for _, p := range peers {
+		sizes[p.name] = p.session.Remote.Screen
+	}
+	rects := l.Arrange(local, sizes)
+
+	d := &desk{deadCorner: deadCorner}
+	d.local = &deskScreen{name: layout.LocalScreen, rect: rects[layout.LocalScreen]}
+	d.screens = append(d.screens, d.local)
+	for _, p := range peers {
+		rect, ok := rects[p.name]
+		if !ok {
+			log.Printf("[input] %s has no place in the layout, it gets no input", p.name)
+			continue
+		}
+		d.screens = append(d.screens, &deskScreen{name: p.name, peer: p, rect: rect})
+	}
+	d.current = d.local
+	return d
+}
+
+func (d *desk) screenAt(pt point) *deskScreen {
+	for _, s := range d.screens {
+		if s.rect.Contains(pt.x, pt.y) {
+			return s
+		}
+	}
+	return nil
+}
+
+func (d *desk) screenNamed(name string) *deskScreen {
+	for _, s := range d.screens {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// remove takes the screen of p off the desk, reporting whether the cursor
+// was on it
+func (d *desk) remove(p *peerLink) bool {
+	for i, s := range d.screens {
+		if s.peer == p {
+			d.screens = append(d.screens[:i], d.screens[i+1:]...)
+			return d.current == s
+		}
+	}
+	return false
+}
+
+// leaveLocal follows our pointer at pt on our screen. When it pushes
+// against an edge with another screen behind it, that screen is returned
+// with where the cursor enters it
+func (d *desk) leaveLocal(pt point) (*deskScreen, point) {
+	d.cursor = pt
+	if d.locked {
+		return nil, point{}
+	}
+
+	// Our pointer cannot leave our screen, one pixel past the edge it sits
+	// on is where it would go
+	r := d.local.rect
+	beyond := pt
+	if pt.x <= r.X {
+		beyond.x = r.X - 1
+	} else if pt.x >= r.X+r.Width-1 {
+		beyond.x = r.X + r.Width
+	}
+	if pt.y <= r.Y {
+		beyond.y = r.Y - 1
+	} else if pt.y >= r.Y+r.Height-1 {
+		beyond.y = r.Y + r.Height
+	}
+	if beyond == pt {
+		return nil, point{}
+	}
+
+	dx, dy := outside(r, beyond)
+	if d.inDeadCorner(r, pt, dx, dy) {
+		return nil, point{}
+	}
+	next := d.screenAt(beyond)
+	if next == nil {
+		return nil, point{}
+	}
+	// Enter just inside the edge, so the receiver's first report does not
+	// look like leaving again
+	return next, clampTo(next.rect, beyond, 1)
+}
+
+// moveRemote applies our pointer moving to pt to the cursor on another
+// screen. It reports whether the cursor moved, and the screen it crossed
+// into if it did. Leaving a screen needs its receiver to confirm its
+// pointer is at the edge crossed
+func (d *desk) moveRemote(pt point) (*deskScreen, bool) {
+	if !d.warpedAt.IsZero() {
+		// Positions far from the center predate the warp
+		if time.Since(d.warpedAt) < warpSettle && d.distanceFromCenter(pt) > d.recenterRadius()/2 {
+			return nil, false
+		}
+		d.warpedAt = time.Time{}
+	}
+
+	delta := point{pt.x - d.last.x, pt.y - d.last.y}
+	d.last = pt
+	if delta == (point{}) {
+		return nil, false
+	}
+
+	r := d.current.rect
+	to := point{d.cursor.x + delta.x, d.cursor.y + delta.y}
+	if r.Contains(to.x, to.y) {
+		d.moveCursor(to)
+		return nil, true
+	}
+
+	dx, dy := outside(r, to)
+	if !d.locked && d.current.peer.reportedAtEdge(r, dx, dy) && !d.inDeadCorner(r, d.cursor, dx, dy) {
+		if next := d.screenAt(to); next != nil {
+			if next.peer != nil {
+				to = clampTo(next.rect, to, 1)
+			}
+			d.moveCursor(to)
+			return next, true
+		}
+	}
+
+	to = clampTo(r, to, 0)
+	if to == d.cursor {
+		return nil, false
+	}
+	d.moveCursor(to)
+	return nil, true
+}
+
+func (d *desk) moveCursor(to point) {
+	d.cursor = to
+	d.movedAt = time.Now()
+}
+
+// syncReported adopts the last report of the current screen's receiver
+// once our own motion has settled
+func (d *desk) syncReported() {
+	if d.current.peer == nil {
+		return
+	}
+	report := d.current.peer.reported.Load()
+	if report != nil && report.at.Sub(d.movedAt) > 2*pointerReportInterval {
+		r := d.current.rect
+		d.cursor = clampTo(r, point{r.X + report.x, r.Y + report.y}, 0)
+	}
+}
+
+// onScreen returns the cursor in the coordinates of the current screen
+func (d *desk) onScreen() point {
+	return point{d.cursor.x - d.current.rect.X, d.cursor.y - d.current.rect.Y}
+}
+
+// inDeadCorner reports whether leaving r from pt in direction dx, dy starts
+// too close to a corner of r
+func (d *desk) inDeadCorner(r layout.Rect, pt point, dx, dy int) bool {
+	nearEnd := func(along, length int) bool {
+		return along < d.deadCorner || along >= length-d.deadCorner
+	}
+	if dx != 0 && nearEnd(pt.y-r.Y, r.Height) {
+		return true
+	}
+	return dy != 0 && nearEnd(pt.x-r.X, r.Width)
+}
+
+// center returns the middle of our screen, where our pointer is parked
+// while input goes to another screen
+func (d *desk) center() point {
+	r := d.local.rect
+	return point{r.X + r.Width/2, r.Y + r.Height/2}
+}
+
+// recenterRadius is how far our pointer may wander from the center before
+// it is parked there again, so it never stops at our screen's border
+func (d *desk) recenterRadius() int {
+	return min(d.local.rect.Width, d.local.rect.Height) / 4
+}
+
+func (d *desk) distanceFromCenter(pt point) int {
+	c := d.center()
+	return max(abs(pt.x-c.x), abs(pt.y-c.y))
+}
+
+// outside returns the direction pt lies outside r in, -1, 0 or 1 per axis
+func outside(r layout.Rect, pt point) (dx, dy int) {
+	switch {
+	case pt.x < r.X:
+		dx = -1
+	case pt.x >= r.X+r.Width:
+		dx = 1
+	}
+	switch {
+	case pt.y < r.Y:
+		dy = -1
+	case pt.y >= r.Y+r.Height:
+		dy = 1
+	}
+	return dx, dy
+}
+
+// clampTo moves pt inside r, at least inset pixels away from its edges
+func clampTo(r layout.Rect, pt point, inset int) point {
+	return point{
+		x: max(r.X+inset, min(pt.x, r.X+r.Width-1-inset)),
+		y: max(r.Y+inset, min(pt.y, r.Y+r.Height-1-inset)),
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// routeDesk sends event to the screen the cursor is on, moving the cursor
+// across screens with our pointer
+func (c *Controller) routeDesk(ctx context.Context, event model.InputEvent) {
+	d := c.desk
+	switch event.Type {
+	case model.EventMouseMove:
+		pt := point{event.MouseMove.X, event.MouseMove.Y}
+		if d.current == d.local {
+			next, entry := d.leaveLocal(pt)
+			if next != nil {
+				d.last = pt
+				c.enter(ctx, next, entry)
+			}
+			return
+		}
+
+		d.syncReported()
+		next, moved := d.moveRemote(pt)
+		if next != nil {
+			c.enter(ctx, next, d.cursor)
+			return
+		}
+		if !moved {
+			return
+		}
+		if d.distanceFromCenter(pt) > d.recenterRadius() {
+			c.recenter()
+		}
+		c.sendCursor(ctx)
+
+	case model.EventMouseRelative:
+		// The cursor follows our pointer's positions
+
+	case model.EventMouseClick:
+		if d.current.peer == nil {
+			return
+		}
+		click := *event.MouseClick
+		pt := d.onScreen()
+		click.X, click.Y = pt.x, pt.y
+		event.MouseClick = &click
+		c.forward(ctx, d.current.peer, event)
+
+	default:
+		if d.current.peer != nil {
+			c.forward(ctx, d.current.peer, event)
+		}
+	}
+}
+
+// toggleLock locks input to the current screen until called again
+func (c *Controller) toggleLock() {
+	d := c.desk
+	if d == nil {
+		log.Printf("[input] Locking to a screen needs a screen layout")
+		return
+	}
+	d.locked = !d.locked
+	if d.locked {
+		log.Printf("[input] Locked to %s", d.current.name)
+	} else {
+		log.Printf("[input] Unlocked, the pointer moves across screens again")
+	}
+}
+
+// switchScreen moves input to the nth screen of the layout with the cursor
+// in its middle, 0 for ours
+func (c *Controller) switchScreen(ctx context.Context, n int) {
+	d := c.desk
+	if d == nil {
+		log.Printf("[input] Switching screens needs a screen layout")
+		return
+	}
+	s := d.local
+	if n > 0 {
+		if n > len(c.Layout.Screens) {
+			log.Printf("[input] The layout has no screen %d", n)
+			return
+		}
+		name := c.Layout.Screens[n-1].Peer
+		if s = d.screenNamed(name); s == nil {
+			log.Printf("[input] %s is not on the desk", name)
+			return
+		}
+	}
+	if s == d.current {
+		return
+	}
+	r := s.rect
+	c.enter(ctx, s, point{r.X + r.Width/2, r.Y + r.Height/2})
+}
+
+// enter moves input to screen s with the cursor at pt
+func (c *Controller) enter(ctx context.Context, s *deskScreen, pt point) {
+	d := c.desk
+	from := d.current
+	log.Printf("[input] Pointer moved from %s to %s", from.name, s.name)
+	d.current = s
+	d.moveCursor(pt)
+	c.setTarget(ctx, s.peer)
+
+	if s.peer == nil {
+		c.hideBlackScreen()
+		if err := display.MoveCursor(pt.x, pt.y); err != nil {
+			log.Printf("[input] Failed to move the local pointer back: %v", err)
+		}
+		return
+	}
+
+	// Reports from an earlier visit do not tell where the pointer is now
+	s.peer.reported.Store(nil)
+	if from.peer == nil {
+		c.recenter()
+		c.showBlackScreen()
+	}
+	c.sendCursor(ctx)
+}
+
+// recenter parks our pointer in the middle of our screen again
+func (c *Controller) recenter() {
+	d := c.desk
+	center := d.center()
+	if err := display.MoveCursor(center.x, center.y); err != nil {
+		log.Printf("[input] Failed to park the local pointer: %v", err)
+		return
+	}
+	d.last = center
+	d.warpedAt = time.Now()
+}
+
+// sendCursor moves the pointer of the current screen to the cursor
+func (c *Controller) sendCursor(ctx context.Context) {
+	pt := c.desk.onScreen()
+	c.forward(ctx, c.desk.current.peer, model.InputEvent{
+		Type:      model.EventMouseMove,
+		MouseMove: &model.MouseMoveEvent{X: pt.x, Y: pt.y},
+	})
+}
+
+// dropPeer takes a receiver that is gone for good off the desk. If the
+// cursor was on its screen it comes back to ours
+func (c *Controller) dropPeer(p *peerLink) {
+	if c.desk == nil || !c.desk.remove(p) {
+		return
+	}
+	d := c.desk
+	d.current = d.local
+	d.cursor = d.center()
+	c.target.Store(nil)
+	c.held = newInputState()
+	c.hideBlackScreen()
+	if err := display.MoveCursor(d.cursor.x, d.cursor.y); err != nil {
+		log.Printf("[input] Failed to move the local pointer back: %v", err)
+	}
+}
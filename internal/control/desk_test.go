@@ -0,0 +1,195 @@
+package control
+
+import (
+	"copy/internal/layout"
+	"copy/internal/model"
+	"copy/internal/wire"
+	"testing"
+)
+
+func deskPeer(name string, width, height int) *peerLink {
+	return &peerLink{
+		name:    name,
+		session: &wire.Session{Remote: wire.Hello{Screen: model.ScreenGeometry{Width: width, Height: height}}},
+	}
+}
+
+// testDesk is a 1920x1080 screen with a 1280x1024 one to its right and an
+// 800x600 one above it, shifted 100 pixels right
+func testDesk() (*desk, *peerLink) {
+	right := deskPeer("right", 1280, 1024)
+	l := &layout.Layout{Screens: []layout.Placement{
+		{Peer: "right", Of: layout.LocalScreen, Edge: layout.EdgeRight},
+		{Peer: "top", Of: layout.LocalScreen, Edge: layout.EdgeTop, Offset: 100},
+		{Peer: "unsized", Of: layout.LocalScreen, Edge: layout.EdgeLeft},
+	}}
+	peers := []*peerLink{right, deskPeer("top", 800, 600), deskPeer("unsized", 0, 0)}
+	return newDesk(l, model.ScreenGeometry{Width: 1920, Height: 1080}, peers, DefaultDeadCorner), right
+}
+
+func TestDeskLeaveLocal(t *testing.T) {
+	tests := []struct {
+		name   string
+		pt     point
+		locked bool
+		want   string
+		entry  point
+	}{
+		{"middle", point{960, 540}, false, "", point{}},
+		{"right edge", point{1919, 500}, false, "right", point{1921, 500}},
+		{"right edge past the edge", point{1925, 500}, false, "right", point{1921, 500}},
+		{"top edge", point{500, 0}, false, "top", point{500, -2}},
+		{"top edge beside the screen above", point{50, 0}, false, "", point{}},
+		{"right edge below the shorter screen", point{1919, 1030}, false, "", point{}},
+		{"dead corner", point{1919, 10}, false, "", point{}},
+		{"dead corner at the bottom", point{1919, 1045}, false, "", point{}},
+		{"left edge of an unsized screen", point{0, 500}, false, "", point{}},
+		{"bottom edge with nothing below", point{960, 1079}, false, "", point{}},
+		{"locked", point{1919, 500}, true, "", point{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := testDesk()
+			d.locked = tt.locked
+			next, entry := d.leaveLocal(tt.pt)
+			got := ""
+			if next != nil {
+				got = next.name
+			}
+			if got != tt.want || entry != tt.entry {
+				t.Errorf("got %q at %v, want %q at %v", got, entry, tt.want, tt.entry)
+			}
+			if d.cursor != tt.pt {
+				t.Errorf("cursor %v, want %v", d.cursor, tt.pt)
+			}
+		})
+	}
+}
+
+func TestDeskMoveRemote(t *testing.T) {
+	d, right := testDesk()
+	d.current = d.screenNamed("right")
+	d.cursor = point{1921, 500}
+	d.last = point{960, 540}
+
+	// Steps run in order, pt is our pointer and report what the receiver
+	// said before the step, if anything
+	tests := []struct {
+		name   string
+		pt     point
+		report *point
+		next   string
+		moved  bool
+		cursor point
+	}{
+		{"within the screen", point{1060, 540}, nil, "", true, point{2021, 500}},
+		{"no motion", point{1060, 540}, nil, "", false, point{2021, 500}},
+		{"back to the edge", point{960, 540}, nil, "", true, point{1921, 500}},
+		{"pushed against the edge unconfirmed", point{900, 540}, nil, "", true, point{1920, 500}},
+		{"still unconfirmed", point{890, 540}, nil, "", false, point{1920, 500}},
+		{"receiver not at the edge", point{880, 540}, &point{5, 500}, "", false, point{1920, 500}},
+		{"receiver confirms the edge", point{870, 540}, &point{0, 500}, layout.LocalScreen, true, point{1910, 500}},
+	}
+
+	for _, tt := range tests {
+		if tt.report != nil {
+			right.report(*tt.report)
+		}
+		next, moved := d.moveRemote(tt.pt)
+		got := ""
+		if next != nil {
+			got = next.name
+		}
+		if got != tt.next || moved != tt.moved || d.cursor != tt.cursor {
+			t.Fatalf("%s: got %q, moved %v, cursor %v, want %q, %v, %v", tt.name, got, moved, d.cursor, tt.next, tt.moved, tt.cursor)
+		}
+	}
+}
+
+func TestDeskMoveRemoteLocked(t *testing.T) {
+	d, right := testDesk()
+	d.current = d.screenNamed("right")
+	d.cursor = point{1920, 500}
+	d.last = point{960, 540}
+	d.locked = true
+	right.report(point{0, 500})
+
+	if next, _ := d.moveRemote(point{900, 540}); next != nil {
+		t.Errorf("locked cursor crossed to %s", next.name)
+	}
+	if d.cursor != (point{1920, 500}) {
+		t.Errorf("cursor %v left the locked screen", d.cursor)
+	}
+}
+
+func TestDeskScreens(t *testing.T) {
+	d, right := testDesk()
+	if d.screenNamed("unsized") != nil {
+		t.Error("a screen of unknown size is on the desk")
+	}
+	if s := d.screenAt(point{2000, 100}); s == nil || s.name != "right" {
+		t.Errorf("screen at 2000,100 is %+v", s)
+	}
+
+	d.current = d.screenNamed("right")
+	if !d.remove(right) {
+		t.Error("removing the current screen not reported")
+	}
+	if d.screenAt(point{2000, 100}) != nil || d.screenNamed("right") != nil {
+		t.Error("removed screen still on the desk")
+	}
+	if d.remove(right) {
+		t.Error("removed twice")
+	}
+}
+
+func TestReportedAtEdge(t *testing.T) {
+	r := layout.Rect{Width: 1280, Height: 1024}
+	tests := []struct {
+		report point
+		dx, dy int
+		want   bool
+	}{
+		{point{0, 500}, -1, 0, true},
+		{point{1, 500}, -1, 0, true},
+		{point{2, 500}, -1, 0, false},
+		{point{1279, 500}, 1, 0, true},
+		{point{1277, 500}, 1, 0, false},
+		{point{640, 0}, 0, -1, true},
+		{point{640, 1023}, 0, 1, true},
+		{point{640, 900}, 0, 1, false},
+		{point{0, 0}, -1, -1, true},
+		{point{0, 500}, -1, -1, false},
+	}
+	for _, tt := range tests {
+		p := deskPeer("peer", r.Width, r.Height)
+		if p.reportedAtEdge(r, tt.dx, tt.dy) {
+			t.Fatal("edge confirmed without a report")
+		}
+		p.report(tt.report)
+		if got := p.reportedAtEdge(r, tt.dx, tt.dy); got != tt.want {
+			t.Errorf("report %v towards %d,%d: got %v, want %v", tt.report, tt.dx, tt.dy, got, tt.want)
+		}
+	}
+}
+
+func TestClampTo(t *testing.T) {
+	r := layout.Rect{X: 100, Y: 50, Width: 200, Height: 100}
+	tests := []struct {
+		pt    point
+		inset int
+		want  point
+	}{
+		{point{150, 100}, 0, point{150, 100}},
+		{point{0, 0}, 0, point{100, 50}},
+		{point{500, 500}, 0, point{299, 149}},
+		{point{500, 500}, 1, point{298, 148}},
+		{point{99, 100}, 1, point{101, 100}},
+	}
+	for _, tt := range tests {
+		if got := clampTo(r, tt.pt, tt.inset); got != tt.want {
+			t.Errorf("clampTo(%v, %d) = %v, want %v", tt.pt, tt.inset, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package control
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+)
+
+// Floor policies for controllers arriving while another one holds input
+const (
+	FloorQueue  = "queue"  // Wait in line for the floor
+	FloorReject = "reject" // Turn the newcomer away
+)
+
+// FloorState is what a claim is told when its position changes
+type FloorState string
+
+const (
+	FloorGranted FloorState = "granted"
+	FloorQueued  FloorState = "queued"
+	FloorRevoked FloorState = "revoked"
+)
+
+// FloorNotify is called when a claim is granted, queued or loses the floor.
+// holder names the controller holding the floor afterwards. It must not
+// call back into the Floor
+type FloorNotify func(state FloorState, holder string)
+
+// BusyError is returned by Floor.Request when the floor is taken and the
+// policy rejects newcomers
+type BusyError struct {
+	Holder string
+}
+
+func (e *BusyError) Error() string {
+	return fmt.Sprintf("busy, controlled by %s", e.Holder)
+}
+
+type floorClaim struct {
+	id     uint64
+	peer   string
+	name   string
+	notify FloorNotify
+}
+
+type floorNotice struct {
+	claim *floorClaim
+	state FloorState
+}
+
+// Floor arbitrates between controllers connected to this receiver so only
+// one of them drives local input at a time
+type Floor struct {
+	policy       string
+	priorityPeer string
+	onChange     func()
+
+	mu     sync.Mutex
+	holder *floorClaim
+	queue  []*floorClaim
+
+	// notifyMu keeps notifications in the order the changes happened
+	notifyMu sync.Mutex
+}
+
+// NewFloor creates an arbiter. priorityPeer, if set, is the peer ID that
+// preempts whoever holds the floor. onChange, if set, is called after every
+// change of holder or queue
+func NewFloor(policy, priorityPeer string, onChange func()) (*Floor, error) {
+	switch policy {
+	case FloorQueue, FloorReject:
+	default:
+		return nil, fmt.Errorf("unknown floor policy %q", policy)
+	}
+	return &Floor{
+		policy:       policy,
+		priorityPeer: priorityPeer,
+		onChange:     onChange,
+	}, nil
+}
+
+// Request asks for the floor on behalf of session id, run by peer and shown
+// as name. notify learns the outcome, a *BusyError is returned instead when
+// the request is rejected
+func (f *Floor) Request(id uint64, peer, name string, notify FloorNotify) error {
+	claim := &floorClaim{id: id, peer: peer, name: name, notify: notify}
+
+	f.mu.Lock()
+	var notices []floorNotice
+	switch {
+	case f.holder == nil:
+		f.holder = claim
+		notices = append(notices, floorNotice{claim, FloorGranted})
+
+	case f.holder.peer == peer:
+		// The same peer reconnected before its old session timed out,
+		// the new session takes over
+		log.Printf("[floor] %s replaces its previous session", name)
+		notices = append(notices, floorNotice{f.holder, FloorRevoked}, floorNotice{claim, FloorGranted})
+		f.holder = claim
+
+	case peer != "" && peer == f.priorityPeer:
+		log.Printf("[floor] Priority peer %s preempts %s", name, f.holder.name)
+		revoked := f.holder
+		f.queue = append([]*floorClaim{revoked}, f.queue...)
+		f.holder = claim
+		notices = append(notices, floorNotice{revoked, FloorRevoked}, floorNotice{claim, FloorGranted})
+
+	case f.policy == FloorReject:
+		holder := f.holder.name
+		f.mu.Unlock()
+		return &BusyError{Holder: holder}
+
+	default:
+		f.queue = append(f.queue, claim)
+		notices = append(notices, floorNotice{claim, FloorQueued})
+	}
+	f.unlockAndDeliver(notices)
+	return nil
+}
+
+// Release gives up the floor or the place in the queue of session id. The
+// next queued controller, if any, gets the floor
+func (f *Floor) Release(id uint64) {
+	f.mu.Lock()
+	var notices []floorNotice
+	if f.holder != nil && f.holder.id == id {
+		f.holder = nil
+		if len(f.queue) > 0 {
+			f.holder, f.queue = f.queue[0], f.queue[1:]
+			notices = append(notices, floorNotice{f.holder, FloorGranted})
+		}
+	} else {
+		f.queue = slices.DeleteFunc(f.queue, func(c *floorClaim) bool {
+			return c.id == id
+		})
+	}
+	f.unlockAndDeliver(notices)
+}
+
+// HandOver gives the floor to the queued session id, the current holder
+// moves to the front of the queue
+func (f *Floor) HandOver(id uint64) error {
+	f.mu.Lock()
+	i := slices.IndexFunc(f.queue, func(c *floorClaim) bool {
+		return c.id == id
+	})
+	if i < 0 {
+		f.mu.Unlock()
+		return fmt.Errorf("session %d is not waiting for the floor", id)
+	}
+
+	claim := f.queue[i]
+	f.queue = slices.Delete(f.queue, i, i+1)
+	var notices []floorNotice
+	if f.holder != nil {
+		f.queue = append([]*floorClaim{f.holder}, f.queue...)
+		notices = append(notices, floorNotice{f.holder, FloorRevoked})
+	}
+	f.holder = claim
+	notices = append(notices, floorNotice{claim, FloorGranted})
+
+	log.Printf("[floor] Handed over to %s", claim.name)
+	f.unlockAndDeliver(notices)
+	return nil
+}
+
+// Holder returns the session holding the floor, 0 when it is free
+func (f *Floor) Holder() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.holder == nil {
+		return 0
+	}
+	return f.holder.id
+}
+
+// unlockAndDeliver releases f.mu and runs the notifications. They write to
+// the network so they must not run under the lock, but they still go out
+// in order
+func (f *Floor) unlockAndDeliver(notices []floorNotice) {
+	holder := ""
+	if f.holder != nil {
+		holder = f.holder.name
+	}
+	f.notifyMu.Lock()
+	defer f.notifyMu.Unlock()
+	f.mu.Unlock()
+
+	for _, n := range notices {
+		n.claim.notify(n.state, holder)
+	}
+	if f.onChange != nil {
+		f.onChange()
+	}
+}
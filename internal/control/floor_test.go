@@ -0,0 +1,173 @@
+package control
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// floorStep is one call against a Floor. op is "request", "release" or
+// "handover", peer defaults to a peer of its own per session
+type floorStep struct {
+	op      string
+	id      uint64
+	peer    string
+	notices []string // "<id> <state> <holder>" in delivery order
+	holder  uint64
+	busy    bool
+}
+
+func TestFloor(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		steps  []floorStep
+	}{
+		{"queue and release", FloorQueue, []floorStep{
+			{op: "request", id: 1, notices: []string{"1 granted c1"}, holder: 1},
+			{op: "request", id: 2, notices: []string{"2 queued c1"}, holder: 1},
+			{op: "request", id: 3, notices: []string{"3 queued c1"}, holder: 1},
+			{op: "release", id: 1, notices: []string{"2 granted c2"}, holder: 2},
+			{op: "release", id: 2, notices: []string{"3 granted c3"}, holder: 3},
+			{op: "release", id: 3, holder: 0},
+		}},
+		{"leaving the queue", FloorQueue, []floorStep{
+			{op: "request", id: 1, notices: []string{"1 granted c1"}, holder: 1},
+			{op: "request", id: 2, notices: []string{"2 queued c1"}, holder: 1},
+			{op: "request", id: 3, notices: []string{"3 queued c1"}, holder: 1},
+			{op: "release", id: 2, holder: 1},
+			{op: "release", id: 1, notices: []string{"3 granted c3"}, holder: 3},
+		}},
+		{"reject", FloorReject, []floorStep{
+			{op: "request", id: 1, notices: []string{"1 granted c1"}, holder: 1},
+			{op: "request", id: 2, busy: true, holder: 1},
+			{op: "release", id: 2, holder: 1},
+			{op: "release", id: 1, holder: 0},
+			{op: "request", id: 2, notices: []string{"2 granted c2"}, holder: 2},
+		}},
+		{"same peer reconnects", FloorReject, []floorStep{
+			{op: "request", id: 1, peer: "desk", notices: []string{"1 granted c1"}, holder: 1},
+			{op: "request", id: 2, peer: "desk", notices: []string{"1 revoked c2", "2 granted c2"}, holder: 2},
+			{op: "release", id: 1, holder: 2}, // The old session ending late changes nothing
+		}},
+		{"priority peer preempts", FloorReject, []floorStep{
+			{op: "request", id: 1, notices: []string{"1 granted c1"}, holder: 1},
+			{op: "request", id: 2, peer: "boss", notices: []string{"1 revoked c2", "2 granted c2"}, holder: 2},
+			{op: "release", id: 2, notices: []string{"1 granted c1"}, holder: 1},
+		}},
+		{"hand over", FloorQueue, []floorStep{
+			{op: "request", id: 1, notices: []string{"1 granted c1"}, holder: 1},
+			{op: "request", id: 2, notices: []string{"2 queued c1"}, holder: 1},
+			{op: "request", id: 3, notices: []string{"3 queued c1"}, holder: 1},
+			{op: "handover", id: 3, notices: []string{"1 revoked c3", "3 granted c3"}, holder: 3},
+			{op: "release", id: 3, notices: []string{"1 granted c1"}, holder: 1},
+			{op: "handover", id: 3, busy: true, holder: 1},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := 0
+			f, err := NewFloor(tt.policy, "boss", func() { changes++ })
+			if err != nil {
+				t.Fatal(err)
+			}
+			var notices []string
+			notify := func(id uint64) FloorNotify {
+				return func(state FloorState, holder string) {
+					notices = append(notices, fmt.Sprintf("%d %s %s", id, state, holder))
+				}
+			}
+
+			for i, step := range tt.steps {
+				notices = nil
+				peer := step.peer
+				if peer == "" {
+					peer = fmt.Sprintf("peer%d", step.id)
+				}
+				var err error
+				switch step.op {
+				case "request":
+					err = f.Request(step.id, peer, fmt.Sprintf("c%d", step.id), notify(step.id))
+				case "release":
+					f.Release(step.id)
+				case "handover":
+					err = f.HandOver(step.id)
+				}
+				if (err != nil) != step.busy {
+					t.Fatalf("step %d %s %d: unexpected error %v", i, step.op, step.id, err)
+				}
+				if !slices.Equal(notices, step.notices) {
+					t.Errorf("step %d %s %d: notices %q, want %q", i, step.op, step.id, notices, step.notices)
+				}
+				if got := f.Holder(); got != step.holder {
+					t.Errorf("step %d %s %d: holder %d, want %d", i, step.op, step.id, got, step.holder)
+				}
+			}
+			if changes == 0 {
+				t.Error("onChange never called")
+			}
+		})
+	}
+}
+
+func TestFloorBusyError(t *testing.T) {
+	f, err := NewFloor(FloorReject, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Request(1, "a", "desk", func(FloorState, string) {})
+	err = f.Request(2, "b", "laptop", func(FloorState, string) {})
+	var busy *BusyError
+	if !errors.As(err, &busy) || busy.Holder != "desk" {
+		t.Fatalf("got %v, want BusyError held by desk", err)
+	}
+}
+
+func TestFloorPolicy(t *testing.T) {
+	if _, err := NewFloor("first-come", "", nil); err == nil {
+		t.Error("unknown policy accepted")
+	}
+}
+
+func TestFloorConcurrent(t *testing.T) {
+	f, err := NewFloor(FloorQueue, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every session ends, so the floor must be free and each one granted
+	// exactly once
+	const sessions = 32
+	var mu sync.Mutex
+	granted := make(map[uint64]int)
+	var wg sync.WaitGroup
+	for id := uint64(1); id <= sessions; id++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.Request(id, fmt.Sprint(id), fmt.Sprint(id), func(state FloorState, _ string) {
+				if state == FloorGranted {
+					mu.Lock()
+					granted[id]++
+					mu.Unlock()
+				}
+			})
+		}()
+	}
+	wg.Wait()
+	for range sessions {
+		f.Release(f.Holder())
+	}
+
+	if h := f.Holder(); h != 0 {
+		t.Errorf("session %d still holds the floor", h)
+	}
+	for id := uint64(1); id <= sessions; id++ {
+		if granted[id] != 1 {
+			t.Errorf("session %d granted %d times", id, granted[id])
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package control
+
+import (
+	"context"
+	"copy/internal/clipboard"
+	"copy/internal/hotkey"
+	"copy/internal/model"
+	"log"
+)
+
+// runHotkey performs action, hotkey.ActionRelease ends the session with
+// ErrReleased
+func (c *Controller) runHotkey(ctx context.Context, action string) error {
+	log.Printf("[input] Hotkey pressed: %s", action)
+	switch action {
+	case hotkey.ActionRelease:
+		return ErrReleased
+	case hotkey.ActionRelative:
+		c.setRelative(c.relative == nil)
+	case hotkey.ActionLock:
+		c.toggleLock()
+	case hotkey.ActionLocal:
+		c.switchScreen(ctx, 0)
+	case hotkey.ActionCtrlAltDel:
+		c.sendCtrlAltDel(ctx)
+	case hotkey.ActionPaste:
+		c.paste(ctx)
+	default:
+		if n, ok := hotkey.PeerNumber(action); ok {
+			c.switchScreen(ctx, n)
+		}
+	}
+	return nil
+}
+
+// sendCtrlAltDel asks the receiver input goes to for Ctrl+Alt+Del. It is
+// a dedicated event rather than keys, Windows receivers must raise it
+// through SendSAS. Receivers without the capability drop it
+func (c *Controller) sendCtrlAltDel(ctx context.Context) {
+	p := c.target.Load()
+	if p == nil {
+		log.Printf("[input] Input is on this screen, not sending Ctrl+Alt+Del")
+		return
+	}
+	p.send(ctx, model.InputEvent{Type: model.EventSecureAttention})
+}
+
+// paste types our clipboard on the receiver input goes to, in the
+// background as long text takes a while
+func (c *Controller) paste(ctx context.Context) {
+	go func() {
+		text, err := clipboard.Text()
+		if err != nil {
+			log.Printf("[input] Cannot paste: %v", err)
+			return
+		}
+		if text == "" {
+			return
+		}
+		if err := c.Type(ctx, text); err != nil {
+			log.Printf("[input] Cannot paste: %v", err)
+		}
+	}()
+}
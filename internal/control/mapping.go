@@ -0,0 +1,91 @@
+package control
+
+import (
+	"copy/internal/model"
+	"copy/internal/wire"
+	"fmt"
+)
+
+// Pointer mapping modes, how positions on our screen land on a receiver's
+// screen of another size
+const (
+	// MapStretch scales each axis on its own, our whole screen covers the
+	// receiver's
+	MapStretch = "stretch"
+	// MapClamp keeps pixels 1:1, positions beyond the receiver's screen stop
+	// at its edge
+	MapClamp = "clamp"
+	// MapLetterbox scales both axes alike, our screen fits centered on the
+	// receiver's with its aspect ratio kept
+	MapLetterbox = "letterbox"
+)
+
+// ValidateMapping checks a pointer mapping mode
+func ValidateMapping(mode string) error {
+	switch mode {
+	case MapStretch, MapClamp, MapLetterbox:
+		return nil
+	default:
+		return fmt.Errorf("unknown pointer mapping %q, want stretch, clamp or letterbox", mode)
+	}
+}
+
+// pointerMap maps pointer positions on our screen onto a receiver's
+type pointerMap struct {
+	mode  string
+	local model.ScreenGeometry
+}
+
+// apply maps x, y for the receiver of session, reporting whether the result
+// is normalized. Stretching is left to receivers that take normalized
+// positions, they know their current screen best
+func (m *pointerMap) apply(session *wire.Session, x, y int) (int, int, bool) {
+	local, remote := m.local, session.Remote.Screen
+	x, y = max(0, min(x, local.Width-1)), max(0, min(y, local.Height-1))
+
+	if m.mode == MapStretch && session.Supports(model.CapNormalizedPointer) {
+		x, y = model.Normalize(x, y, local)
+		return x, y, true
+	}
+	if !remote.Known() {
+		// Nothing to map onto, the receiver gets our pixels
+		return x, y, false
+	}
+
+	switch m.mode {
+	case MapClamp:
+		x, y = min(x, remote.Width-1), min(y, remote.Height-1)
+	case MapLetterbox:
+		if remote.Width*local.Height <= remote.Height*local.Width {
+			// Width bound, bars above and below
+			bar := (remote.Height - local.Height*remote.Width/local.Width) / 2
+			x, y = x*remote.Width/local.Width, bar+y*remote.Width/local.Width
+		} else {
+			// Height bound, bars left and right
+			bar := (remote.Width - local.Width*remote.Height/local.Height) / 2
+			x, y = bar+x*remote.Height/local.Height, y*remote.Height/local.Height
+		}
+	default:
+		x, y = x*remote.Width/local.Width, y*remote.Height/local.Height
+	}
+	return x, y, false
+}
+
+// mapPointer moves the pointer position of event from our screen onto the
+// receiver's, events without one pass unchanged
+func (p *peerLink) mapPointer(event model.InputEvent) model.InputEvent {
+	if p.mapping == nil {
+		return event
+	}
+	switch event.Type {
+	case model.EventMouseMove:
+		mv := *event.MouseMove
+		mv.X, mv.Y, mv.Normalized = p.mapping.apply(p.session, mv.X, mv.Y)
+		event.MouseMove = &mv
+	case model.EventMouseClick:
+		cl := *event.MouseClick
+		cl.X, cl.Y, cl.Normalized = p.mapping.apply(p.session, cl.X, cl.Y)
+		event.MouseClick = &cl
+	}
+	return event
+}
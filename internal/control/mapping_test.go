@@ -0,0 +1,103 @@
+package control
+
+import (
+	"copy/internal/model"
+	"copy/internal/wire"
+	"reflect"
+	"testing"
+)
+
+func TestValidateMapping(t *testing.T) {
+	for mode, valid := range map[string]bool{
+		MapStretch:   true,
+		MapClamp:     true,
+		MapLetterbox: true,
+		"":           false,
+		"Stretch":    false,
+		"zoom":       false,
+	} {
+		if err := ValidateMapping(mode); (err == nil) != valid {
+			t.Errorf("ValidateMapping(%q) = %v, want valid %v", mode, err, valid)
+		}
+	}
+}
+
+// mappedSession is a receiver with the given screen, taking normalized
+// positions if normalized is set
+func mappedSession(width, height int, normalized bool) *wire.Session {
+	s := &wire.Session{Remote: wire.Hello{Screen: model.ScreenGeometry{Width: width, Height: height}}}
+	if normalized {
+		s.Capabilities = []string{model.CapNormalizedPointer}
+	}
+	return s
+}
+
+func TestPointerMapApply(t *testing.T) {
+	local := model.ScreenGeometry{Width: 1920, Height: 1080}
+	tests := []struct {
+		name       string
+		mode       string
+		session    *wire.Session
+		x, y       int
+		wx, wy     int
+		normalized bool
+	}{
+		{"stretch normalized", MapStretch, mappedSession(1280, 1024, true), 1919, 1079, model.NormalizedMax, model.NormalizedMax, true},
+		{"stretch normalized origin", MapStretch, mappedSession(1280, 1024, true), 0, 0, 0, 0, true},
+		{"stretch in pixels", MapStretch, mappedSession(1280, 1024, false), 960, 540, 640, 512, false},
+		{"stretch onto an unknown screen", MapStretch, mappedSession(0, 0, false), 960, 540, 960, 540, false},
+		{"off our screen", MapStretch, mappedSession(0, 0, false), -10, 2000, 0, 1079, false},
+		{"clamp within", MapClamp, mappedSession(1280, 1024, false), 100, 500, 100, 500, false},
+		{"clamp beyond", MapClamp, mappedSession(1280, 1024, false), 1500, 1050, 1279, 1023, false},
+		{"clamp ignores normalized", MapClamp, mappedSession(1280, 1024, true), 1500, 500, 1279, 500, false},
+		{"letterbox width bound origin", MapLetterbox, mappedSession(1280, 1024, false), 0, 0, 0, 152, false},
+		{"letterbox width bound corner", MapLetterbox, mappedSession(1280, 1024, false), 1919, 1079, 1279, 871, false},
+		{"letterbox height bound origin", MapLetterbox, mappedSession(2560, 1080, false), 0, 0, 320, 0, false},
+		{"letterbox height bound corner", MapLetterbox, mappedSession(2560, 1080, false), 1919, 1079, 2239, 1079, false},
+		{"letterbox same aspect", MapLetterbox, mappedSession(3840, 2160, false), 960, 540, 1920, 1080, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &pointerMap{mode: tt.mode, local: local}
+			x, y, normalized := m.apply(tt.session, tt.x, tt.y)
+			if x != tt.wx || y != tt.wy || normalized != tt.normalized {
+				t.Errorf("got %d, %d, %v, want %d, %d, %v", x, y, normalized, tt.wx, tt.wy, tt.normalized)
+			}
+		})
+	}
+}
+
+func TestMapPointer(t *testing.T) {
+	move := model.InputEvent{Type: model.EventMouseMove, MouseMove: &model.MouseMoveEvent{X: 960, Y: 540}}
+	click := model.InputEvent{Type: model.EventMouseClick, MouseClick: &model.MouseClickEvent{Button: "left", Action: "press", X: 1919, Y: 0}}
+	key := model.InputEvent{Type: model.EventKeyboard, Keyboard: &model.KeyboardEvent{Key: "a", Action: "press"}}
+
+	// Without a mapping events pass as they are
+	p := &peerLink{session: mappedSession(1280, 1024, false)}
+	for _, event := range []model.InputEvent{move, click, key} {
+		if got := p.mapPointer(event); !reflect.DeepEqual(got, event) {
+			t.Errorf("unmapped %s changed to %+v", event.Type, got)
+		}
+	}
+
+	p.mapping = &pointerMap{mode: MapStretch, local: model.ScreenGeometry{Width: 1920, Height: 1080}}
+	if got := p.mapPointer(move).MouseMove; *got != (model.MouseMoveEvent{X: 640, Y: 512}) {
+		t.Errorf("move mapped to %+v", got)
+	}
+	if got := p.mapPointer(click).MouseClick; got.X != 1279 || got.Y != 0 || got.Button != "left" {
+		t.Errorf("click mapped to %+v", got)
+	}
+	if got := p.mapPointer(key); !reflect.DeepEqual(got, key) {
+		t.Errorf("keyboard event changed to %+v", got)
+	}
+	// The caller's event is left alone
+	if move.MouseMove.X != 960 || click.MouseClick.X != 1919 {
+		t.Error("mapping changed the original event")
+	}
+
+	p.session = mappedSession(1280, 1024, true)
+	if got := p.mapPointer(move).MouseMove; !got.Normalized {
+		t.Errorf("move to a normalizing receiver mapped to %+v", got)
+	}
+}
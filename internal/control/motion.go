@@ -0,0 +1,91 @@
+package control
+
+import (
+	"copy/internal/model"
+	"copy/internal/wire"
+	"log"
+	"net"
+	"time"
+)
+
+const (
+	motionProbeInterval = 200 * time.Millisecond
+	// motionProbeTimeout is how long the UDP path gets to prove itself
+	// before motion stays on the reliable connection
+	motionProbeTimeout = 3 * time.Second
+)
+
+// startMotion sets up the UDP path offered by the receiver on client and
+// probes it until the receiver confirms or the probe times out
+func (p *peerLink) startMotion(client *wire.Client, offer *wire.UDPOffer) {
+	addr, ok := client.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return
+	}
+	motion, err := wire.DialMotion(addr.IP.String(), offer)
+	if err != nil {
+		log.Printf("[input] UDP motion unavailable: %v", err)
+		return
+	}
+	if old := p.motion.Swap(motion); old != nil {
+		old.Close()
+	}
+
+	go func() {
+		ticker := time.NewTicker(motionProbeInterval)
+		defer ticker.Stop()
+		timeout := time.After(motionProbeTimeout)
+
+		for !motion.Ready() {
+			if err := motion.Probe(); err != nil {
+				log.Printf("[input] UDP motion probe failed: %v", err)
+				p.dropMotion(motion)
+				return
+			}
+			select {
+			case <-ticker.C:
+			case <-timeout:
+				log.Printf("[input] UDP motion path blocked, pointer motion stays on TCP")
+				p.dropMotion(motion)
+				return
+			}
+		}
+	}()
+}
+
+// motionReady marks the UDP path confirmed by the receiver
+func (p *peerLink) motionReady() {
+	if motion := p.motion.Load(); motion != nil {
+		motion.SetReady()
+		log.Printf("[input] Pointer motion switched to UDP")
+	}
+}
+
+// sendMotion sends event over the UDP path when it is up, reporting false
+// when the caller should use the reliable connection instead
+func (p *peerLink) sendMotion(event *model.InputEvent) bool {
+	motion := p.motion.Load()
+	if motion == nil || !motion.Ready() || !wire.MotionEvent(event.Type) {
+		return false
+	}
+	if err := motion.Send(event); err != nil {
+		log.Printf("[input] UDP motion failed, falling back to TCP: %v", err)
+		p.dropMotion(motion)
+		return false
+	}
+	p.client.Recorder().Record(wire.DirOut, &wire.Message{Type: wire.MsgInputEvent, Event: event})
+	return true
+}
+
+// dropMotion closes motion if it is still the current UDP path
+func (p *peerLink) dropMotion(motion *wire.MotionSender) {
+	if p.motion.CompareAndSwap(motion, nil) {
+		motion.Close()
+	}
+}
+
+func (p *peerLink) stopMotion() {
+	if motion := p.motion.Swap(nil); motion != nil {
+		motion.Close()
+	}
+}
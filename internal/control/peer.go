@@ -0,0 +1,336 @@
+package control
+
+import (
+	"context"
+	"copy/internal/model"
+	"copy/internal/wire"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// peerQueue bounds the events waiting to be sent to one receiver
+const peerQueue = 100
+
+// Peer is a receiver for NewController to drive, over a connection whose
+// hello exchange produced Session. With a nil Reconnect its session ends on
+// the first connection error
+type Peer struct {
+	// Name identifies the peer's screen in the controller's layout
+	Name      string
+	Client    *wire.Client
+	Session   *wire.Session
+	Reconnect *Reconnect
+}
+
+// peerLink drives one receiver for a Controller: it sends the events
+// routed to it, reads what the receiver sends back and reconnects when
+// the connection is lost
+type peerLink struct {
+	name      string
+	client    *wire.Client
+	session   *wire.Session
+	reconnect *Reconnect
+	state     *inputState
+
+	events chan model.InputEvent
+	typeCh chan typeRequest
+	done   chan struct{}
+
+	// motion is the UDP path for pointer motion, nil while motion goes over
+	// the connection
+	motion atomic.Pointer[wire.MotionSender]
+	// reported is where the receiver last said its pointer is
+	reported atomic.Pointer[pointerReport]
+	// mapping maps our pointer onto the receiver's screen, nil when events
+	// carry its pixels already
+	mapping *pointerMap
+
+	// status reports the session state, holding tells which state the
+	// session is in while the receiver gives us input
+	status  func(status string)
+	holding func() string
+}
+
+func newPeerLink(p Peer) *peerLink {
+	return &peerLink{
+		name:      p.Name,
+		client:    p.Client,
+		session:   p.Session,
+		reconnect: p.Reconnect,
+		state:     newInputState(),
+		events:    make(chan model.InputEvent, peerQueue),
+		typeCh:    make(chan typeRequest),
+		done:      make(chan struct{}),
+	}
+}
+
+// run sends the events queued for the receiver until the connection is
+// lost for good, the receiver leaves or ctx is done
+func (p *peerLink) run(ctx context.Context) error {
+	defer close(p.done)
+
+	// Cancelling also stops a pending redial when we return
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if err := p.startSession(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		p.stopMotion()
+		p.client.Close()
+	}()
+
+	// Read what the receiver sends back, this also answers heartbeats and
+	// notices when the receiver goes away
+	readErrCh := make(chan error, 1)
+	go p.readLoop(ctx, p.client, readErrCh)
+
+	online := true
+	var redialCh <-chan redialResult
+
+	// connectionLost either starts reconnecting or reports why we cannot
+	connectionLost := func(err error) error {
+		log.Printf("[input] Connection to %s lost: %v", p.name, err)
+		if p.reconnect == nil {
+			return fmt.Errorf("connection lost: %w", err)
+		}
+		p.stopMotion()
+		p.client.Close()
+		online = false
+		p.status(StatusReconnecting)
+		redialCh = p.reconnect.redial(ctx)
+		return nil
+	}
+
+	for {
+		select {
+		case event := <-p.events:
+			// Skip events the receiver cannot perform
+			event, ok := p.filterEvent(p.mapPointer(event))
+			if !ok {
+				continue
+			}
+
+			p.state.track(event)
+			if !online {
+				p.state.queueOffline(event)
+				continue
+			}
+
+			// Send event to remote peer
+			if err := p.sendEvent(ctx, event); err != nil {
+				log.Printf("[input] Failed to send input event: %v", err)
+				if err := connectionLost(err); err != nil {
+					return err
+				}
+			}
+
+		case err := <-readErrCh:
+			if !online {
+				// Already reconnecting, this is the old connection dying
+				continue
+			}
+			if errors.Is(err, ErrPeerLeft) {
+				return err
+			}
+			if err := connectionLost(err); err != nil {
+				return err
+			}
+
+		case res := <-redialCh:
+			redialCh = nil
+			if res.err != nil {
+				return fmt.Errorf("connection lost: %w", res.err)
+			}
+
+			p.client, p.session = res.client, res.session
+			readErrCh = make(chan error, 1)
+			go p.readLoop(ctx, p.client, readErrCh)
+
+			if err := p.resume(ctx); err != nil {
+				if err := connectionLost(err); err != nil {
+					return err
+				}
+				continue
+			}
+			online = true
+			p.status(p.holding())
+			log.Printf("[input] Session with %s resumed", p.name)
+
+		case req := <-p.typeCh:
+			req.result <- p.typeText(ctx, req.text, online)
+
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// startSession announces the control session on the current connection
+func (p *peerLink) startSession(ctx context.Context) error {
+	// Send initial control message to establish session
+	if err := p.client.Send(ctx, wire.MsgControlStart, &wire.ControlStart{}); err != nil {
+		return fmt.Errorf("failed to send control start message: %w", err)
+	}
+	log.Printf("[input] Control session with %s established", p.name)
+	return nil
+}
+
+// resume restarts the control session on a new connection and replays the
+// state captured while we were offline
+func (p *peerLink) resume(ctx context.Context) error {
+	if err := p.startSession(ctx); err != nil {
+		return err
+	}
+
+	for _, event := range p.state.resumeEvents() {
+		event, ok := p.filterEvent(event)
+		if !ok {
+			continue
+		}
+		if err := p.sendEvent(ctx, event); err != nil {
+			return fmt.Errorf("failed to resync input state: %w", err)
+		}
+	}
+	return nil
+}
+
+func (p *peerLink) sendEvent(ctx context.Context, event model.InputEvent) error {
+	if p.sendMotion(&event) {
+		return nil
+	}
+	if err := p.client.Send(ctx, wire.MsgInputEvent, &event); err != nil {
+		return fmt.Errorf("failed to send input event: %w", err)
+	}
+	log.Printf("[input] Sent input event: %s", event.Type)
+	return nil
+}
+
+// send queues event for the receiver, it is dropped once the link is done
+func (p *peerLink) send(ctx context.Context, event model.InputEvent) {
+	select {
+	case p.events <- event:
+	case <-p.done:
+	case <-ctx.Done():
+	}
+}
+
+// typeText sends text in events of at most maxTextChunk bytes, split on
+// rune boundaries
+func (p *peerLink) typeText(ctx context.Context, text string, online bool) error {
+	if !p.session.Supports(model.CapTextInjection) {
+		return errors.New("receiver cannot inject text")
+	}
+	if !online {
+		return errors.New("receiver is offline")
+	}
+
+	// The modifiers of the paste chord are still down on the receiver,
+	// typed under them every character would be a shortcut. They are let
+	// go for the text and pressed again after it
+	mods := p.state.heldModifiers()
+	if err := p.sendKeys(ctx, mods, "release"); err != nil {
+		return err
+	}
+	for len(text) > 0 {
+		n := len(text)
+		if n > maxTextChunk {
+			n = maxTextChunk
+			for n > 0 && !utf8.RuneStart(text[n]) {
+				n--
+			}
+		}
+		event := model.InputEvent{Type: model.EventText, Text: &model.TextEvent{Text: text[:n]}}
+		if err := p.sendEvent(ctx, event); err != nil {
+			return err
+		}
+		text = text[n:]
+	}
+	return p.sendKeys(ctx, mods, "press")
+}
+
+// sendKeys sends keys with action
+func (p *peerLink) sendKeys(ctx context.Context, keys []model.KeyboardEvent, action string) error {
+	for _, key := range keys {
+		key.Action = action
+		if err := p.sendEvent(ctx, model.InputEvent{Type: model.EventKeyboard, Keyboard: &key}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readLoop consumes messages from the receiver until client fails or ctx
+// is done
+func (p *peerLink) readLoop(ctx context.Context, client *wire.Client, errCh chan<- error) {
+	router := wire.NewRouter()
+	wire.Register(router, wire.MsgControlAck, func(context.Context, *wire.Conn, *wire.ControlAck) error {
+		log.Printf("[input] %s acknowledged control session", p.name)
+		return nil
+	})
+	wire.Register(router, wire.MsgFloor, func(_ context.Context, _ *wire.Conn, floor *wire.Floor) error {
+		if FloorState(floor.State) == FloorGranted {
+			log.Printf("[input] Holding input on %s", p.name)
+			p.status(p.holding())
+		} else {
+			log.Printf("[input] Waiting for %s, %s has control", p.name, floor.Holder)
+			p.status(StatusQueued)
+		}
+		return nil
+	})
+	wire.Register(router, wire.MsgPointer, func(_ context.Context, _ *wire.Conn, pointer *wire.Pointer) error {
+		p.report(point{pointer.X, pointer.Y})
+		return nil
+	})
+	wire.Register(router, wire.MsgBye, func(_ context.Context, _ *wire.Conn, bye *wire.Bye) error {
+		return fmt.Errorf("%w: %s", ErrPeerLeft, bye.Reason)
+	})
+	wire.Register(router, wire.MsgUDPOffer, func(_ context.Context, _ *wire.Conn, offer *wire.UDPOffer) error {
+		p.startMotion(client, offer)
+		return nil
+	})
+	wire.Register(router, wire.MsgUDPReady, func(context.Context, *wire.Conn, *wire.UDPReady) error {
+		p.motionReady()
+		return nil
+	})
+	errCh <- router.Serve(ctx, client.Conn)
+}
+
+// filterEvent adapts event to the negotiated capabilities, reporting false
+// when nothing of it can be sent
+func (p *peerLink) filterEvent(event model.InputEvent) (model.InputEvent, bool) {
+	switch event.Type {
+	case model.EventKeyboard:
+		return event, p.session.Supports(model.CapKeyboard)
+	case model.EventMouseMove:
+		return event, p.session.Supports(model.CapMouseMove)
+	case model.EventMouseClick:
+		return event, p.session.Supports(model.CapMouseClick)
+	case model.EventMouseScroll:
+		// Drop only the axes the receiver cannot scroll
+		scrollEvent := *event.MouseScroll
+		if !p.session.Supports(model.CapScrollVertical) {
+			scrollEvent.DeltaY = 0
+		}
+		if !p.session.Supports(model.CapScrollHorizontal) {
+			scrollEvent.DeltaX = 0
+		}
+		if scrollEvent.DeltaX == 0 && scrollEvent.DeltaY == 0 {
+			return event, false
+		}
+		event.MouseScroll = &scrollEvent
+		return event, true
+	case model.EventText:
+		return event, p.session.Supports(model.CapTextInjection)
+	case model.EventMouseRelative:
+		return event, p.session.Supports(model.CapMouseRelative)
+	case model.EventSecureAttention:
+		return event, p.session.Supports(model.CapSecureAttention)
+	default:
+		return event, true
+	}
+}
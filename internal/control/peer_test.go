@@ -0,0 +1,62 @@
+package control
+
+import (
+	"context"
+	"copy/internal/model"
+	"copy/internal/wire"
+	"fmt"
+	"net"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestTypeTextReleasesModifiers(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	p := newPeerLink(Peer{
+		Name:    "peer",
+		Client:  &wire.Client{Conn: wire.NewConn(a)},
+		Session: &wire.Session{Capabilities: []string{model.CapTextInjection}},
+	})
+	defer p.client.Close()
+
+	// The paste chord is still held, its key already swallowed
+	p.state.track(key("Control_L", "press"))
+	p.state.track(key("Alt_L", "press"))
+	p.state.track(key("a", "press"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() { errCh <- p.typeText(ctx, "hi", true) }()
+
+	receiver := wire.NewConn(b)
+	var got []string
+	for len(got) < 5 {
+		msg, err := receiver.Read(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch event := msg.Event; event.Type {
+		case model.EventKeyboard:
+			got = append(got, fmt.Sprintf("%s %s", event.Keyboard.Key, event.Keyboard.Action))
+		case model.EventText:
+			got = append(got, "text "+event.Text.Text)
+		}
+	}
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+
+	// Modifiers go in any order around the text, other keys stay down
+	sort.Strings(got[:2])
+	sort.Strings(got[3:])
+	want := []string{"Alt_L release", "Control_L release", "text hi", "Alt_L press", "Control_L press"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("receiver got %v, want %v", got, want)
+	}
+	if mods := p.state.heldModifiers(); len(mods) != 2 {
+		t.Errorf("modifiers held after typing: %v", mods)
+	}
+}
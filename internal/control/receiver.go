@@ -1,22 +1,48 @@
 package control
 
 import (
+	"context"
+	"copy/internal/display"
 	"copy/internal/executor"
 	"copy/internal/model"
 	"copy/internal/wire"
-	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"runtime"
+	"sync"
+	"time"
 )
 
+// pointerReportInterval bounds how often a receiver reports its pointer
+const pointerReportInterval = 30 * time.Millisecond
+
 // Receiver receives input events and executes them locally
 type Receiver struct {
 	executor executor.InputExecutor
+	session  *wire.Session
+	mu       sync.Mutex // Events arrive from the connection and the UDP path
+	held     *inputState
+	// moved is signalled after the pointer moved, see ReportPointer
+	moved chan struct{}
+	// screen resolves normalized pointer positions, the size we advertised
+	screen model.ScreenGeometry
+	// fracX and fracY are the parts of relative motion too small to move
+	// the pointer yet
+	fracX, fracY float64
+	// relative is set while the controller moves the pointer by deltas,
+	// clicks then happen wherever the pointer is
+	relative bool
+}
+
+// ReceiverCapabilities returns what a receiver advertises in its hello
+func ReceiverCapabilities() []string {
+	return append(executor.Capabilities(), wire.CapPointer, model.CapNormalizedPointer)
 }
 
-// NewReceiver creates a new input receiver
-func NewReceiver() (*Receiver, error) {
+// NewReceiver creates a new input receiver for a connection whose hello
+// exchange produced session
+func NewReceiver(session *wire.Session) (*Receiver, error) {
 	var execu executor.InputExecutor
 	var err error
 
@@ -32,52 +58,125 @@ func NewReceiver() (*Receiver, error) {
 		return nil, fmt.Errorf("failed to create input executor: %w", err)
 	}
 
+	return NewReceiverWithExecutor(session, execu), nil
+}
+
+// NewReceiverWithExecutor creates a receiver that performs input through
+// execu, such as a dry-run executor for replays
+func NewReceiverWithExecutor(session *wire.Session, execu executor.InputExecutor) *Receiver {
 	return &Receiver{
 		executor: execu,
-	}, nil
+		session:  session,
+		held:     newInputState(),
+		moved:    make(chan struct{}, 1),
+		screen:   session.Local.Screen,
+	}
 }
 
-// HandleMessage processes an input event message and executes it
-func (r *Receiver) HandleMessage(msg *wire.Message) error {
-	if msg.Type != "input_event" {
-		return nil // Not an input event, ignore
+// HandleEvent executes an input event received from the controller
+func (r *Receiver) HandleEvent(event *model.InputEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log.Printf("[input] Received event: Type=%s", event.Type)
+
+	if !r.supports(event.Type) {
+		log.Printf("[input] Ignoring event not negotiated for this session: %s", event.Type)
+		return nil
 	}
 
-	var event model.InputEvent
-	if err := json.Unmarshal([]byte(msg.Data), &event); err != nil {
-		return fmt.Errorf("failed to unmarshal input event: %w", err)
+	if err := r.execute(event); err != nil {
+		return err
 	}
+	r.held.track(*event)
+	if event.Type == model.EventMouseMove || event.Type == model.EventMouseRelative {
+		select {
+		case r.moved <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
 
-	log.Printf("[input] Received event: Type=%s", event.Type)
+// ReleaseAll releases every key and mouse button the controller left
+// pressed, so nothing stays stuck when a session ends
+func (r *Receiver) ReleaseAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, event := range r.held.releaseEvents() {
+		log.Printf("[input] Releasing %s left held by the controller", event.Type)
+		if err := r.execute(&event); err != nil {
+			log.Printf("[input] Failed to release: %v", err)
+		}
+	}
+}
 
+func (r *Receiver) execute(event *model.InputEvent) error {
 	switch event.Type {
-	case "keyboard":
-		var kbEvent model.KeyboardEvent
-		if err := json.Unmarshal([]byte(event.Data), &kbEvent); err != nil {
-			return fmt.Errorf("failed to unmarshal keyboard event: %w", err)
+	case model.EventKeyboard:
+		if event.Keyboard == nil {
+			return fmt.Errorf("keyboard event without payload")
 		}
-		return r.executor.ExecuteKeyboard(kbEvent)
+		return r.executor.ExecuteKeyboard(*event.Keyboard)
 
-	case "mouse_move":
-		var moveEvent model.MouseMoveEvent
-		if err := json.Unmarshal([]byte(event.Data), &moveEvent); err != nil {
-			return fmt.Errorf("failed to unmarshal mouse move event: %w", err)
+	case model.EventMouseMove:
+		if event.MouseMove == nil {
+			return fmt.Errorf("mouse move event without payload")
 		}
-		return r.executor.ExecuteMouseMove(moveEvent)
+		r.relative = false
+		mv := *event.MouseMove
+		if mv.Normalized {
+			if err := r.denormalize(&mv.X, &mv.Y); err != nil {
+				return err
+			}
+			mv.Normalized = false
+		}
+		return r.executor.ExecuteMouseMove(mv)
+
+	case model.EventMouseClick:
+		if event.MouseClick == nil {
+			return fmt.Errorf("mouse click event without payload")
+		}
+		cl := *event.MouseClick
+		if r.relative {
+			// The controller's position means nothing here, the pointer
+			// only moved by deltas
+			x, y, err := display.Cursor()
+			if err != nil {
+				return fmt.Errorf("cannot place click: %w", err)
+			}
+			cl.X, cl.Y, cl.Normalized = x, y, false
+		}
+		if cl.Normalized {
+			if err := r.denormalize(&cl.X, &cl.Y); err != nil {
+				return err
+			}
+			cl.Normalized = false
+		}
+		return r.executor.ExecuteMouseClick(cl)
 
-	case "mouse_click":
-		var clickEvent model.MouseClickEvent
-		if err := json.Unmarshal([]byte(event.Data), &clickEvent); err != nil {
-			return fmt.Errorf("failed to unmarshal mouse click event: %w", err)
+	case model.EventMouseRelative:
+		if event.MouseRelative == nil {
+			return fmt.Errorf("relative mouse event without payload")
 		}
-		return r.executor.ExecuteMouseClick(clickEvent)
+		r.relative = true
+		return r.moveRelative(*event.MouseRelative)
 
-	case "mouse_scroll":
-		var scrollEvent model.MouseScrollEvent
-		if err := json.Unmarshal([]byte(event.Data), &scrollEvent); err != nil {
-			return fmt.Errorf("failed to unmarshal mouse scroll event: %w", err)
+	case model.EventMouseScroll:
+		if event.MouseScroll == nil {
+			return fmt.Errorf("mouse scroll event without payload")
 		}
-		return r.executor.ExecuteMouseScroll(scrollEvent)
+		return r.executor.ExecuteMouseScroll(*event.MouseScroll)
+
+	case model.EventText:
+		if event.Text == nil {
+			return fmt.Errorf("text event without payload")
+		}
+		return r.executor.ExecuteText(*event.Text)
+
+	case model.EventSecureAttention:
+		return r.executor.ExecuteSecureAttention()
 
 	default:
 		log.Printf("[input] Unknown event type: %s", event.Type)
@@ -85,6 +184,75 @@ func (r *Receiver) HandleMessage(msg *wire.Message) error {
 	}
 }
 
+// moveRelative moves the pointer by the whole pixels of rel and what is
+// left of earlier deltas, keeping the rest for later
+func (r *Receiver) moveRelative(rel model.MouseRelativeEvent) error {
+	r.fracX += rel.DX
+	r.fracY += rel.DY
+	dx, dy := math.Trunc(r.fracX), math.Trunc(r.fracY)
+	if dx == 0 && dy == 0 {
+		return nil
+	}
+	r.fracX -= dx
+	r.fracY -= dy
+	return r.executor.ExecuteMouseRelative(model.MouseRelativeEvent{DX: dx, DY: dy})
+}
+
+// denormalize turns a normalized pointer position into our pixels
+func (r *Receiver) denormalize(x, y *int) error {
+	if !r.screen.Known() {
+		// The hello went out without it, or this is a replay
+		screen, err := display.Geometry()
+		if err != nil {
+			return fmt.Errorf("cannot place normalized pointer position: %w", err)
+		}
+		r.screen = screen
+	}
+	*x, *y = model.Denormalize(*x, *y, r.screen)
+	return nil
+}
+
+// supports reports whether eventType was negotiated for this session
+func (r *Receiver) supports(eventType string) bool {
+	switch eventType {
+	case model.EventMouseScroll:
+		return r.session.Supports(model.CapScrollVertical) || r.session.Supports(model.CapScrollHorizontal)
+	case model.EventText:
+		return r.session.Supports(model.CapTextInjection)
+	default:
+		// Other event types share their capability name
+		return r.session.Supports(eventType)
+	}
+}
+
+// ReportPointer tells the controller where our pointer is through send after
+// it moved, at most once per pointerReportInterval. It returns when ctx is
+// done or send fails
+func (r *Receiver) ReportPointer(ctx context.Context, send func(*wire.Pointer) error) {
+	for {
+		select {
+		case <-r.moved:
+		case <-ctx.Done():
+			return
+		}
+
+		x, y, err := display.Cursor()
+		if err != nil {
+			log.Printf("[input] Cannot report pointer position: %v", err)
+			return
+		}
+		if err := send(&wire.Pointer{X: x, Y: y}); err != nil {
+			return
+		}
+
+		select {
+		case <-time.After(pointerReportInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 // Close closes the receiver
 func (r *Receiver) Close() error {
 	if r.executor != nil {
@@ -0,0 +1,222 @@
+package control
+
+import (
+	"context"
+	"copy/internal/hotkey"
+	"copy/internal/model"
+	"copy/internal/wire"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// Session states reported through Controller.OnStatus
+const (
+	StatusConnected    = "connected"
+	StatusReconnecting = "reconnecting"
+	// StatusQueued means the receiver is controlled by someone else and we
+	// wait for the floor
+	StatusQueued = "queued"
+	// StatusStandby means we hold the receiver but the pointer is on
+	// another screen of the layout, input goes to the receiver once the
+	// pointer moves onto its screen
+	StatusStandby = "standby"
+)
+
+const (
+	defaultMinBackoff  = 250 * time.Millisecond
+	defaultMaxBackoff  = 5 * time.Second
+	defaultGiveUpAfter = time.Minute
+
+	// maxOfflineEvents bounds what is kept while the peer is unreachable
+	maxOfflineEvents = 256
+)
+
+// Reconnect configures how a Controller recovers from a lost connection
+type Reconnect struct {
+	// Dial opens and authenticates a new connection to the same peer. Its
+	// ctx ends when the session gives up, also in the middle of an attempt
+	Dial func(ctx context.Context) (*wire.Client, *wire.Session, error)
+	// MinBackoff and MaxBackoff bound the exponential delay between attempts
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// GiveUpAfter ends the session when the peer stays unreachable this long
+	GiveUpAfter time.Duration
+}
+
+type redialResult struct {
+	client  *wire.Client
+	session *wire.Session
+	err     error
+}
+
+// redial keeps dialing with exponential backoff until it succeeds, gives up
+// or ctx is done. The result is delivered on the returned channel
+func (r *Reconnect) redial(ctx context.Context) <-chan redialResult {
+	resultCh := make(chan redialResult, 1)
+
+	minBackoff, maxBackoff, giveUpAfter := r.MinBackoff, r.MaxBackoff, r.GiveUpAfter
+	if minBackoff <= 0 {
+		minBackoff = defaultMinBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+	if giveUpAfter <= 0 {
+		giveUpAfter = defaultGiveUpAfter
+	}
+
+	go func() {
+		deadline := time.Now().Add(giveUpAfter)
+		backoff := minBackoff
+
+		for attempt := 1; ; attempt++ {
+			dialCtx, cancel := context.WithDeadline(ctx, deadline)
+			client, session, err := r.Dial(dialCtx)
+			cancel()
+			if err == nil {
+				select {
+				case <-ctx.Done():
+					// The controller stopped while we were dialing
+					client.Close()
+				default:
+					resultCh <- redialResult{client: client, session: session}
+				}
+				return
+			}
+			log.Printf("[input] Reconnect attempt %d failed: %v", attempt, err)
+
+			if time.Now().After(deadline) {
+				resultCh <- redialResult{err: fmt.Errorf("gave up after %s: %w", giveUpAfter, err)}
+				return
+			}
+
+			// Full jitter keeps several controllers from retrying in lockstep
+			wait := time.Duration(rand.Int63n(int64(backoff))) + minBackoff
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return
+			}
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+	}()
+
+	return resultCh
+}
+
+// inputState tracks what is currently held down locally and where the
+// pointer is, so a resumed session can be brought back in sync
+type inputState struct {
+	keys    map[string]model.KeyboardEvent
+	buttons map[string]model.MouseClickEvent
+	// pointer is the last absolute position, nil once the pointer moves
+	// by deltas as only the receiver knows where that took it
+	pointer *model.MouseMoveEvent
+	offline []model.InputEvent
+}
+
+func newInputState() *inputState {
+	return &inputState{
+		keys:    make(map[string]model.KeyboardEvent),
+		buttons: make(map[string]model.MouseClickEvent),
+	}
+}
+
+func (s *inputState) track(event model.InputEvent) {
+	switch event.Type {
+	case model.EventKeyboard:
+		if event.Keyboard.Action == "press" {
+			s.keys[event.Keyboard.Key] = *event.Keyboard
+		} else {
+			delete(s.keys, event.Keyboard.Key)
+		}
+	case model.EventMouseMove:
+		pointer := *event.MouseMove
+		s.pointer = &pointer
+	case model.EventMouseRelative:
+		s.pointer = nil
+	case model.EventMouseClick:
+		switch event.MouseClick.Action {
+		case "press":
+			s.buttons[event.MouseClick.Button] = *event.MouseClick
+		default:
+			delete(s.buttons, event.MouseClick.Button)
+		}
+	}
+}
+
+// queueOffline applies the offline policy to an event captured while the
+// peer is unreachable: releases are kept so nothing stays stuck on the
+// receiver, everything else is dropped and later replaced by a resync
+func (s *inputState) queueOffline(event model.InputEvent) {
+	keep := false
+	switch event.Type {
+	case model.EventKeyboard:
+		keep = event.Keyboard.Action == "release"
+	case model.EventMouseClick:
+		keep = event.MouseClick.Action == "release"
+	}
+	if !keep {
+		return
+	}
+
+	if len(s.offline) >= maxOfflineEvents {
+		s.offline = s.offline[1:]
+	}
+	s.offline = append(s.offline, event)
+}
+
+// releaseEvents returns release events for every key and button still
+// held, forgetting them
+func (s *inputState) releaseEvents() []model.InputEvent {
+	var events []model.InputEvent
+	for _, button := range s.buttons {
+		button.Action = "release"
+		button.IsDouble = false
+		events = append(events, model.InputEvent{Type: model.EventMouseClick, MouseClick: &button})
+	}
+	for _, key := range s.keys {
+		key.Action = "release"
+		events = append(events, model.InputEvent{Type: model.EventKeyboard, Keyboard: &key})
+	}
+	clear(s.buttons)
+	clear(s.keys)
+	return events
+}
+
+// heldModifiers returns the modifier keys still held
+func (s *inputState) heldModifiers() []model.KeyboardEvent {
+	var mods []model.KeyboardEvent
+	for _, key := range s.keys {
+		if hotkey.IsModifier(key.Key) {
+			mods = append(mods, key)
+		}
+	}
+	return mods
+}
+
+// resumeEvents returns the events that bring a fresh receiver session in
+// line with local state: queued releases, then pointer position unless it
+// moves by deltas, then whatever is still held down. The offline queue is
+// cleared
+func (s *inputState) resumeEvents() []model.InputEvent {
+	events := s.offline
+	s.offline = nil
+
+	if s.pointer != nil {
+		pointer := *s.pointer
+		events = append(events, model.InputEvent{Type: model.EventMouseMove, MouseMove: &pointer})
+	}
+	for _, button := range s.buttons {
+		events = append(events, model.InputEvent{Type: model.EventMouseClick, MouseClick: &button})
+	}
+	for _, key := range s.keys {
+		events = append(events, model.InputEvent{Type: model.EventKeyboard, Keyboard: &key})
+	}
+	return events
+}
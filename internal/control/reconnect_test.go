@@ -0,0 +1,155 @@
+package control
+
+import (
+	"context"
+	"copy/internal/model"
+	"copy/internal/wire"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRedial(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int // -1 never succeeds
+		giveUp   time.Duration
+		wantErr  bool
+	}{
+		{"first attempt", 0, time.Minute, false},
+		{"after failures", 3, time.Minute, false},
+		{"gives up", -1, 50 * time.Millisecond, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			r := &Reconnect{
+				MinBackoff:  time.Millisecond,
+				MaxBackoff:  5 * time.Millisecond,
+				GiveUpAfter: tt.giveUp,
+				Dial: func(ctx context.Context) (*wire.Client, *wire.Session, error) {
+					n := int(attempts.Add(1))
+					if tt.failures < 0 || n <= tt.failures {
+						return nil, nil, errors.New("unreachable")
+					}
+					a, b := net.Pipe()
+					t.Cleanup(func() { b.Close() })
+					return &wire.Client{Conn: wire.NewConn(a)}, &wire.Session{}, nil
+				},
+			}
+
+			var res redialResult
+			select {
+			case res = <-r.redial(context.Background()):
+			case <-time.After(5 * time.Second):
+				t.Fatal("no result within 5s")
+			}
+			if (res.err != nil) != tt.wantErr {
+				t.Fatalf("got %v, want error %v", res.err, tt.wantErr)
+			}
+			if res.err == nil {
+				res.client.Close()
+				if got := int(attempts.Load()); got != tt.failures+1 {
+					t.Errorf("%d attempts, want %d", got, tt.failures+1)
+				}
+			}
+		})
+	}
+}
+
+func TestRedialCancelled(t *testing.T) {
+	var attempts atomic.Int32
+	r := &Reconnect{
+		MinBackoff: time.Millisecond,
+		MaxBackoff: time.Millisecond,
+		Dial: func(ctx context.Context) (*wire.Client, *wire.Session, error) {
+			attempts.Add(1)
+			return nil, nil, errors.New("unreachable")
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	resultCh := r.redial(ctx)
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+	stopped := attempts.Load()
+
+	select {
+	case res := <-resultCh:
+		t.Fatalf("cancelled redial delivered %+v", res)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if attempts.Load() != stopped {
+		t.Error("redial kept dialing after cancel")
+	}
+}
+
+func move(x, y int) model.InputEvent {
+	return model.InputEvent{Type: model.EventMouseMove, MouseMove: &model.MouseMoveEvent{X: x, Y: y}}
+}
+
+func relative(dx, dy float64) model.InputEvent {
+	return model.InputEvent{Type: model.EventMouseRelative, MouseRelative: &model.MouseRelativeEvent{DX: dx, DY: dy}}
+}
+
+func key(name, action string) model.InputEvent {
+	return model.InputEvent{Type: model.EventKeyboard, Keyboard: &model.KeyboardEvent{Key: name, Action: action}}
+}
+
+func TestInputStateResume(t *testing.T) {
+	tests := []struct {
+		name    string
+		tracked []model.InputEvent
+		offline []model.InputEvent
+		want    []string
+	}{
+		{"nothing", nil, nil, nil},
+		{"pointer", []model.InputEvent{move(1, 2), move(3, 4)}, nil, []string{"move 3,4"}},
+		{"relative after pointer", []model.InputEvent{move(1, 2), relative(1, 0)}, nil, nil},
+		{"pointer after relative", []model.InputEvent{relative(1, 0), move(5, 6)}, nil, []string{"move 5,6"}},
+		{"held key", []model.InputEvent{key("a", "press")}, nil, []string{"a press"}},
+		{"released key", []model.InputEvent{key("a", "press"), key("a", "release")}, nil, nil},
+		{
+			"offline release first",
+			[]model.InputEvent{key("b", "press"), relative(2, 2)},
+			[]model.InputEvent{key("a", "release"), key("c", "press"), move(7, 7)},
+			[]string{"a release", "b press"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newInputState()
+			for _, event := range tt.tracked {
+				s.track(event)
+			}
+			for _, event := range tt.offline {
+				s.queueOffline(event)
+			}
+
+			var got []string
+			for _, event := range s.resumeEvents() {
+				switch event.Type {
+				case model.EventMouseMove:
+					got = append(got, fmt.Sprintf("move %d,%d", event.MouseMove.X, event.MouseMove.Y))
+				case model.EventKeyboard:
+					got = append(got, event.Keyboard.Key+" "+event.Keyboard.Action)
+				default:
+					got = append(got, event.Type)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+			if len(s.offline) != 0 {
+				t.Errorf("offline queue not cleared: %d left", len(s.offline))
+			}
+		})
+	}
+}
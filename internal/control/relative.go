@@ -0,0 +1,130 @@
+package control
+
+import (
+	"copy/internal/display"
+	"copy/internal/hotkey"
+	"copy/internal/model"
+	"log"
+	"time"
+)
+
+// relativeMotion sends pointer motion as deltas. Captures without raw
+// device motion get them from our pointer's positions, it is parked in the
+// middle of our screen so it never stops at an edge
+type relativeMotion struct {
+	// raw is set when the capture delivers the device's motion itself
+	raw bool
+
+	center   point
+	radius   int
+	last     point
+	warpedAt time.Time
+}
+
+func newRelativeMotion(raw bool) (*relativeMotion, error) {
+	r := &relativeMotion{raw: raw}
+	if raw {
+		return r, nil
+	}
+	local, err := display.Geometry()
+	if err != nil {
+		return nil, err
+	}
+	r.center = point{local.Width / 2, local.Height / 2}
+	r.radius = min(local.Width, local.Height) / 4
+	r.park()
+	return r, nil
+}
+
+// park moves our pointer back to the middle of our screen
+func (r *relativeMotion) park() {
+	if err := display.MoveCursor(r.center.x, r.center.y); err != nil {
+		log.Printf("[input] Failed to park the local pointer: %v", err)
+		return
+	}
+	r.last = r.center
+	r.warpedAt = time.Now()
+}
+
+// fromPosition turns our pointer moving to pt into a delta
+func (r *relativeMotion) fromPosition(pt point) (model.InputEvent, bool) {
+	fromCenter := max(abs(pt.x-r.center.x), abs(pt.y-r.center.y))
+	if !r.warpedAt.IsZero() {
+		// Positions far from the center predate the warp
+		if time.Since(r.warpedAt) < warpSettle && fromCenter > r.radius/2 {
+			return model.InputEvent{}, false
+		}
+		r.warpedAt = time.Time{}
+	}
+
+	dx, dy := pt.x-r.last.x, pt.y-r.last.y
+	r.last = pt
+	if fromCenter > r.radius {
+		r.park()
+	}
+	if dx == 0 && dy == 0 {
+		return model.InputEvent{}, false
+	}
+	return model.InputEvent{
+		Type:          model.EventMouseRelative,
+		MouseRelative: &model.MouseRelativeEvent{DX: float64(dx), DY: float64(dy)},
+	}, true
+}
+
+// pointerMotion adapts pointer events to the motion mode, reporting false
+// for those not to send
+func (c *Controller) pointerMotion(event model.InputEvent) (model.InputEvent, bool) {
+	r := c.relative
+	switch event.Type {
+	case model.EventMouseRelative:
+		return event, r != nil && r.raw
+	case model.EventMouseMove:
+		if r == nil {
+			return event, true
+		}
+		if r.raw {
+			return event, false
+		}
+		return r.fromPosition(point{event.MouseMove.X, event.MouseMove.Y})
+	default:
+		return event, true
+	}
+}
+
+// setRelative switches the receiver's pointer between following positions
+// and deltas
+func (c *Controller) setRelative(on bool) {
+	if on == (c.relative != nil) {
+		return
+	}
+	if !on {
+		c.relative = nil
+		log.Printf("[input] Pointer follows positions")
+		return
+	}
+	if c.desk != nil {
+		log.Printf("[input] Relative pointer motion is not available with a screen layout")
+		return
+	}
+	if !c.canRelative {
+		log.Printf("[input] Receiver cannot move its pointer by deltas")
+		return
+	}
+
+	r, err := newRelativeMotion(c.rawMotion)
+	if err != nil {
+		log.Printf("[input] Relative pointer motion unavailable: %v", err)
+		return
+	}
+	c.relative = r
+	log.Printf("[input] Pointer moves by deltas, press %s to go back to positions", c.hotkeyName(hotkey.ActionRelative))
+}
+
+// SetRelative switches the receiver's pointer between following positions
+// and deltas while the controller runs
+func (c *Controller) SetRelative(on bool) {
+	select {
+	case c.relativeCh <- on:
+	case <-c.done:
+	}
+}
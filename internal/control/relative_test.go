@@ -0,0 +1,118 @@
+package control
+
+import (
+	"copy/internal/executor"
+	"copy/internal/model"
+	"copy/internal/wire"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// relativeExecutor records the relative moves a receiver performs
+type relativeExecutor struct {
+	executor.InputExecutor
+	moves []model.MouseRelativeEvent
+}
+
+func (e *relativeExecutor) ExecuteMouseRelative(event model.MouseRelativeEvent) error {
+	e.moves = append(e.moves, event)
+	return nil
+}
+
+func TestReceiverRelative(t *testing.T) {
+	exec := &relativeExecutor{}
+	r := NewReceiverWithExecutor(&wire.Session{Capabilities: []string{model.CapMouseRelative}}, exec)
+
+	// Steps run in order, fractions carry over to the next
+	tests := []struct {
+		dx, dy float64
+		want   *model.MouseRelativeEvent
+	}{
+		{0.25, 0.5, nil},
+		{0.5, -0.75, nil},
+		{0.5, 0, &model.MouseRelativeEvent{DX: 1, DY: 0}},
+		{2.5, -1, &model.MouseRelativeEvent{DX: 2, DY: -1}},
+		{-0.5, 0.5, nil},
+		{-3, 3, &model.MouseRelativeEvent{DX: -2, DY: 3}},
+		{-0.5, 0, &model.MouseRelativeEvent{DX: -1, DY: 0}},
+	}
+
+	for i, tt := range tests {
+		exec.moves = nil
+		event := relative(tt.dx, tt.dy)
+		if err := r.HandleEvent(&event); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		var want []model.MouseRelativeEvent
+		if tt.want != nil {
+			want = []model.MouseRelativeEvent{*tt.want}
+		}
+		if !reflect.DeepEqual(exec.moves, want) {
+			t.Fatalf("step %d: moved %v, want %v", i, exec.moves, want)
+		}
+	}
+}
+
+func TestReceiverRelativeNotNegotiated(t *testing.T) {
+	exec := &relativeExecutor{}
+	r := NewReceiverWithExecutor(&wire.Session{}, exec)
+	event := relative(5, 5)
+	if err := r.HandleEvent(&event); err != nil {
+		t.Fatal(err)
+	}
+	if len(exec.moves) != 0 {
+		t.Errorf("moved %v without the capability", exec.moves)
+	}
+
+	r = NewReceiverWithExecutor(&wire.Session{Capabilities: []string{model.CapMouseRelative}}, exec)
+	if err := r.HandleEvent(&model.InputEvent{Type: model.EventMouseRelative}); err == nil {
+		t.Error("relative event without payload accepted")
+	}
+}
+
+func TestPointerMotion(t *testing.T) {
+	positions := &relativeMotion{center: point{960, 540}, radius: 270, last: point{960, 540}}
+	tests := []struct {
+		name     string
+		relative *relativeMotion
+		event    model.InputEvent
+		want     model.InputEvent
+		send     bool
+	}{
+		{"positions", nil, move(100, 200), move(100, 200), true},
+		{"positions drop raw motion", nil, relative(1, 2), model.InputEvent{}, false},
+		{"raw motion", &relativeMotion{raw: true}, relative(1.5, -2), relative(1.5, -2), true},
+		{"raw drops positions", &relativeMotion{raw: true}, move(100, 200), model.InputEvent{}, false},
+		{"keys pass", &relativeMotion{raw: true}, key("a", "press"), key("a", "press"), true},
+		{"from positions", positions, move(970, 535), relative(10, -5), true},
+		{"from positions no motion", positions, move(970, 535), model.InputEvent{}, false},
+		{"from positions again", positions, move(965, 545), relative(-5, 10), true},
+		{"from positions drop raw motion", positions, relative(1, 2), model.InputEvent{}, false},
+	}
+
+	// Cases share positions and run in order, want only matters when sent
+	for _, tt := range tests {
+		c := &Controller{relative: tt.relative}
+		got, send := c.pointerMotion(tt.event)
+		if send != tt.send || (send && !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("%s: got %+v, %v, want %+v, %v", tt.name, got, send, tt.want, tt.send)
+		}
+	}
+}
+
+func TestFromPositionAfterWarp(t *testing.T) {
+	r := &relativeMotion{center: point{960, 540}, radius: 270, last: point{960, 540}}
+	r.warpedAt = time.Now() // Just parked
+
+	// A position from before the warp is far from the center and ignored
+	if _, ok := r.fromPosition(point{1200, 540}); ok {
+		t.Error("stale position before the warp sent")
+	}
+	if got, ok := r.fromPosition(point{962, 541}); !ok || !reflect.DeepEqual(got, relative(2, 1)) {
+		t.Errorf("got %+v, %v after the warp", got, ok)
+	}
+	if !r.warpedAt.IsZero() {
+		t.Error("warp not settled by a position near the center")
+	}
+}
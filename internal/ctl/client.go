@@ -0,0 +1,125 @@
+package ctl
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// dialTimeout bounds connecting to the control socket
+const dialTimeout = 2 * time.Second
+
+// Client talks to a running instance through its control socket. It is
+// meant for one caller, calls are not safe for concurrent use
+type Client struct {
+	conn    net.Conn
+	scanner *bufio.Scanner
+	nextID  int
+}
+
+// incoming is either a response or an event notification
+type incoming struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params *Event          `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+// Dial connects to the control socket at path
+func Dial(path string) (*Client, error) {
+	conn, err := net.DialTimeout("unix", path, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("no instance is listening on %s: %w", path, err)
+	}
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxRequestSize)
+	return &Client{conn: conn, scanner: scanner}, nil
+}
+
+// Call invokes method with params and decodes its result into result,
+// which may be nil. Events arriving meanwhile are dropped
+func (c *Client) Call(method string, params, result any) error {
+	c.nextID++
+	id := json.RawMessage(strconv.Itoa(c.nextID))
+	if err := c.send(id, method, params); err != nil {
+		return err
+	}
+
+	for {
+		msg, err := c.receive()
+		if err != nil {
+			return err
+		}
+		if msg.Method != "" || string(msg.ID) != string(id) {
+			continue
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result == nil {
+			return nil
+		}
+		if err := json.Unmarshal(msg.Result, result); err != nil {
+			return fmt.Errorf("malformed %s result: %w", method, err)
+		}
+		return nil
+	}
+}
+
+// Subscribe asks for the events named, all of them when none are, and calls
+// fn for each until the connection closes or fn returns false
+func (c *Client) Subscribe(events []string, fn func(*Event) bool) error {
+	if err := c.Call(MethodSubscribe, &SubscribeParams{Events: events}, nil); err != nil {
+		return err
+	}
+	for {
+		msg, err := c.receive()
+		if err != nil {
+			return err
+		}
+		if msg.Method == methodEvent && msg.Params != nil && !fn(msg.Params) {
+			return nil
+		}
+	}
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) send(id json.RawMessage, method string, params any) error {
+	req := request{JSONRPC: jsonRPCVersion, ID: id, Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		req.Params = data
+	}
+	data, err := json.Marshal(&req)
+	if err != nil {
+		return err
+	}
+	_, err = c.conn.Write(append(data, '\n'))
+	return err
+}
+
+func (c *Client) receive() (*incoming, error) {
+	if !c.scanner.Scan() {
+		if err := c.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("instance closed the connection")
+	}
+	var msg incoming
+	if err := json.Unmarshal(c.scanner.Bytes(), &msg); err != nil {
+		return nil, fmt.Errorf("malformed message from instance: %w", err)
+	}
+	return &msg, nil
+}
@@ -0,0 +1,151 @@
+package ctl
+
+import (
+	"copy/internal/shared"
+	"copy/internal/wire"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SocketName is the file name of the control socket
+const SocketName = "iocopy.sock"
+
+// maxRequestSize bounds one request line, send_text carries the largest
+const maxRequestSize = 1 << 20
+
+// Methods understood by the control API. Requests and responses are JSON-RPC
+// 2.0 objects, one per line
+const (
+	MethodScan       = "scan"
+	MethodPeers      = "peers"
+	MethodConnect    = "connect"
+	MethodDisconnect = "disconnect"
+	MethodStatus     = "status"
+	MethodSendText   = "send_text"
+	MethodRelative   = "relative"
+	// MethodSubscribe streams Event notifications on the connection until
+	// it is closed
+	MethodSubscribe = "subscribe"
+
+	// methodEvent is the notification carrying an Event
+	methodEvent = "event"
+)
+
+// JSON-RPC error codes
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	// CodeFailed is returned when the operation itself failed
+	CodeFailed = -32000
+)
+
+const jsonRPCVersion = "2.0"
+
+// SocketPath returns the per-user control socket path: in the runtime dir
+// when the system has one, in the config dir otherwise
+func SocketPath() (string, error) {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, SocketName), nil
+	}
+	dir, err := shared.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, SocketName), nil
+}
+
+// Status describes what a running instance is doing
+type Status struct {
+	Control ControlStatus `json:"control"`
+	// Sessions are the controllers connected to us
+	Sessions []wire.SessionInfo `json:"sessions"`
+	// DialOut is the controller we connect out to in reverse mode
+	DialOut string `json:"dial_out,omitempty"`
+}
+
+// Outgoing control session states, see ControlStatus
+const (
+	StateIdle       = "idle"
+	StateConnecting = "connecting"
+)
+
+// ControlStatus describes the outgoing control session. State is idle,
+// connecting or one of the controller's session states
+type ControlStatus struct {
+	State       string    `json:"state"`
+	Peer        string    `json:"peer,omitempty"`
+	Hostname    string    `json:"hostname,omitempty"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	Since       time.Time `json:"since"`
+	// Error tells why the last session failed, if it did
+	Error string `json:"error,omitempty"`
+	// Peers holds the state of each receiver in a screen layout session
+	Peers map[string]string `json:"peers,omitempty"`
+}
+
+// ConnectParams are the parameters of MethodConnect. Code is the receiver's
+// pairing code, it may be empty if we paired before
+type ConnectParams struct {
+	Target string `json:"target"`
+	Code   string `json:"code,omitempty"`
+}
+
+// SendTextParams are the parameters of MethodSendText
+type SendTextParams struct {
+	Text string `json:"text"`
+}
+
+// RelativeParams are the parameters of MethodRelative, On moves the
+// receiver's pointer by deltas
+type RelativeParams struct {
+	On bool `json:"on"`
+}
+
+// SubscribeParams are the parameters of MethodSubscribe, an empty Events
+// streams every event
+type SubscribeParams struct {
+	Events []string `json:"events,omitempty"`
+}
+
+// Event is an app event streamed to subscribers, the same the UI receives
+type Event struct {
+	Name string    `json:"name"`
+	Args []any     `json:"args,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+// Error is a JSON-RPC error returned by the instance
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// notification is a request without ID, sent by the server for events
+type notification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  *Event `json:"params"`
+}
@@ -0,0 +1,328 @@
+package ctl
+
+import (
+	"bufio"
+	"context"
+	"copy/internal/wire"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// subscriberQueue bounds the events buffered for a slow subscriber, it is
+// dropped rather than holding up the app
+const subscriberQueue = 64
+
+// API is what the control API exposes, implemented by the app
+type API interface {
+	Scan() []string
+	KnownPeers() []wire.KnownPeer
+	// Connect returns once the control session is established or failed
+	Connect(target, code string) error
+	Disconnect()
+	Status() Status
+	SendText(text string) error
+	SetRelative(on bool)
+}
+
+// Server serves the control API on a Unix socket, only the user running
+// the instance may connect
+type Server struct {
+	path string
+	ln   net.Listener
+	api  API
+
+	mu    sync.Mutex
+	subs  map[*subscriber]struct{}
+	conns map[net.Conn]struct{}
+}
+
+// subscriber is a connection that asked for events
+type subscriber struct {
+	events map[string]bool
+	queue  chan *Event
+}
+
+func (s *subscriber) wants(name string) bool {
+	return len(s.events) == 0 || s.events[name]
+}
+
+// Listen opens the control socket at path. A socket left behind by an
+// instance that is gone is replaced, one that still answers is not
+func Listen(path string, api API) (*Server, error) {
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("another instance is serving %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale control socket: %w", err)
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to restrict control socket: %w", err)
+	}
+
+	return &Server{
+		path:  path,
+		ln:    ln,
+		api:   api,
+		subs:  make(map[*subscriber]struct{}),
+		conns: make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// Path returns the socket path
+func (s *Server) Path() string {
+	return s.path
+}
+
+// Serve answers clients until ctx is done, then closes every connection
+// and removes the socket
+func (s *Server) Serve(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		s.ln.Close()
+	})
+	defer stop()
+	defer s.closeAll()
+
+	log.Printf("[ctl] Listening on %s", s.path)
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			log.Printf("[ctl] Accept error: %v", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+// Publish streams an event to the subscribers that want it
+func (s *Server) Publish(name string, args ...any) {
+	event := &Event{Name: name, Args: args, Time: time.Now()}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subs {
+		if !sub.wants(name) {
+			continue
+		}
+		select {
+		case sub.queue <- event:
+		default:
+			log.Printf("[ctl] Subscriber too slow, dropping it")
+			delete(s.subs, sub)
+			close(sub.queue)
+		}
+	}
+}
+
+// handle answers the requests of one connection in order
+func (s *Server) handle(conn net.Conn) {
+	var subs []*subscriber
+	defer func() {
+		for _, sub := range subs {
+			s.unsubscribe(sub)
+		}
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	var wmu sync.Mutex
+	write := func(v any) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		wmu.Lock()
+		defer wmu.Unlock()
+		_, err = conn.Write(append(data, '\n'))
+		return err
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxRequestSize)
+	for scanner.Scan() {
+		var req request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			write(errorResponse(nil, CodeParseError, err.Error()))
+			continue
+		}
+		if req.JSONRPC != jsonRPCVersion || req.Method == "" {
+			write(errorResponse(req.ID, CodeInvalidRequest, "not a JSON-RPC 2.0 request"))
+			continue
+		}
+
+		if req.Method == MethodSubscribe {
+			var params SubscribeParams
+			if err := decodeParams(req.Params, &params); err != nil {
+				write(errorResponse(req.ID, CodeInvalidParams, err.Error()))
+				continue
+			}
+			sub := s.subscribe(params.Events)
+			subs = append(subs, sub)
+			write(resultResponse(req.ID, true))
+			go s.stream(sub, write)
+			continue
+		}
+
+		result, rpcErr := s.call(&req)
+		if req.ID == nil {
+			// A notification from the client, nothing to answer
+			continue
+		}
+		if rpcErr != nil {
+			write(&response{JSONRPC: jsonRPCVersion, ID: req.ID, Error: rpcErr})
+			continue
+		}
+		write(resultResponse(req.ID, result))
+	}
+}
+
+// call runs one method
+func (s *Server) call(req *request) (any, *Error) {
+	failed := func(err error) *Error {
+		return &Error{Code: CodeFailed, Message: err.Error()}
+	}
+
+	switch req.Method {
+	case MethodScan:
+		return s.api.Scan(), nil
+
+	case MethodPeers:
+		return s.api.KnownPeers(), nil
+
+	case MethodConnect:
+		var params ConnectParams
+		if err := decodeParams(req.Params, &params); err != nil || params.Target == "" {
+			return nil, &Error{Code: CodeInvalidParams, Message: "connect needs a target"}
+		}
+		log.Printf("[ctl] Connecting to %s", params.Target)
+		if err := s.api.Connect(params.Target, params.Code); err != nil {
+			return nil, failed(err)
+		}
+		return s.api.Status(), nil
+
+	case MethodDisconnect:
+		s.api.Disconnect()
+		return true, nil
+
+	case MethodStatus:
+		return s.api.Status(), nil
+
+	case MethodSendText:
+		var params SendTextParams
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		if err := s.api.SendText(params.Text); err != nil {
+			return nil, failed(err)
+		}
+		return true, nil
+
+	case MethodRelative:
+		var params RelativeParams
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		s.api.SetRelative(params.On)
+		return true, nil
+
+	default:
+		return nil, &Error{Code: CodeMethodNotFound, Message: "unknown method " + req.Method}
+	}
+}
+
+func (s *Server) subscribe(events []string) *subscriber {
+	sub := &subscriber{
+		events: make(map[string]bool),
+		queue:  make(chan *Event, subscriberQueue),
+	}
+	for _, name := range events {
+		sub.events[name] = true
+	}
+	s.mu.Lock()
+	s.subs[sub] = struct{}{}
+	s.mu.Unlock()
+	return sub
+}
+
+// unsubscribe stops events for sub, it may already be dropped
+func (s *Server) unsubscribe(sub *subscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subs[sub]; ok {
+		delete(s.subs, sub)
+		close(sub.queue)
+	}
+}
+
+// stream writes the events queued for sub until writing fails or sub is
+// dropped
+func (s *Server) stream(sub *subscriber, write func(any) error) {
+	defer s.unsubscribe(sub)
+
+	for event := range sub.queue {
+		if err := write(&notification{JSONRPC: jsonRPCVersion, Method: methodEvent, Params: event}); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) closeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	for sub := range s.subs {
+		delete(s.subs, sub)
+		close(sub.queue)
+	}
+	os.Remove(s.path)
+}
+
+func decodeParams(raw json.RawMessage, out any) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("invalid params: %w", err)
+	}
+	return nil
+}
+
+func resultResponse(id json.RawMessage, result any) *response {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return errorResponse(id, CodeFailed, err.Error())
+	}
+	return &response{JSONRPC: jsonRPCVersion, ID: id, Result: data}
+}
+
+func errorResponse(id json.RawMessage, code int, message string) *response {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &response{JSONRPC: jsonRPCVersion, ID: id, Error: &Error{Code: code, Message: message}}
+}
@@ -0,0 +1,305 @@
+package ctl
+
+import (
+	"bufio"
+	"context"
+	"copy/internal/wire"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAPI records what the control API asked for
+type fakeAPI struct {
+	mu       sync.Mutex
+	calls    []string
+	relative bool
+	failWith error
+}
+
+func (f *fakeAPI) record(call string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+}
+
+func (f *fakeAPI) Scan() []string { return []string{"10.0.0.2", "10.0.0.3"} }
+
+func (f *fakeAPI) KnownPeers() []wire.KnownPeer {
+	return []wire.KnownPeer{{ID: "aa:bb", Name: "desk"}}
+}
+
+func (f *fakeAPI) Connect(target, code string) error {
+	f.record("connect " + target + " " + code)
+	return f.failWith
+}
+
+func (f *fakeAPI) Disconnect() { f.record("disconnect") }
+
+func (f *fakeAPI) Status() Status {
+	return Status{Control: ControlStatus{State: StateIdle}}
+}
+
+func (f *fakeAPI) SendText(text string) error {
+	f.record("send_text " + text)
+	return f.failWith
+}
+
+func (f *fakeAPI) SetRelative(on bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.relative = on
+}
+
+// serve starts a control server for api in a fresh directory
+func serve(t *testing.T, api API) *Server {
+	t.Helper()
+	s, err := Listen(filepath.Join(t.TempDir(), SocketName), api)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Serve(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return s
+}
+
+func dial(t *testing.T, s *Server) *Client {
+	t.Helper()
+	c, err := Dial(s.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return c
+}
+
+func TestCalls(t *testing.T) {
+	api := &fakeAPI{}
+	c := dial(t, serve(t, api))
+
+	tests := []struct {
+		method   string
+		params   any
+		want     any
+		wantCode int
+		call     string
+	}{
+		{MethodScan, nil, []string{"10.0.0.2", "10.0.0.3"}, 0, ""},
+		{MethodPeers, nil, []wire.KnownPeer{{ID: "aa:bb", Name: "desk"}}, 0, ""},
+		{MethodStatus, nil, Status{Control: ControlStatus{State: StateIdle}}, 0, ""},
+		{MethodConnect, &ConnectParams{Target: "desk", Code: "123456"}, Status{Control: ControlStatus{State: StateIdle}}, 0, "connect desk 123456"},
+		{MethodConnect, &ConnectParams{}, nil, CodeInvalidParams, ""},
+		{MethodConnect, "not an object", nil, CodeInvalidParams, ""},
+		{MethodDisconnect, nil, true, 0, "disconnect"},
+		{MethodSendText, &SendTextParams{Text: "hello"}, true, 0, "send_text hello"},
+		{MethodSendText, []int{1}, nil, CodeInvalidParams, ""},
+		{MethodRelative, &RelativeParams{On: true}, true, 0, ""},
+		{"reboot", nil, nil, CodeMethodNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		api.mu.Lock()
+		api.calls = nil
+		api.mu.Unlock()
+		var got any
+		if tt.want != nil {
+			got = reflect.New(reflect.TypeOf(tt.want)).Interface()
+		}
+		err := c.Call(tt.method, tt.params, got)
+		if tt.wantCode != 0 {
+			var rpcErr *Error
+			if !errors.As(err, &rpcErr) || rpcErr.Code != tt.wantCode {
+				t.Errorf("%s %v: got %v, want code %d", tt.method, tt.params, err, tt.wantCode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.method, err)
+			continue
+		}
+		if got := reflect.ValueOf(got).Elem().Interface(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.method, got, tt.want)
+		}
+		api.mu.Lock()
+		calls := api.calls
+		api.mu.Unlock()
+		if tt.call != "" && (len(calls) != 1 || calls[0] != tt.call) {
+			t.Errorf("%s: api saw %q, want %q", tt.method, calls, tt.call)
+		}
+	}
+	if !api.relative {
+		t.Error("relative mode not switched on")
+	}
+}
+
+func TestCallFailed(t *testing.T) {
+	c := dial(t, serve(t, &fakeAPI{failWith: errors.New("peer unreachable")}))
+	err := c.Call(MethodConnect, &ConnectParams{Target: "desk"}, nil)
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != CodeFailed || rpcErr.Message != "peer unreachable" {
+		t.Errorf("got %v, want the API's error with CodeFailed", err)
+	}
+}
+
+func TestMalformedRequests(t *testing.T) {
+	s := serve(t, &fakeAPI{})
+	conn, err := net.Dial("unix", s.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewScanner(conn)
+
+	tests := []struct {
+		name     string
+		line     string
+		wantID   string
+		wantCode int
+	}{
+		{"not json", `{"jsonrpc":`, "null", CodeParseError},
+		{"wrong version", `{"jsonrpc":"1.0","id":1,"method":"status"}`, "1", CodeInvalidRequest},
+		{"no method", `{"jsonrpc":"2.0","id":2}`, "2", CodeInvalidRequest},
+		// A notification gets no answer, so the next reply is for id 3
+		{"notification", `{"jsonrpc":"2.0","method":"disconnect"}` + "\n" + `{"jsonrpc":"2.0","id":3,"method":"status"}`, "3", 0},
+		{"string id", `{"jsonrpc":"2.0","id":"x","method":"status"}`, `"x"`, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := conn.Write([]byte(tt.line + "\n")); err != nil {
+				t.Fatal(err)
+			}
+			if !r.Scan() {
+				t.Fatalf("no reply: %v", r.Err())
+			}
+			var resp response
+			if err := json.Unmarshal(r.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if string(resp.ID) != tt.wantID {
+				t.Errorf("reply id %s, want %s", resp.ID, tt.wantID)
+			}
+			code := 0
+			if resp.Error != nil {
+				code = resp.Error.Code
+			}
+			if code != tt.wantCode {
+				t.Errorf("reply %s, want code %d", r.Bytes(), tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	s := serve(t, &fakeAPI{})
+	c := dial(t, s)
+
+	got := make(chan *Event, 4)
+	go c.Subscribe([]string{"connected", "disconnected"}, func(e *Event) bool {
+		got <- e
+		return e.Name != "disconnected"
+	})
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		s.mu.Lock()
+		n := len(s.subs)
+		s.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("subscription never registered")
+		}
+	}
+
+	s.Publish("scan_done", 3)
+	s.Publish("connected", "desk")
+	s.Publish("disconnected")
+
+	for _, want := range []string{"connected", "disconnected"} {
+		select {
+		case e := <-got:
+			if e.Name != want {
+				t.Fatalf("got event %s, want %s", e.Name, want)
+			}
+			if e.Name == "connected" && !reflect.DeepEqual(e.Args, []any{"desk"}) {
+				t.Errorf("connected args %v", e.Args)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %s event", want)
+		}
+	}
+}
+
+func TestListen(t *testing.T) {
+	s := serve(t, &fakeAPI{})
+	info, err := os.Stat(s.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("socket mode %v, want 0600", perm)
+	}
+
+	// A live instance keeps its socket
+	if other, err := Listen(s.Path(), &fakeAPI{}); err == nil {
+		other.ln.Close()
+		t.Fatal("took over the socket of a running instance")
+	}
+
+	// One left behind by a crash is replaced
+	stale := filepath.Join(t.TempDir(), SocketName)
+	ln, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+	replaced, err := Listen(stale, &fakeAPI{})
+	if err != nil {
+		t.Fatalf("stale socket not replaced: %v", err)
+	}
+	replaced.ln.Close()
+}
+
+func TestServeRemovesSocket(t *testing.T) {
+	s, err := Listen(filepath.Join(t.TempDir(), SocketName), &fakeAPI{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx) }()
+
+	c, err := Dial(s.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+	if _, err := os.Stat(s.Path()); !os.IsNotExist(err) {
+		t.Errorf("socket left behind: %v", err)
+	}
+	c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if err := c.Call(MethodStatus, nil, nil); err == nil {
+		t.Error("connection still answered after shutdown")
+	}
+}
@@ -0,0 +1,43 @@
+package display
+
+import (
+	"copy/internal/model"
+	"fmt"
+	"runtime"
+)
+
+// Geometry returns the size of the local primary screen
+func Geometry() (model.ScreenGeometry, error) {
+	switch runtime.GOOS {
+	case "linux":
+		return linuxGeometry()
+	case "windows":
+		return windowsGeometry()
+	default:
+		return model.ScreenGeometry{}, fmt.Errorf("unsupported OS: %s", runtime.GOOS)
+	}
+}
+
+// Cursor returns the position of the local pointer
+func Cursor() (x, y int, err error) {
+	switch runtime.GOOS {
+	case "linux":
+		return linuxCursor()
+	case "windows":
+		return windowsCursor()
+	default:
+		return 0, 0, fmt.Errorf("unsupported OS: %s", runtime.GOOS)
+	}
+}
+
+// MoveCursor puts the local pointer at x, y
+func MoveCursor(x, y int) error {
+	switch runtime.GOOS {
+	case "linux":
+		return linuxMoveCursor(x, y)
+	case "windows":
+		return windowsMoveCursor(x, y)
+	default:
+		return fmt.Errorf("unsupported OS: %s", runtime.GOOS)
+	}
+}
@@ -0,0 +1,53 @@
+package display
+
+import (
+	"copy/internal/model"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+func linuxGeometry() (model.ScreenGeometry, error) {
+	output, err := exec.Command("xdotool", "getdisplaygeometry").Output()
+	if err != nil {
+		return model.ScreenGeometry{}, fmt.Errorf("failed to query display geometry: %w", err)
+	}
+
+	// Output format: "1920 1080"
+	var geometry model.ScreenGeometry
+	if _, err := fmt.Sscanf(string(output), "%d %d", &geometry.Width, &geometry.Height); err != nil {
+		return model.ScreenGeometry{}, fmt.Errorf("failed to parse display geometry %q: %w", output, err)
+	}
+	return geometry, nil
+}
+
+func linuxCursor() (int, int, error) {
+	output, err := exec.Command("xdotool", "getmouselocation", "--shell").Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to query pointer position: %w", err)
+	}
+
+	// Output format: "X=640\nY=480\nSCREEN=0\nWINDOW=..."
+	x, y := -1, -1
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, _ := strings.Cut(line, "=")
+		switch key {
+		case "X":
+			x, _ = strconv.Atoi(value)
+		case "Y":
+			y, _ = strconv.Atoi(value)
+		}
+	}
+	if x < 0 || y < 0 {
+		return 0, 0, fmt.Errorf("failed to parse pointer position %q", output)
+	}
+	return x, y, nil
+}
+
+func linuxMoveCursor(x, y int) error {
+	if err := exec.Command("xdotool", "mousemove", strconv.Itoa(x), strconv.Itoa(y)).Run(); err != nil {
+		return fmt.Errorf("failed to move pointer: %w", err)
+	}
+	return nil
+}
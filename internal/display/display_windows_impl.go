@@ -0,0 +1,54 @@
+package display
+
+import (
+	"copy/internal/model"
+	"copy/pkg/windows"
+	"fmt"
+	"runtime"
+	"unsafe"
+)
+
+func windowsGeometry() (model.ScreenGeometry, error) {
+	if runtime.GOOS != "windows" {
+		return model.ScreenGeometry{}, nil
+	}
+	if err := windows.InitWindowsDLLs(); err != nil {
+		return model.ScreenGeometry{}, err
+	}
+
+	width, _, _ := windows.ProcGetSystemMetrics.Call(uintptr(windows.SM_CXSCREEN))
+	height, _, _ := windows.ProcGetSystemMetrics.Call(uintptr(windows.SM_CYSCREEN))
+	return model.ScreenGeometry{
+		Width:  int(width),
+		Height: int(height),
+	}, nil
+}
+
+func windowsCursor() (int, int, error) {
+	if runtime.GOOS != "windows" {
+		return 0, 0, nil
+	}
+	if err := windows.InitWindowsDLLs(); err != nil {
+		return 0, 0, err
+	}
+
+	var pt struct{ X, Y int32 }
+	if ok, _, err := windows.ProcGetCursorPos.Call(uintptr(unsafe.Pointer(&pt))); ok == 0 {
+		return 0, 0, fmt.Errorf("failed to query pointer position: %w", err)
+	}
+	return int(pt.X), int(pt.Y), nil
+}
+
+func windowsMoveCursor(x, y int) error {
+	if runtime.GOOS != "windows" {
+		return nil
+	}
+	if err := windows.InitWindowsDLLs(); err != nil {
+		return err
+	}
+
+	if ok, _, err := windows.ProcSetCursorPos.Call(uintptr(x), uintptr(y)); ok == 0 {
+		return fmt.Errorf("failed to move pointer: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package executor
+
+import (
+	"copy/internal/model"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DryRunExecutor prints input instead of performing it and keeps track of
+// what would still be held down
+type DryRunExecutor struct {
+	out     io.Writer
+	keys    map[string]bool
+	buttons map[string]bool
+}
+
+// NewDryRunExecutor creates an executor that writes one line per event to
+// out
+func NewDryRunExecutor(out io.Writer) *DryRunExecutor {
+	return &DryRunExecutor{
+		out:     out,
+		keys:    make(map[string]bool),
+		buttons: make(map[string]bool),
+	}
+}
+
+func (e *DryRunExecutor) ExecuteKeyboard(event model.KeyboardEvent) error {
+	switch event.Action {
+	case "press":
+		e.keys[event.Key] = true
+	case "release":
+		delete(e.keys, event.Key)
+	}
+	modifiers := ""
+	if len(event.Modifiers) > 0 {
+		modifiers = " [" + strings.Join(event.Modifiers, "+") + "]"
+	}
+	_, err := fmt.Fprintf(e.out, "key    %-7s %s%s\n", event.Action, event.Key, modifiers)
+	return err
+}
+
+func (e *DryRunExecutor) ExecuteMouseMove(event model.MouseMoveEvent) error {
+	_, err := fmt.Fprintf(e.out, "move   %d,%d\n", event.X, event.Y)
+	return err
+}
+
+func (e *DryRunExecutor) ExecuteMouseRelative(event model.MouseRelativeEvent) error {
+	_, err := fmt.Fprintf(e.out, "rel    %+d,%+d\n", int(event.DX), int(event.DY))
+	return err
+}
+
+func (e *DryRunExecutor) ExecuteMouseClick(event model.MouseClickEvent) error {
+	switch event.Action {
+	case "press":
+		e.buttons[event.Button] = true
+	case "release":
+		delete(e.buttons, event.Button)
+	}
+	_, err := fmt.Fprintf(e.out, "click  %-7s %s at %d,%d\n", event.Action, event.Button, event.X, event.Y)
+	return err
+}
+
+func (e *DryRunExecutor) ExecuteMouseScroll(event model.MouseScrollEvent) error {
+	_, err := fmt.Fprintf(e.out, "scroll %d,%d\n", event.DeltaX, event.DeltaY)
+	return err
+}
+
+func (e *DryRunExecutor) ExecuteSecureAttention() error {
+	_, err := fmt.Fprintln(e.out, "sas")
+	return err
+}
+
+func (e *DryRunExecutor) ExecuteText(event model.TextEvent) error {
+	_, err := fmt.Fprintf(e.out, "text   %q\n", event.Text)
+	return err
+}
+
+// Held returns the keys and mouse buttons pressed but never released
+func (e *DryRunExecutor) Held() []string {
+	var held []string
+	for key := range e.keys {
+		held = append(held, "key "+key)
+	}
+	for button := range e.buttons {
+		held = append(held, "button "+button)
+	}
+	sort.Strings(held)
+	return held
+}
+
+func (e *DryRunExecutor) Close() error {
+	return nil
+}
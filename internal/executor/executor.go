@@ -1,12 +1,32 @@
 package executor
 
-import "copy/internal/model"
+import (
+	"copy/internal/model"
+	"runtime"
+)
 
 // InputExecutor executes keyboard and mouse input on the local system
 type InputExecutor interface {
 	ExecuteKeyboard(event model.KeyboardEvent) error
 	ExecuteMouseMove(event model.MouseMoveEvent) error
+	// ExecuteMouseRelative moves the pointer by whole pixels
+	ExecuteMouseRelative(event model.MouseRelativeEvent) error
 	ExecuteMouseClick(event model.MouseClickEvent) error
 	ExecuteMouseScroll(event model.MouseScrollEvent) error
+	ExecuteText(event model.TextEvent) error
+	// ExecuteSecureAttention raises Ctrl+Alt+Del
+	ExecuteSecureAttention() error
 	Close() error
 }
+
+// Capabilities returns the input capabilities the local executor can perform
+func Capabilities() []string {
+	switch runtime.GOOS {
+	case "linux":
+		return linuxCapabilities
+	case "windows":
+		return windowsCapabilities
+	default:
+		return nil
+	}
+}
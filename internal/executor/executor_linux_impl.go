@@ -6,6 +6,16 @@ import (
 	"os/exec"
 )
 
+var linuxCapabilities = []string{
+	model.CapKeyboard,
+	model.CapMouseMove,
+	model.CapMouseRelative,
+	model.CapMouseClick,
+	model.CapScrollVertical,
+	model.CapTextInjection,
+	model.CapSecureAttention,
+}
+
 // LinuxInputExecutor executes input using xdotool
 type LinuxInputExecutor struct{}
 
@@ -46,6 +56,12 @@ func (l *LinuxInputExecutor) ExecuteMouseMove(event model.MouseMoveEvent) error
 	return cmd.Run()
 }
 
+func (l *LinuxInputExecutor) ExecuteMouseRelative(event model.MouseRelativeEvent) error {
+	// "--" keeps negative deltas from being taken for options
+	cmd := exec.Command("xdotool", "mousemove_relative", "--", fmt.Sprintf("%d", int(event.DX)), fmt.Sprintf("%d", int(event.DY)))
+	return cmd.Run()
+}
+
 func (l *LinuxInputExecutor) ExecuteMouseClick(event model.MouseClickEvent) error {
 	var cmd *exec.Cmd
 
@@ -78,6 +94,16 @@ func (l *LinuxInputExecutor) ExecuteMouseScroll(event model.MouseScrollEvent) er
 	return nil
 }
 
+func (l *LinuxInputExecutor) ExecuteSecureAttention() error {
+	// X hands Ctrl+Alt+Del to applications like any other chord
+	return exec.Command("xdotool", "key", "ctrl+alt+Delete").Run()
+}
+
+func (l *LinuxInputExecutor) ExecuteText(event model.TextEvent) error {
+	cmd := exec.Command("xdotool", "type", "--delay", "0", "--", event.Text)
+	return cmd.Run()
+}
+
 func (l *LinuxInputExecutor) Close() error {
 	return nil
 }
@@ -1,8 +1,10 @@
 package executor
 
 import (
+	"fmt"
 	"log"
 	"runtime"
+	"unicode/utf16"
 	"unsafe"
 
 	// "golang.org/x/sys/windows"
@@ -11,6 +13,16 @@ import (
 	"copy/pkg/windows"
 )
 
+var windowsCapabilities = []string{
+	model.CapKeyboard,
+	model.CapMouseMove,
+	model.CapMouseRelative,
+	model.CapMouseClick,
+	model.CapScrollVertical,
+	model.CapTextInjection,
+	model.CapSecureAttention,
+}
+
 // WindowsInputExecutor executes input on Windows
 type WindowsInputExecutor struct{}
 
@@ -60,8 +72,11 @@ var keyMap = map[string]uint16{
 	"m": 0x4D, "n": 0x4E, "o": 0x4F, "p": 0x50, "q": 0x51, "r": 0x52,
 	"s": 0x53, "t": 0x54, "u": 0x55, "v": 0x56, "w": 0x57, "x": 0x58,
 	"y": 0x59, "z": 0x5A,
+	"0": 0x30, "1": 0x31, "2": 0x32, "3": 0x33, "4": 0x34,
+	"5": 0x35, "6": 0x36, "7": 0x37, "8": 0x38, "9": 0x39,
 	"Return": 0x0D, "Escape": 0x1B, "Tab": 0x09, "space": 0x20,
-	"BackSpace": 0x08, "Control_L": windows.VK_CONTROL, "Shift_L": windows.VK_SHIFT,
+	"BackSpace": 0x08, "Delete": 0x2E, "End": 0x23,
+	"Control_L": windows.VK_CONTROL, "Shift_L": windows.VK_SHIFT,
 }
 
 func (w *WindowsInputExecutor) ExecuteKeyboard(event model.KeyboardEvent) error {
@@ -212,6 +227,16 @@ func (w *WindowsInputExecutor) ExecuteMouseMove(event model.MouseMoveEvent) erro
 	return nil
 }
 
+func (w *WindowsInputExecutor) ExecuteMouseRelative(event model.MouseRelativeEvent) error {
+	if runtime.GOOS != "windows" {
+		return nil
+	}
+	// Without MOUSEEVENTF_ABSOLUTE the deltas are relative, subject to the
+	// receiver's pointer acceleration like a real mouse
+	windows.ProcMouseEvent.Call(uintptr(windows.MOUSEEVENTF_MOVE), uintptr(int(event.DX)), uintptr(int(event.DY)), 0, 0)
+	return nil
+}
+
 func (w *WindowsInputExecutor) ExecuteMouseClick(event model.MouseClickEvent) error {
 	if runtime.GOOS != "windows" {
 		return nil
@@ -319,6 +344,49 @@ func (w *WindowsInputExecutor) ExecuteMouseScroll(event model.MouseScrollEvent)
 	return nil
 }
 
+// ExecuteSecureAttention calls SendSAS, Windows ignores a Ctrl+Alt+Del
+// injected through SendInput. It only takes effect when the
+// SoftwareSASGeneration policy allows it for our process, which takes a
+// service or a signed UIAccess build
+func (w *WindowsInputExecutor) ExecuteSecureAttention() error {
+	if runtime.GOOS != "windows" {
+		return nil
+	}
+	if err := windows.ProcSendSAS.Find(); err != nil {
+		return fmt.Errorf("SendSAS unavailable: %w", err)
+	}
+	// FALSE: we are not a service acting for the logged on user
+	windows.ProcSendSAS.Call(0)
+	return nil
+}
+
+// ExecuteText types each UTF-16 unit of the text as a unicode key stroke,
+// which needs no key mapping
+func (w *WindowsInputExecutor) ExecuteText(event model.TextEvent) error {
+	if runtime.GOOS != "windows" {
+		return nil
+	}
+
+	var inputs []INPUT
+	for _, unit := range utf16.Encode([]rune(event.Text)) {
+		inputs = append(inputs,
+			INPUT{Type: windows.INPUT_KEYBOARD, Ki: KEYBDINPUT{Scan: unit, Flags: windows.KEYEVENTF_UNICODE}},
+			INPUT{Type: windows.INPUT_KEYBOARD, Ki: KEYBDINPUT{Scan: unit, Flags: windows.KEYEVENTF_UNICODE | windows.KEYEVENTF_KEYUP}},
+		)
+	}
+	if len(inputs) == 0 {
+		return nil
+	}
+
+	ret, _, err := windows.ProcSendInput.Call(uintptr(len(inputs)), uintptr(unsafe.Pointer(&inputs[0])), unsafe.Sizeof(INPUT{}))
+	if ret == 0 {
+		kernel32 := windows.Kernel32.NewProc("GetLastError")
+		errCode, _, _ := kernel32.Call()
+		log.Printf("[input] SendInput failed for text: error code %d, errno %v", errCode, err)
+	}
+	return nil
+}
+
 func (w *WindowsInputExecutor) Close() error {
 	return nil
 }
@@ -0,0 +1,330 @@
+package hotkey
+
+import (
+	"copy/internal/model"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Actions a chord can be bound to
+const (
+	// ActionRelease ends the control session
+	ActionRelease = "release"
+	// ActionRelative switches the receiver's pointer between following
+	// positions and deltas
+	ActionRelative = "relative"
+	// ActionLock locks input to the current screen of a layout until
+	// pressed again
+	ActionLock = "lock"
+	// ActionLocal brings input back to our screen of a layout
+	ActionLocal = "local"
+	// ActionPeer is followed by ":" and the position of a screen in the
+	// layout, from 1, and moves input to that screen
+	ActionPeer = "peer"
+	// ActionCtrlAltDel sends Ctrl+Alt+Del to the receiver input goes to,
+	// pressing it here never reaches the receiver
+	ActionCtrlAltDel = "ctrl-alt-del"
+	// ActionPaste types our clipboard on the receiver input goes to
+	ActionPaste = "paste"
+)
+
+// defaults are the bindings Parse starts from
+var defaults = []struct{ action, chord string }{
+	{ActionRelease, "ctrl+shift+b"},
+	{ActionRelative, "ctrl+shift+m"},
+	{ActionLock, "ctrl+shift+l"},
+	{ActionCtrlAltDel, "ctrl+alt+end"},
+	{ActionPaste, "ctrl+alt+v"},
+}
+
+// modifierOrder is the order a chord lists its modifiers in
+var modifierOrder = []string{"ctrl", "alt", "shift", "super"}
+
+// modifierNames maps the names a chord may give a modifier
+var modifierNames = map[string]string{
+	"ctrl": "ctrl", "control": "ctrl",
+	"alt":   "alt",
+	"shift": "shift",
+	"super": "super", "win": "super", "meta": "super",
+}
+
+// capturedModifiers lists the modifiers the input capture on goos can see,
+// the Windows capture does not report the Windows key
+func capturedModifiers(goos string) map[string]bool {
+	mods := map[string]bool{"ctrl": true, "alt": true, "shift": true}
+	if goos != "windows" {
+		mods["super"] = true
+	}
+	return mods
+}
+
+// localModifiers are the modifiers chords may use here, a chord holding
+// any other could never fire
+var localModifiers = capturedModifiers(runtime.GOOS)
+
+// modifierKeys maps the keys the capture reports for modifiers
+var modifierKeys = map[string]string{
+	"Control_L": "ctrl", "Control_R": "ctrl",
+	"Alt_L": "alt", "Alt_R": "alt",
+	"Shift_L": "shift", "Shift_R": "shift",
+	"Super_L": "super", "Super_R": "super",
+}
+
+// IsModifier reports whether key, as the capture names it, is a modifier
+func IsModifier(key string) bool {
+	_, ok := modifierKeys[key]
+	return ok
+}
+
+// Chord is a key pressed while holding modifiers, such as ctrl+shift+b
+type Chord struct {
+	Modifiers []string // In modifierOrder
+	Key       string   // As the capture names it
+}
+
+// ParseChord parses a chord of modifiers and a key joined by "+"
+func ParseChord(s string) (Chord, error) {
+	parts := strings.Split(s, "+")
+	held := make(map[string]bool)
+	for _, part := range parts[:len(parts)-1] {
+		mod, ok := modifierNames[strings.ToLower(strings.TrimSpace(part))]
+		if !ok {
+			return Chord{}, fmt.Errorf("unknown modifier %q in hotkey %q", part, s)
+		}
+		if held[mod] {
+			return Chord{}, fmt.Errorf("hotkey %q holds %s twice", s, mod)
+		}
+		if !localModifiers[mod] {
+			return Chord{}, fmt.Errorf("hotkey %q holds %s, which input capture on %s cannot see", s, mod, runtime.GOOS)
+		}
+		held[mod] = true
+	}
+
+	key := strings.TrimSpace(parts[len(parts)-1])
+	if key == "" {
+		return Chord{}, fmt.Errorf("hotkey %q has no key", s)
+	}
+	if _, ok := modifierNames[strings.ToLower(key)]; ok {
+		return Chord{}, fmt.Errorf("hotkey %q has only modifiers", s)
+	}
+	if len(held) == 0 {
+		// It would swallow the key whenever it is typed
+		return Chord{}, fmt.Errorf("hotkey %q needs a modifier", s)
+	}
+	if len(key) == 1 {
+		key = strings.ToLower(key)
+	}
+
+	ch := Chord{Key: key}
+	for _, mod := range modifierOrder {
+		if held[mod] {
+			ch.Modifiers = append(ch.Modifiers, mod)
+		}
+	}
+	return ch, nil
+}
+
+func (ch Chord) String() string {
+	return strings.Join(append(append([]string(nil), ch.Modifiers...), ch.Key), "+")
+}
+
+// MarshalText lets a chord travel as its string, such as to the UI
+func (ch Chord) MarshalText() ([]byte, error) {
+	return []byte(ch.String()), nil
+}
+
+// UnmarshalText parses a chord from its string
+func (ch *Chord) UnmarshalText(text []byte) error {
+	parsed, err := ParseChord(string(text))
+	if err != nil {
+		return err
+	}
+	*ch = parsed
+	return nil
+}
+
+// matches reports whether key pressed with held down is the chord
+func (ch Chord) matches(key string, held map[string]bool) bool {
+	if !strings.EqualFold(key, ch.Key) {
+		return false
+	}
+	n := 0
+	for _, on := range held {
+		if on {
+			n++
+		}
+	}
+	if n != len(ch.Modifiers) {
+		return false
+	}
+	for _, mod := range ch.Modifiers {
+		if !held[mod] {
+			return false
+		}
+	}
+	return true
+}
+
+// Binding binds a chord to a controller action, one of the Action* names
+type Binding struct {
+	Action string `json:"action"`
+	Chord  Chord  `json:"chord"`
+}
+
+// Bindings are bindings without conflicts, see Parse
+type Bindings []Binding
+
+// Defaults returns the bindings used when none are configured
+func Defaults() Bindings {
+	h, err := Parse("")
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// Parse binds the actions of spec, a comma separated list of
+// action=chord such as "paste=ctrl+alt+v,peer:2=ctrl+alt+2", on top of the
+// defaults. An empty chord unbinds the action. A chord bound to two actions
+// is an error, and release must keep a chord as it is the way out of a
+// session
+func Parse(spec string) (Bindings, error) {
+	var order []string
+	chords := make(map[string]string)
+	for _, d := range defaults {
+		order = append(order, d.action)
+		chords[d.action] = d.chord
+	}
+
+	configured := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		action, chord, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("hotkey %q is not action=chord", entry)
+		}
+		action = strings.TrimSpace(action)
+		if err := validateAction(action); err != nil {
+			return nil, err
+		}
+		if configured[action] {
+			return nil, fmt.Errorf("%s is bound twice", action)
+		}
+		configured[action] = true
+		if _, ok := chords[action]; !ok {
+			order = append(order, action)
+		}
+		chords[action] = strings.TrimSpace(chord)
+	}
+
+	var h Bindings
+	bound := make(map[string]string)
+	for _, action := range order {
+		if chords[action] == "" {
+			continue
+		}
+		chord, err := ParseChord(chords[action])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", action, err)
+		}
+		name := strings.ToLower(chord.String())
+		if other, ok := bound[name]; ok {
+			return nil, fmt.Errorf("hotkey %s is bound to both %s and %s", chord, other, action)
+		}
+		bound[name] = action
+		h = append(h, Binding{Action: action, Chord: chord})
+	}
+	if _, ok := h.Chord(ActionRelease); !ok {
+		return nil, fmt.Errorf("%s needs a hotkey", ActionRelease)
+	}
+	return h, nil
+}
+
+// validateAction checks that action is one of the Action* names
+func validateAction(action string) error {
+	switch action {
+	case ActionRelease, ActionRelative, ActionLock, ActionLocal, ActionCtrlAltDel, ActionPaste:
+		return nil
+	}
+	if _, ok := PeerNumber(action); ok {
+		return nil
+	}
+	return fmt.Errorf("unknown hotkey action %q", action)
+}
+
+// PeerNumber returns the screen position of an ActionPeer action
+func PeerNumber(action string) (int, bool) {
+	rest, ok := strings.CutPrefix(action, ActionPeer+":")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(rest)
+	return n, err == nil && n > 0
+}
+
+// Chord returns the chord bound to action
+func (h Bindings) Chord(action string) (Chord, bool) {
+	for _, hk := range h {
+		if hk.Action == action {
+			return hk.Chord, true
+		}
+	}
+	return Chord{}, false
+}
+
+// Matcher catches the chords of bindings in captured input. It follows
+// the modifiers held on our keyboard, not every capture reports them with
+// the key
+type Matcher struct {
+	held map[string]bool
+	// swallowed are keys of a chord still down, their release goes nowhere
+	swallowed map[string]bool
+}
+
+// NewMatcher returns a matcher with nothing held
+func NewMatcher() *Matcher {
+	return &Matcher{
+		held:      make(map[string]bool),
+		swallowed: make(map[string]bool),
+	}
+}
+
+// Match returns the action of the chord event presses. It reports true
+// for events that must not be forwarded, the action is empty for the
+// release of a chord's key
+func (s *Matcher) Match(h Bindings, event model.InputEvent) (string, bool) {
+	if event.Type != model.EventKeyboard || event.Keyboard == nil {
+		return "", false
+	}
+	kbEvent := event.Keyboard
+	if mod, ok := modifierKeys[kbEvent.Key]; ok {
+		s.held[mod] = kbEvent.Action == "press"
+		return "", false
+	}
+	if kbEvent.Action != "press" {
+		if s.swallowed[kbEvent.Key] {
+			delete(s.swallowed, kbEvent.Key)
+			return "", true
+		}
+		return "", false
+	}
+
+	held := make(map[string]bool)
+	for mod, on := range s.held {
+		held[mod] = on
+	}
+	for _, mod := range kbEvent.Modifiers {
+		held[mod] = true
+	}
+	for _, hk := range h {
+		if hk.Chord.matches(kbEvent.Key, held) {
+			s.swallowed[kbEvent.Key] = true
+			return hk.Action, true
+		}
+	}
+	return "", false
+}
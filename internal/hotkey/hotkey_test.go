@@ -0,0 +1,185 @@
+package hotkey
+
+import (
+	"copy/internal/model"
+	"encoding/json"
+	"testing"
+)
+
+func TestParseChord(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"ctrl+shift+b", "ctrl+shift+b", false},
+		{"Shift + Control + B", "ctrl+shift+b", false},
+		{"alt+ctrl+End", "ctrl+alt+End", false},
+		{"win+l", "super+l", false},
+		{"ctrl+ctrl+a", "", true},
+		{"hyper+a", "", true},
+		{"ctrl+", "", true},
+		{"ctrl+shift", "", true},
+		{"a", "", true},
+		{"", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			ch, err := ParseChord(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %s, want error", ch)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ch.String() != tt.want {
+				t.Errorf("got %s, want %s", ch, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseChordUncapturedModifier(t *testing.T) {
+	saved := localModifiers
+	defer func() { localModifiers = saved }()
+	localModifiers = capturedModifiers("windows")
+
+	for _, in := range []string{"super+l", "meta+ctrl+l", "win+a"} {
+		if _, err := ParseChord(in); err == nil {
+			t.Errorf("%s parsed where the Windows capture cannot see the Windows key", in)
+		}
+	}
+	if _, err := ParseChord("ctrl+alt+shift+a"); err != nil {
+		t.Errorf("ctrl+alt+shift+a: %v", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"defaults", "", map[string]string{ActionRelease: "ctrl+shift+b", ActionPaste: "ctrl+alt+v"}, false},
+		{"rebind", "release=ctrl+alt+q", map[string]string{ActionRelease: "ctrl+alt+q"}, false},
+		{"unbind", "paste=", map[string]string{ActionPaste: ""}, false},
+		{"peer", "peer:2=ctrl+alt+2", map[string]string{"peer:2": "ctrl+alt+2"}, false},
+		{"swap", "lock=ctrl+alt+v,paste=ctrl+shift+l", map[string]string{ActionLock: "ctrl+alt+v", ActionPaste: "ctrl+shift+l"}, false},
+		{"unknown action", "launch=ctrl+alt+x", nil, true},
+		{"bad peer", "peer:0=ctrl+alt+0", nil, true},
+		{"no chord", "paste", nil, true},
+		{"bound twice", "paste=ctrl+alt+p,paste=ctrl+alt+o", nil, true},
+		{"conflict", "paste=ctrl+shift+b", nil, true},
+		{"conflict ignoring case", "paste=CTRL+SHIFT+B", nil, true},
+		{"release unbound", "release=", nil, true},
+		{"bad chord", "paste=ctrl+", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := Parse(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want error", h)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for action, want := range tt.want {
+				ch, ok := h.Chord(action)
+				if got := ch.String(); ok && got != want || !ok && want != "" {
+					t.Errorf("%s bound to %q (%v), want %q", action, got, ok, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBindingsJSON(t *testing.T) {
+	h, err := Parse("peer:3=ctrl+alt+3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back Bindings
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatal(err)
+	}
+	if len(back) != len(h) {
+		t.Fatalf("got %d bindings, want %d", len(back), len(h))
+	}
+	for i := range h {
+		if back[i].Action != h[i].Action || back[i].Chord.String() != h[i].Chord.String() {
+			t.Errorf("binding %d: got %+v, want %+v", i, back[i], h[i])
+		}
+	}
+}
+
+func keyEvent(key, action string, modifiers ...string) model.InputEvent {
+	return model.InputEvent{
+		Type:     model.EventKeyboard,
+		Keyboard: &model.KeyboardEvent{Key: key, Action: action, Modifiers: modifiers},
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	h := Defaults()
+
+	type step struct {
+		event   model.InputEvent
+		action  string
+		swallow bool
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"modifiers with the key", []step{
+			{keyEvent("b", "press", "ctrl", "shift"), ActionRelease, true},
+			{keyEvent("b", "release", "ctrl", "shift"), "", true},
+			{keyEvent("b", "release"), "", false},
+		}},
+		{"modifier keys tracked", []step{
+			{keyEvent("Control_L", "press"), "", false},
+			{keyEvent("Alt_R", "press"), "", false},
+			{keyEvent("v", "press"), ActionPaste, true},
+			{keyEvent("v", "release"), "", true},
+			{keyEvent("Alt_R", "release"), "", false},
+			{keyEvent("v", "press"), "", false},
+		}},
+		{"extra modifier", []step{
+			{keyEvent("b", "press", "ctrl", "shift", "alt"), "", false},
+		}},
+		{"missing modifier", []step{
+			{keyEvent("b", "press", "ctrl"), "", false},
+		}},
+		{"key case", []step{
+			{keyEvent("B", "press", "ctrl", "shift"), ActionRelease, true},
+		}},
+		{"not a key", []step{
+			{model.InputEvent{Type: model.EventMouseMove, MouseMove: &model.MouseMoveEvent{}}, "", false},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMatcher()
+			for i, s := range tt.steps {
+				action, swallow := m.Match(h, s.event)
+				if action != s.action || swallow != s.swallow {
+					t.Fatalf("step %d: got %q, %v, want %q, %v", i, action, swallow, s.action, s.swallow)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package layout
+
+import (
+	"copy/internal/model"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+)
+
+// File is the name of the layout file in the config dir
+const File = "layout.json"
+
+// LocalScreen names this device's screen in a layout
+const LocalScreen = "local"
+
+// Sides of a screen another screen can sit on
+const (
+	EdgeLeft   = "left"
+	EdgeRight  = "right"
+	EdgeTop    = "top"
+	EdgeBottom = "bottom"
+)
+
+// ValidateEdge checks an edge name, empty is accepted and means none
+func ValidateEdge(edge string) error {
+	switch edge {
+	case "", EdgeLeft, EdgeRight, EdgeTop, EdgeBottom:
+		return nil
+	default:
+		return fmt.Errorf("unknown screen edge %q, want left, right, top or bottom", edge)
+	}
+}
+
+// Placement puts a peer's screen next to another screen
+type Placement struct {
+	// Peer is the receiver's address as given to connect: host[:port], a
+	// ws:// URL or a relay peer ID. It names the screen
+	Peer string `json:"peer"`
+	// Of is the screen this one sits next to, LocalScreen or a peer
+	Of   string `json:"of"`
+	Edge string `json:"edge"`
+	// Offset shifts the screen along Edge, in pixels to the right for top
+	// and bottom, down for left and right
+	Offset int `json:"offset,omitempty"`
+}
+
+// Layout places the screens of several receivers around ours, input goes
+// to whichever screen the pointer is on
+type Layout struct {
+	Screens []Placement `json:"screens"`
+}
+
+// Rect is a screen's area in layout coordinates, ours starts at 0, 0
+type Rect struct {
+	X, Y          int
+	Width, Height int
+}
+
+// Contains reports whether the pixel x, y lies within r
+func (r Rect) Contains(x, y int) bool {
+	return x >= r.X && x < r.X+r.Width && y >= r.Y && y < r.Y+r.Height
+}
+
+func (r Rect) overlaps(o Rect) bool {
+	return r.X < o.X+o.Width && o.X < r.X+r.Width && r.Y < o.Y+o.Height && o.Y < r.Y+r.Height
+}
+
+// Validate checks that every screen is placed once, next to a screen that
+// is itself placed, so each one is reachable from ours
+func (l *Layout) Validate() error {
+	placed := map[string]bool{LocalScreen: true}
+	for _, p := range l.Screens {
+		if p.Peer == "" || p.Peer == LocalScreen {
+			return fmt.Errorf("invalid screen name %q", p.Peer)
+		}
+		if placed[p.Peer] {
+			return fmt.Errorf("%s is placed twice", p.Peer)
+		}
+		if p.Edge == "" {
+			return fmt.Errorf("%s has no edge", p.Peer)
+		}
+		if err := ValidateEdge(p.Edge); err != nil {
+			return fmt.Errorf("%s: %w", p.Peer, err)
+		}
+		placed[p.Peer] = true
+	}
+
+	// Walk from our screen, anything not reached hangs off a cycle or a
+	// screen that is not in the layout
+	reached := map[string]bool{LocalScreen: true}
+	for grew := true; grew; {
+		grew = false
+		for _, p := range l.Screens {
+			if !reached[p.Peer] && reached[p.Of] {
+				reached[p.Peer] = true
+				grew = true
+			}
+		}
+	}
+	for _, p := range l.Screens {
+		if !reached[p.Peer] {
+			return fmt.Errorf("%s is not connected to this screen through %q", p.Peer, p.Of)
+		}
+	}
+	return nil
+}
+
+// Arrange computes where each screen lies given ours and the sizes of the
+// peers' screens. Screens of unknown size, those placed next to them and
+// those overlapping a screen placed before are left out
+func (l *Layout) Arrange(local model.ScreenGeometry, sizes map[string]model.ScreenGeometry) map[string]Rect {
+	rects := map[string]Rect{
+		LocalScreen: {Width: local.Width, Height: local.Height},
+	}
+	done := map[string]bool{}
+	for grew := true; grew; {
+		grew = false
+		for _, p := range l.Screens {
+			of, ok := rects[p.Of]
+			if done[p.Peer] || !ok {
+				continue
+			}
+			done[p.Peer] = true
+			grew = true
+
+			size := sizes[p.Peer]
+			if size.Width <= 0 || size.Height <= 0 {
+				log.Printf("[layout] Size of %s unknown, leaving it out", p.Peer)
+				continue
+			}
+			rect := place(of, p, size)
+			if other, ok := overlapping(rects, rect); ok {
+				log.Printf("[layout] %s overlaps %s, leaving it out", p.Peer, other)
+				continue
+			}
+			rects[p.Peer] = rect
+		}
+	}
+	return rects
+}
+
+// place returns the area of a screen of size placed by p next to of
+func place(of Rect, p Placement, size model.ScreenGeometry) Rect {
+	rect := Rect{Width: size.Width, Height: size.Height}
+	switch p.Edge {
+	case EdgeLeft:
+		rect.X, rect.Y = of.X-size.Width, of.Y+p.Offset
+	case EdgeRight:
+		rect.X, rect.Y = of.X+of.Width, of.Y+p.Offset
+	case EdgeTop:
+		rect.X, rect.Y = of.X+p.Offset, of.Y-size.Height
+	case EdgeBottom:
+		rect.X, rect.Y = of.X+p.Offset, of.Y+of.Height
+	}
+	return rect
+}
+
+func overlapping(rects map[string]Rect, rect Rect) (string, bool) {
+	for name, other := range rects {
+		if rect.overlaps(other) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// Load reads the layout at path, an absent file is an empty layout
+func Load(path string) (*Layout, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Layout{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open layout: %w", err)
+	}
+
+	var l Layout
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("failed to read layout: %w", err)
+	}
+	return &l, nil
+}
+
+// Save writes the layout to path
+func (l *Layout) Save(path string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write aside and rename so a crash cannot leave a truncated layout
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write layout: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write layout: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package layout
+
+import (
+	"copy/internal/model"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidateEdge(t *testing.T) {
+	for edge, valid := range map[string]bool{
+		"":       true,
+		"left":   true,
+		"right":  true,
+		"top":    true,
+		"bottom": true,
+		"Left":   false,
+		"middle": false,
+	} {
+		if err := ValidateEdge(edge); (err == nil) != valid {
+			t.Errorf("ValidateEdge(%q) = %v, want valid %v", edge, err, valid)
+		}
+	}
+}
+
+func TestRectContains(t *testing.T) {
+	r := Rect{X: -100, Y: 0, Width: 100, Height: 50}
+	tests := []struct {
+		x, y int
+		want bool
+	}{
+		{-100, 0, true},
+		{-1, 49, true},
+		{0, 10, false}, // The right edge belongs to the next screen
+		{-50, 50, false},
+		{-101, 10, false},
+		{-50, -1, false},
+	}
+	for _, tt := range tests {
+		if got := r.Contains(tt.x, tt.y); got != tt.want {
+			t.Errorf("Contains(%d, %d) = %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	right := Placement{Peer: "desk", Of: LocalScreen, Edge: EdgeRight}
+	tests := []struct {
+		name    string
+		screens []Placement
+		wantErr bool
+	}{
+		{"empty", nil, false},
+		{"one screen", []Placement{right}, false},
+		{"chained", []Placement{right, {Peer: "laptop", Of: "desk", Edge: EdgeBottom, Offset: -200}}, false},
+		{"chained out of order", []Placement{{Peer: "laptop", Of: "desk", Edge: EdgeBottom}, right}, false},
+		{"placed twice", []Placement{right, {Peer: "desk", Of: LocalScreen, Edge: EdgeLeft}}, true},
+		{"no name", []Placement{{Of: LocalScreen, Edge: EdgeLeft}}, true},
+		{"named local", []Placement{{Peer: LocalScreen, Of: LocalScreen, Edge: EdgeLeft}}, true},
+		{"no edge", []Placement{{Peer: "desk", Of: LocalScreen}}, true},
+		{"bad edge", []Placement{{Peer: "desk", Of: LocalScreen, Edge: "behind"}}, true},
+		{"next to an unknown screen", []Placement{{Peer: "desk", Of: "tv", Edge: EdgeLeft}}, true},
+		{"cycle", []Placement{
+			{Peer: "a", Of: "b", Edge: EdgeLeft},
+			{Peer: "b", Of: "a", Edge: EdgeRight},
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &Layout{Screens: tt.screens}
+			if err := l.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("got %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestArrange(t *testing.T) {
+	local := model.ScreenGeometry{Width: 1920, Height: 1080}
+	size := func(w, h int) model.ScreenGeometry {
+		return model.ScreenGeometry{Width: w, Height: h}
+	}
+
+	tests := []struct {
+		name    string
+		screens []Placement
+		sizes   map[string]model.ScreenGeometry
+		want    map[string]Rect
+	}{
+		{"each edge", []Placement{
+			{Peer: "l", Of: LocalScreen, Edge: EdgeLeft, Offset: 10},
+			{Peer: "r", Of: LocalScreen, Edge: EdgeRight, Offset: -20},
+			{Peer: "t", Of: LocalScreen, Edge: EdgeTop, Offset: 30},
+			{Peer: "b", Of: LocalScreen, Edge: EdgeBottom},
+		}, map[string]model.ScreenGeometry{"l": size(800, 600), "r": size(1280, 1024), "t": size(1024, 768), "b": size(640, 480)},
+			map[string]Rect{
+				LocalScreen: {0, 0, 1920, 1080},
+				"l":         {-800, 10, 800, 600},
+				"r":         {1920, -20, 1280, 1024},
+				"t":         {30, -768, 1024, 768},
+				"b":         {0, 1080, 640, 480},
+			}},
+		{"chained", []Placement{
+			{Peer: "far", Of: "near", Edge: EdgeRight},
+			{Peer: "near", Of: LocalScreen, Edge: EdgeRight},
+		}, map[string]model.ScreenGeometry{"near": size(1000, 800), "far": size(500, 400)},
+			map[string]Rect{
+				LocalScreen: {0, 0, 1920, 1080},
+				"near":      {1920, 0, 1000, 800},
+				"far":       {2920, 0, 500, 400},
+			}},
+		{"unknown size leaves out what hangs off it", []Placement{
+			{Peer: "near", Of: LocalScreen, Edge: EdgeRight},
+			{Peer: "far", Of: "near", Edge: EdgeRight},
+		}, map[string]model.ScreenGeometry{"far": size(500, 400)},
+			map[string]Rect{LocalScreen: {0, 0, 1920, 1080}}},
+		{"overlap", []Placement{
+			{Peer: "a", Of: LocalScreen, Edge: EdgeTop},
+			{Peer: "b", Of: LocalScreen, Edge: EdgeTop, Offset: 500},
+		}, map[string]model.ScreenGeometry{"a": size(1000, 500), "b": size(1000, 500)},
+			map[string]Rect{
+				LocalScreen: {0, 0, 1920, 1080},
+				"a":         {0, -500, 1000, 500},
+			}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &Layout{Screens: tt.screens}
+			if got := l.Arrange(local, tt.sizes); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), File)
+	l, err := Load(path)
+	if err != nil || len(l.Screens) != 0 {
+		t.Fatalf("missing layout: %+v, %v", l, err)
+	}
+
+	l.Screens = []Placement{
+		{Peer: "desk:8080", Of: LocalScreen, Edge: EdgeRight, Offset: -40},
+		{Peer: "ws://laptop", Of: "desk:8080", Edge: EdgeTop},
+	}
+	if err := l.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, l) {
+		t.Errorf("loaded %+v, want %+v", loaded, l)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("loaded a corrupt layout")
+	}
+}
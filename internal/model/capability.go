@@ -0,0 +1,66 @@
+package model
+
+// Capabilities advertised in the hello exchange. A receiver lists what its
+// executor can perform, a controller lists everything it knows how to send,
+// and only the intersection is used for the session
+const (
+	CapKeyboard         = "keyboard"
+	CapMouseMove        = "mouse_move"
+	CapMouseClick       = "mouse_click"
+	CapScrollVertical   = "scroll_vertical"
+	CapScrollHorizontal = "scroll_horizontal"
+	CapTextInjection    = "text_injection"
+	CapClipboard        = "clipboard"
+	// CapNormalizedPointer means the receiver resolves normalized pointer
+	// positions against its own screen
+	CapNormalizedPointer = "normalized_pointer"
+	CapMouseRelative     = "mouse_relative"
+	CapSecureAttention   = "secure_attention"
+)
+
+// InputCapabilities lists every input capability this build understands
+var InputCapabilities = []string{
+	CapKeyboard,
+	CapMouseMove,
+	CapMouseClick,
+	CapScrollVertical,
+	CapScrollHorizontal,
+	CapTextInjection,
+	CapClipboard,
+	CapNormalizedPointer,
+	CapMouseRelative,
+	CapSecureAttention,
+}
+
+// ScreenGeometry describes the size of a peer's primary screen in pixels
+type ScreenGeometry struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// Known reports whether the size was determined
+func (g ScreenGeometry) Known() bool {
+	return g.Width > 0 && g.Height > 0
+}
+
+// NormalizedMax is the far edge of a screen in normalized pointer positions
+const NormalizedMax = 65535
+
+// Normalize turns the pixel x, y on screen into a normalized position
+func Normalize(x, y int, screen ScreenGeometry) (int, int) {
+	return scaleAxis(x, screen.Width-1, NormalizedMax), scaleAxis(y, screen.Height-1, NormalizedMax)
+}
+
+// Denormalize turns the normalized position x, y into a pixel on screen
+func Denormalize(x, y int, screen ScreenGeometry) (int, int) {
+	return scaleAxis(x, NormalizedMax, screen.Width-1), scaleAxis(y, NormalizedMax, screen.Height-1)
+}
+
+// scaleAxis maps v from 0..from onto 0..to, clamping it into range
+func scaleAxis(v, from, to int) int {
+	if from <= 0 {
+		return 0
+	}
+	v = max(0, min(v, from))
+	return (v*to + from/2) / from
+}
@@ -0,0 +1,83 @@
+package model
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	fullHD := ScreenGeometry{Width: 1920, Height: 1080}
+	tests := []struct {
+		name   string
+		x, y   int
+		screen ScreenGeometry
+		nx, ny int
+	}{
+		{"origin", 0, 0, fullHD, 0, 0},
+		{"far corner", 1919, 1079, fullHD, NormalizedMax, NormalizedMax},
+		{"middle", 959, 539, fullHD, 32750, 32737},
+		{"left of the screen", -5, 100, fullHD, 0, 6074},
+		{"beyond the far corner", 5000, 5000, fullHD, NormalizedMax, NormalizedMax},
+		{"unknown screen", 10, 10, ScreenGeometry{}, 0, 0},
+		{"one pixel screen", 0, 0, ScreenGeometry{Width: 1, Height: 1}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nx, ny := Normalize(tt.x, tt.y, tt.screen)
+			if nx != tt.nx || ny != tt.ny {
+				t.Errorf("got %d, %d, want %d, %d", nx, ny, tt.nx, tt.ny)
+			}
+		})
+	}
+}
+
+func TestDenormalize(t *testing.T) {
+	tests := []struct {
+		nx, ny int
+		screen ScreenGeometry
+		x, y   int
+	}{
+		{0, 0, ScreenGeometry{Width: 1280, Height: 1024}, 0, 0},
+		{NormalizedMax, NormalizedMax, ScreenGeometry{Width: 1280, Height: 1024}, 1279, 1023},
+		{NormalizedMax / 2, NormalizedMax / 2, ScreenGeometry{Width: 1280, Height: 1024}, 639, 511},
+		{-1, NormalizedMax + 1, ScreenGeometry{Width: 1280, Height: 1024}, 0, 1023},
+		{NormalizedMax, NormalizedMax, ScreenGeometry{}, 0, 0},
+	}
+	for _, tt := range tests {
+		x, y := Denormalize(tt.nx, tt.ny, tt.screen)
+		if x != tt.x || y != tt.y {
+			t.Errorf("Denormalize(%d, %d, %v) = %d, %d, want %d, %d", tt.nx, tt.ny, tt.screen, x, y, tt.x, tt.y)
+		}
+	}
+}
+
+func TestNormalizeRoundTrip(t *testing.T) {
+	for _, screen := range []ScreenGeometry{
+		{Width: 1920, Height: 1080},
+		{Width: 1366, Height: 768},
+		{Width: 7680, Height: 4320},
+	} {
+		for x := range screen.Width {
+			y := x % screen.Height
+			nx, ny := Normalize(x, y, screen)
+			if gx, gy := Denormalize(nx, ny, screen); gx != x || gy != y {
+				t.Fatalf("%v: %d, %d came back as %d, %d", screen, x, y, gx, gy)
+			}
+		}
+	}
+}
+
+func TestScreenGeometryKnown(t *testing.T) {
+	tests := []struct {
+		screen ScreenGeometry
+		want   bool
+	}{
+		{ScreenGeometry{Width: 1920, Height: 1080}, true},
+		{ScreenGeometry{}, false},
+		{ScreenGeometry{Width: 1920}, false},
+		{ScreenGeometry{Width: -1, Height: 1080}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.screen.Known(); got != tt.want {
+			t.Errorf("%v.Known() = %v, want %v", tt.screen, got, tt.want)
+		}
+	}
+}
@@ -1,9 +1,30 @@
 package model
 
-// InputEvent represents a keyboard or mouse input event
+// Input event types
+const (
+	EventKeyboard    = "keyboard"
+	EventMouseMove   = "mouse_move"
+	EventMouseClick  = "mouse_click"
+	EventMouseScroll = "mouse_scroll"
+	EventText        = "text"
+	// EventMouseRelative moves the pointer by a delta instead of to a
+	// position, for apps that lock or warp the pointer
+	EventMouseRelative = "mouse_relative"
+	// EventSecureAttention asks for Ctrl+Alt+Del. It has no payload, the
+	// receiver raises it the way its OS accepts from software
+	EventSecureAttention = "secure_attention"
+)
+
+// InputEvent represents a keyboard or mouse input event, exactly one of the
+// payload fields matching Type is set
 type InputEvent struct {
-	Type string `json:"type"` // "keyboard", "mouse_move", "mouse_click", "mouse_scroll"
-	Data string `json:"data"` // JSON-encoded event data
+	Type          string              `json:"type"` // "keyboard", "mouse_move", "mouse_click", "mouse_scroll", "text", "mouse_relative"
+	Keyboard      *KeyboardEvent      `json:"keyboard,omitempty"`
+	MouseMove     *MouseMoveEvent     `json:"mouse_move,omitempty"`
+	MouseClick    *MouseClickEvent    `json:"mouse_click,omitempty"`
+	MouseScroll   *MouseScrollEvent   `json:"mouse_scroll,omitempty"`
+	Text          *TextEvent          `json:"text,omitempty"`
+	MouseRelative *MouseRelativeEvent `json:"mouse_relative,omitempty"`
 }
 
 // KeyboardEvent represents a keyboard key event
@@ -17,6 +38,9 @@ type KeyboardEvent struct {
 type MouseMoveEvent struct {
 	X int `json:"x"`
 	Y int `json:"y"`
+	// Normalized positions span the receiver's screen from 0 to
+	// NormalizedMax instead of being in its pixels
+	Normalized bool `json:"normalized,omitempty"`
 }
 
 // MouseClickEvent represents a mouse button click
@@ -26,6 +50,15 @@ type MouseClickEvent struct {
 	X        int    `json:"x"`
 	Y        int    `json:"y"`
 	IsDouble bool   `json:"is_double,omitempty"` // true if this is a double click
+	// Normalized as for MouseMoveEvent
+	Normalized bool `json:"normalized,omitempty"`
+}
+
+// MouseRelativeEvent moves the pointer by DX, DY pixels. Fractions add up
+// on the receiver until they make a whole pixel
+type MouseRelativeEvent struct {
+	DX float64 `json:"dx"`
+	DY float64 `json:"dy"`
 }
 
 // MouseScrollEvent represents mouse wheel scroll
@@ -33,3 +66,8 @@ type MouseScrollEvent struct {
 	DeltaX int `json:"delta_x"`
 	DeltaY int `json:"delta_y"`
 }
+
+// TextEvent is text to type as is, independent of the keyboard layout
+type TextEvent struct {
+	Text string `json:"text"`
+}
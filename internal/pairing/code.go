@@ -0,0 +1,22 @@
+package pairing
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+)
+
+const codeDigits = 6
+
+// newCode returns a random numeric one-time code
+func newCode() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < codeDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate pairing code: %w", err)
+	}
+	return fmt.Sprintf("%0*d", codeDigits, n), nil
+}
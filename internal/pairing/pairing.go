@@ -0,0 +1,221 @@
+package pairing
+
+import (
+	"context"
+	"copy/internal/wire"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+)
+
+const (
+	msgRequest   = "pair_request"
+	msgChallenge = "pair_challenge"
+	msgResponse  = "pair_response"
+	msgOK        = "pair_ok"
+	msgFail      = "pair_fail"
+
+	nonceSize = 32
+
+	// maxFailures bounds how many wrong answers a code survives before it is
+	// replaced, so it cannot be brute forced online
+	maxFailures = 3
+)
+
+var (
+	// ErrCodeRequired is returned to the controller when the receiver does
+	// not know it yet and no pairing code was supplied
+	ErrCodeRequired = errors.New("pairing code required")
+	// ErrRejected is returned when the receiver refused the pairing code
+	ErrRejected = errors.New("pairing code rejected")
+)
+
+// Pairer owns the receiver side of pairing: the current one-time code and
+// the peers that already paired
+type Pairer struct {
+	store    *Store
+	mu       sync.Mutex
+	code     string
+	failures int
+	onChange func(code string)
+}
+
+// NewPairer creates a pairer backed by store with a fresh code. onChange, if
+// set, is called every time the code is replaced
+func NewPairer(store *Store, onChange func(code string)) (*Pairer, error) {
+	p := &Pairer{
+		store:    store,
+		onChange: onChange,
+	}
+	if err := p.Rotate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Code returns the code currently displayed to the user
+func (p *Pairer) Code() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.code
+}
+
+// Rotate replaces the current code
+func (p *Pairer) Rotate() error {
+	code, err := newCode()
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.code = code
+	p.failures = 0
+	onChange := p.onChange
+	p.mu.Unlock()
+
+	if onChange != nil {
+		onChange(code)
+	}
+	return nil
+}
+
+// Forget makes peerID pair again on its next connection
+func (p *Pairer) Forget(peerID string) error {
+	return p.store.Remove(peerID)
+}
+
+// Verify runs the receiver side of the handshake on conn. peerID identifies
+// the controller (its certificate fingerprint, or its IP without TLS) and
+// localID is the receiver's own fingerprint
+func (p *Pairer) Verify(conn net.Conn, peerID, localID string) error {
+	var req wire.Message
+	if err := wire.Receive(conn, &req); err != nil {
+		return fmt.Errorf("failed to read pairing request: %w", err)
+	}
+	if req.Type != msgRequest {
+		return fmt.Errorf("expected %s: %w", msgRequest, &wire.UnknownTypeError{Type: req.Type})
+	}
+
+	if p.store.IsPaired(peerID) {
+		log.Printf("[pairing] %s already paired", peerID)
+		return wire.Send(conn, &wire.Message{Type: msgOK})
+	}
+
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	// Snapshot the code so a concurrent rotation cannot change the expected
+	// answer halfway through
+	code := p.Code()
+
+	challenge := &wire.Message{Type: msgChallenge, Data: hex.EncodeToString(nonce)}
+	if err := wire.Send(conn, challenge); err != nil {
+		return fmt.Errorf("failed to send challenge: %w", err)
+	}
+
+	var resp wire.Message
+	if err := wire.Receive(conn, &resp); err != nil {
+		return fmt.Errorf("failed to read pairing response: %w", err)
+	}
+	if resp.Type != msgResponse {
+		return fmt.Errorf("expected %s: %w", msgResponse, &wire.UnknownTypeError{Type: resp.Type})
+	}
+
+	got, err := hex.DecodeString(resp.Data)
+	if err != nil || !hmac.Equal(got, proof(code, nonce, peerID, localID)) {
+		p.recordFailure()
+		wire.Send(conn, &wire.Message{Type: msgFail})
+		return ErrRejected
+	}
+
+	if err := p.store.Add(peerID); err != nil {
+		log.Printf("[pairing] Failed to remember %s: %v", peerID, err)
+	}
+	log.Printf("[pairing] Paired with %s", peerID)
+
+	// The code is one-time, the next peer needs a new one
+	if err := p.Rotate(); err != nil {
+		log.Printf("[pairing] Failed to rotate code: %v", err)
+	}
+	return wire.Send(conn, &wire.Message{Type: msgOK})
+}
+
+func (p *Pairer) recordFailure() {
+	p.mu.Lock()
+	p.failures++
+	exhausted := p.failures >= maxFailures
+	p.mu.Unlock()
+
+	if exhausted {
+		log.Printf("[pairing] Too many wrong codes, rotating")
+		if err := p.Rotate(); err != nil {
+			log.Printf("[pairing] Failed to rotate code: %v", err)
+		}
+	}
+}
+
+// Authenticate runs the controller side of the handshake. code may be empty
+// when the receiver is expected to remember us, ErrCodeRequired is returned
+// if it does not. localID and peerID are the controller's and receiver's
+// fingerprints. It gives up once ctx is done
+func Authenticate(ctx context.Context, client *wire.Client, code, localID, peerID string) error {
+	if err := client.Write(ctx, &wire.Message{Type: msgRequest}); err != nil {
+		return fmt.Errorf("failed to send pairing request: %w", err)
+	}
+
+	msg, err := client.Read(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read pairing reply: %w", err)
+	}
+
+	switch msg.Type {
+	case msgOK:
+		return nil
+	case msgChallenge:
+	default:
+		return fmt.Errorf("unexpected pairing reply: %s", msg.Type)
+	}
+
+	if code == "" {
+		return ErrCodeRequired
+	}
+
+	nonce, err := hex.DecodeString(msg.Data)
+	if err != nil {
+		return fmt.Errorf("malformed challenge: %w", err)
+	}
+
+	resp := &wire.Message{
+		Type: msgResponse,
+		Data: hex.EncodeToString(proof(code, nonce, localID, peerID)),
+	}
+	if err := client.Write(ctx, resp); err != nil {
+		return fmt.Errorf("failed to send pairing response: %w", err)
+	}
+
+	msg, err = client.Read(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read pairing result: %w", err)
+	}
+	if msg.Type != msgOK {
+		return ErrRejected
+	}
+	return nil
+}
+
+// proof binds the code to this challenge and to both endpoints, so a
+// response cannot be replayed on another connection
+func proof(code string, nonce []byte, controllerID, receiverID string) []byte {
+	mac := hmac.New(sha256.New, []byte(code))
+	mac.Write(nonce)
+	mac.Write([]byte(controllerID))
+	mac.Write([]byte(receiverID))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,163 @@
+package pairing
+
+import (
+	"bytes"
+	"context"
+	"copy/internal/wire"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	controllerID = "controller-fingerprint"
+	receiverID   = "receiver-fingerprint"
+)
+
+func newTestPairer(t *testing.T) *Pairer {
+	t.Helper()
+	store, err := LoadStore(filepath.Join(t.TempDir(), PairedPeersFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewPairer(store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// pair runs both sides of the handshake over a pipe. The controller
+// believes it talks to peerID
+func pair(t *testing.T, p *Pairer, code, peerID string) (controllerErr, receiverErr error) {
+	t.Helper()
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		err := p.Verify(b, controllerID, receiverID)
+		b.Close()
+		done <- err
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	controllerErr = Authenticate(ctx, &wire.Client{Conn: wire.NewConn(a)}, code, controllerID, peerID)
+	a.Close()
+	return controllerErr, <-done
+}
+
+func TestPairing(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    func(p *Pairer) string
+		peerID  string
+		wantErr error
+		paired  bool
+	}{
+		{"right code", (*Pairer).Code, receiverID, nil, true},
+		{"wrong code", func(*Pairer) string { return "not it" }, receiverID, ErrRejected, false},
+		{"no code", func(*Pairer) string { return "" }, receiverID, ErrCodeRequired, false},
+		{"other receiver", (*Pairer).Code, "someone else", ErrRejected, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPairer(t)
+			code := p.Code()
+
+			err, _ := pair(t, p, tt.code(p), tt.peerID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if got := p.store.IsPaired(controllerID); got != tt.paired {
+				t.Errorf("paired = %v, want %v", got, tt.paired)
+			}
+			if rotated := p.Code() != code; rotated != tt.paired {
+				t.Errorf("code rotated = %v, want %v as codes are one-time", rotated, tt.paired)
+			}
+		})
+	}
+}
+
+func TestPairingRemembered(t *testing.T) {
+	p := newTestPairer(t)
+	if err, _ := pair(t, p, p.Code(), receiverID); err != nil {
+		t.Fatal(err)
+	}
+	if err, _ := pair(t, p, "", receiverID); err != nil {
+		t.Fatalf("paired controller asked for a code again: %v", err)
+	}
+
+	if err := p.Forget(controllerID); err != nil {
+		t.Fatal(err)
+	}
+	if err, _ := pair(t, p, "", receiverID); !errors.Is(err, ErrCodeRequired) {
+		t.Fatalf("forgotten controller: got %v, want ErrCodeRequired", err)
+	}
+}
+
+func TestPairingRotatesAfterFailures(t *testing.T) {
+	p := newTestPairer(t)
+	code := p.Code()
+	for i := 0; i < maxFailures-1; i++ {
+		pair(t, p, "wrong", receiverID)
+	}
+	if p.Code() != code {
+		t.Fatalf("code rotated after %d failures", maxFailures-1)
+	}
+	pair(t, p, "wrong", receiverID)
+	if p.Code() == code {
+		t.Fatalf("code survived %d failures", maxFailures)
+	}
+	if err, _ := pair(t, p, code, receiverID); !errors.Is(err, ErrRejected) {
+		t.Fatalf("replaced code: got %v, want ErrRejected", err)
+	}
+}
+
+func TestProofBinding(t *testing.T) {
+	nonce := bytes.Repeat([]byte{1}, nonceSize)
+	base := proof("123456", nonce, controllerID, receiverID)
+
+	tests := []struct {
+		name  string
+		proof []byte
+	}{
+		{"code", proof("123457", nonce, controllerID, receiverID)},
+		{"nonce", proof("123456", bytes.Repeat([]byte{2}, nonceSize), controllerID, receiverID)},
+		{"controller", proof("123456", nonce, "other", receiverID)},
+		{"receiver", proof("123456", nonce, controllerID, "other")},
+		{"swapped ends", proof("123456", nonce, receiverID, controllerID)},
+	}
+	for _, tt := range tests {
+		if bytes.Equal(tt.proof, base) {
+			t.Errorf("changing the %s leaves the proof the same", tt.name)
+		}
+	}
+}
+
+func TestNewCode(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		code, err := newCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(code) != codeDigits {
+			t.Fatalf("code %q is not %d digits", code, codeDigits)
+		}
+		for _, r := range code {
+			if r < '0' || r > '9' {
+				t.Fatalf("code %q is not numeric", code)
+			}
+		}
+		seen[code] = true
+	}
+	if len(seen) < 90 {
+		t.Errorf("only %d distinct codes in 100", len(seen))
+	}
+}
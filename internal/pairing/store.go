@@ -0,0 +1,97 @@
+package pairing
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+const PairedPeersFile = "paired_peers"
+
+// Store remembers peers that already proved knowledge of a pairing code
+type Store struct {
+	path  string
+	mu    sync.Mutex
+	peers map[string]bool
+}
+
+// LoadStore reads the paired peers file at path, an absent file is treated
+// as empty
+func LoadStore(path string) (*Store, error) {
+	s := &Store{
+		path:  path,
+		peers: make(map[string]bool),
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open paired peers: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		id := strings.TrimSpace(scanner.Text())
+		if id != "" {
+			s.peers[id] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read paired peers: %w", err)
+	}
+	return s, nil
+}
+
+// IsPaired reports whether id has paired before
+func (s *Store) IsPaired(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.peers[id]
+}
+
+// Add remembers id and persists the store
+func (s *Store) Add(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.peers[id] {
+		return nil
+	}
+	s.peers[id] = true
+
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write paired peers: %w", err)
+	}
+	defer f.Close()
+	_, err = fmt.Fprintln(f, id)
+	return err
+}
+
+// Remove forgets id and persists the store, id has to pair again
+func (s *Store) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.peers[id] {
+		return nil
+	}
+	delete(s.peers, id)
+
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write paired peers: %w", err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for peer := range s.peers {
+		fmt.Fprintln(w, peer)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,102 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Dial opens a stream to the peer registered as id at the relay on
+// relayAddr. The stream is spliced end to end, callers run TLS over it
+func Dial(ctx context.Context, relayAddr, id string) (net.Conn, error) {
+	var conn net.Conn
+	err := exchange(ctx, relayAddr, func(c net.Conn) error {
+		if err := send(c, msgConnect, &connectTo{Target: id}); err != nil {
+			return err
+		}
+		if err := expect(c, msgReady, &ready{}); err != nil {
+			return err
+		}
+		conn = c
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach %s through relay %s: %w", id, relayAddr, err)
+	}
+	return conn, nil
+}
+
+// Peers lists the peer IDs registered at the relay on relayAddr
+func Peers(ctx context.Context, relayAddr string) ([]string, error) {
+	var reply peers
+	err := exchange(ctx, relayAddr, func(c net.Conn) error {
+		defer c.Close()
+		if err := send(c, msgList, &list{}); err != nil {
+			return err
+		}
+		return expect(c, msgPeers, &reply)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list peers at relay %s: %w", relayAddr, err)
+	}
+	return reply.IDs, nil
+}
+
+// exchange connects to the relay and runs setup on the connection within
+// setupTimeout, closing it when setup fails or ctx is done first. setup
+// keeps the connection by not closing it
+func exchange(ctx context.Context, relayAddr string, setup func(net.Conn) error) error {
+	ctx, cancel := context.WithTimeout(ctx, setupTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", relayAddr)
+	if err != nil {
+		return err
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	err = setup(conn)
+	if !stop() {
+		// ctx ended during setup and took the connection with it
+		return ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	conn.SetDeadline(time.Time{})
+	return nil
+}
+
+// IsRelayed reports whether conn, or the connection under its TLS or
+// WebSocket layers, came through a relay
+func IsRelayed(conn net.Conn) bool {
+	for {
+		if _, ok := conn.(*relayedConn); ok {
+			return true
+		}
+		wrapper, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			return false
+		}
+		conn = wrapper.NetConn()
+	}
+}
+
+// relayedConn is a stream accepted through a relay. It reports the
+// controller's address as seen by the relay instead of the relay's
+type relayedConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c *relayedConn) RemoteAddr() net.Addr {
+	return c.remote
+}
@@ -0,0 +1,193 @@
+package relay
+
+import (
+	"context"
+	"copy/internal/wire"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	minRegisterBackoff = time.Second
+	maxRegisterBackoff = 30 * time.Second
+)
+
+// Addr is the address of a Listener: the peer ID at a relay
+type Addr struct {
+	Relay string
+	ID    string
+}
+
+func (a *Addr) Network() string {
+	return "relay"
+}
+
+func (a *Addr) String() string {
+	return a.ID + "@" + a.Relay
+}
+
+// Listener accepts streams that controllers open to us through a relay. It
+// keeps us registered, registering again whenever the relay goes away
+type Listener struct {
+	addr  *Addr
+	conns chan net.Conn
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu   sync.Mutex
+	ctrl net.Conn
+
+	// claim is the relay's proof that the ID is ours, only used by run
+	claim string
+}
+
+// Listen registers as id at the relay on relayAddr. Registration happens
+// in the background, an unreachable relay is retried rather than reported
+func Listen(relayAddr, id string) (*Listener, error) {
+	if err := validID(id); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &Listener{
+		addr:   &Addr{Relay: relayAddr, ID: id},
+		conns:  make(chan net.Conn),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	go l.run()
+	return l, nil
+}
+
+// Accept waits for the next relayed stream
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.ctx.Done():
+		return nil, net.ErrClosed
+	}
+}
+
+// Close unregisters from the relay. Streams already accepted stay open
+func (l *Listener) Close() error {
+	l.cancel()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ctrl != nil {
+		l.ctrl.Close()
+	}
+	return nil
+}
+
+// Addr returns the relay and the ID we are registered under
+func (l *Listener) Addr() net.Addr {
+	return l.addr
+}
+
+func (l *Listener) run() {
+	backoff := minRegisterBackoff
+	for {
+		ctrl, err := l.register()
+		if err == nil {
+			log.Printf("[relay] Registered as %s", l.addr)
+			backoff = minRegisterBackoff
+			err = l.serve(ctrl)
+		}
+		if l.ctx.Err() != nil {
+			return
+		}
+		log.Printf("[relay] Registration as %s lost: %v, retrying in %s", l.addr, err, backoff)
+
+		select {
+		case <-time.After(backoff):
+		case <-l.ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, maxRegisterBackoff)
+	}
+}
+
+func (l *Listener) register() (net.Conn, error) {
+	var ctrl net.Conn
+	err := exchange(l.ctx, l.addr.Relay, func(c net.Conn) error {
+		if err := send(c, msgRegister, &register{ID: l.addr.ID, Claim: l.claim}); err != nil {
+			return err
+		}
+		var reply registered
+		if err := expect(c, msgRegistered, &reply); err != nil {
+			return err
+		}
+		l.claim = reply.Claim
+		ctrl = c
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ctx.Err() != nil {
+		ctrl.Close()
+		return nil, l.ctx.Err()
+	}
+	l.ctrl = ctrl
+	return ctrl, nil
+}
+
+// serve takes the streams announced on the registration until it fails
+func (l *Listener) serve(ctrl net.Conn) error {
+	defer ctrl.Close()
+	for {
+		msg, err := wire.ReceiveMessage(ctrl, wire.JSONCodec)
+		if err != nil {
+			return err
+		}
+		if msg.Type != msgIncoming {
+			return fmt.Errorf("unexpected %s on registration: %w", msg.Type, &wire.UnknownTypeError{Type: msg.Type})
+		}
+		var in incoming
+		if err := msg.Decode(&in); err != nil {
+			return err
+		}
+		go l.accept(&in)
+	}
+}
+
+// accept opens the stream announced by in and queues it for Accept
+func (l *Listener) accept(in *incoming) {
+	var conn net.Conn
+	err := exchange(l.ctx, l.addr.Relay, func(c net.Conn) error {
+		if err := send(c, msgAccept, &accept{Token: in.Token}); err != nil {
+			return err
+		}
+		if err := expect(c, msgReady, &ready{}); err != nil {
+			return err
+		}
+		conn = c
+		return nil
+	})
+	if err != nil {
+		log.Printf("[relay] Failed to take stream from %s: %v", in.From, err)
+		return
+	}
+
+	remote := conn.RemoteAddr()
+	if addr, err := net.ResolveTCPAddr("tcp", in.From); err == nil {
+		remote = addr
+	} else {
+		// Keep the relay's address rather than refusing the stream
+		log.Printf("[relay] Relay reported bad address %q: %v", in.From, err)
+	}
+
+	select {
+	case l.conns <- &relayedConn{Conn: conn, remote: remote}:
+	case <-l.ctx.Done():
+		conn.Close()
+	}
+}
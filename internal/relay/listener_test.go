@@ -0,0 +1,140 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listenAt registers id at the relay and waits until the relay lists it
+func listenAt(t *testing.T, relayAddr, id string) *Listener {
+	t.Helper()
+	l, err := Listen(relayAddr, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		ids, err := Peers(context.Background(), relayAddr)
+		if err == nil && slices.Contains(ids, id) {
+			return l
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s not registered: %v, %v", id, ids, err)
+		}
+	}
+}
+
+func TestRelayedStream(t *testing.T) {
+	relayAddr := startRelay(t)
+	l := listenAt(t, relayAddr, "office")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := Dial(ctx, relayAddr, "office")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	in, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	if !IsRelayed(in) {
+		t.Error("accepted stream not marked as relayed")
+	}
+	if IsRelayed(out) {
+		t.Error("dialed stream marked as relayed")
+	}
+	// The receiver sees the controller, not the relay
+	if got, want := in.RemoteAddr().String(), out.LocalAddr().String(); got != want {
+		t.Errorf("remote address %s, want %s", got, want)
+	}
+
+	// Bytes pass through untouched both ways
+	in.SetDeadline(time.Now().Add(5 * time.Second))
+	out.SetDeadline(time.Now().Add(5 * time.Second))
+	go out.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(in, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("receiver read %q, %v", buf, err)
+	}
+	go in.Write([]byte("world"))
+	if _, err := io.ReadFull(out, buf); err != nil || string(buf) != "world" {
+		t.Fatalf("controller read %q, %v", buf, err)
+	}
+
+	// Hanging up on one side reaches the other
+	out.Close()
+	if _, err := in.Read(buf); err == nil {
+		t.Error("stream stayed open after the controller left")
+	}
+}
+
+func TestDialUnknownPeer(t *testing.T) {
+	relayAddr := startRelay(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := Dial(ctx, relayAddr, "nobody")
+	if err == nil {
+		conn.Close()
+		t.Fatal("dialed a peer that is not registered")
+	}
+	var refused *RefusedError
+	if !errors.As(err, &refused) {
+		t.Errorf("got %v, want a refusal", err)
+	}
+}
+
+func TestListenerClose(t *testing.T) {
+	relayAddr := startRelay(t)
+	l := listenAt(t, relayAddr, "office")
+	l.Close()
+
+	if _, err := l.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("accept after close: %v, want ErrClosed", err)
+	}
+	// Closing unregisters, so the ID is free for someone else
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		ids, err := Peers(context.Background(), relayAddr)
+		if err == nil && !slices.Contains(ids, "office") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("still listed after close: %v, %v", ids, err)
+		}
+	}
+}
+
+func TestValidID(t *testing.T) {
+	tests := []struct {
+		id    string
+		valid bool
+	}{
+		{"office", true},
+		{"desk-2.lan", true},
+		{"", false},
+		{strings.Repeat("x", maxIDLength), true},
+		{strings.Repeat("x", maxIDLength+1), false},
+		{"two words", false},
+		{"tab\there", false},
+		{"bell\a", false},
+	}
+	for _, tt := range tests {
+		if err := validID(tt.id); (err == nil) != tt.valid {
+			t.Errorf("validID(%q) = %v, want valid %v", tt.id, err, tt.valid)
+		}
+	}
+	if _, err := Listen("127.0.0.1:1", "two words"); err == nil {
+		t.Error("Listen accepted an invalid ID")
+	}
+}
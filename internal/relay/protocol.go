@@ -0,0 +1,134 @@
+package relay
+
+import (
+	"copy/internal/wire"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DefaultPort is where `iocopy relay` listens unless told otherwise
+const DefaultPort = "8090"
+
+// setupTimeout bounds every exchange with the relay before a stream is
+// spliced, including how long a controller waits for the receiver
+const setupTimeout = 10 * time.Second
+
+// maxIDLength bounds peer IDs, they are shown in peer lists
+const maxIDLength = 64
+
+// Messages exchanged with the relay before splicing. After msgReady the
+// connection carries the peers' own bytes, which the relay only copies
+const (
+	msgRegister   = "relay_register"
+	msgRegistered = "relay_registered"
+	msgList       = "relay_list"
+	msgPeers      = "relay_peers"
+	msgConnect    = "relay_connect"
+	msgIncoming   = "relay_incoming"
+	msgAccept     = "relay_accept"
+	msgReady      = "relay_ready"
+	msgError      = "relay_error"
+)
+
+// register announces a receiver that accepts relayed connections. Claim
+// is what the relay handed out when the ID was first registered, it lets
+// a reconnecting receiver replace its own stale registration
+type register struct {
+	ID    string `json:"id"`
+	Claim string `json:"claim,omitempty"`
+}
+
+// registered confirms a registration, Claim proves ownership of the ID on
+// the next registration
+type registered struct {
+	Claim string `json:"claim"`
+}
+
+// list asks for the registered peers
+type list struct{}
+
+// peers answers list
+type peers struct {
+	IDs []string `json:"ids"`
+}
+
+// connectTo asks the relay for a stream to a registered peer
+type connectTo struct {
+	Target string `json:"target"`
+}
+
+// incoming tells a registered receiver that a controller is waiting.
+// From is the controller's address as seen by the relay
+type incoming struct {
+	Token string `json:"token"`
+	From  string `json:"from"`
+}
+
+// accept is sent by the receiver on a new connection to take the stream
+// announced by incoming
+type accept struct {
+	Token string `json:"token"`
+}
+
+// ready tells both ends that the stream is spliced
+type ready struct{}
+
+// refusal reports why the relay did not do what was asked
+type refusal struct {
+	Reason string `json:"reason"`
+}
+
+// RefusedError is returned when the relay turned a request down
+type RefusedError struct {
+	Reason string
+}
+
+func (e *RefusedError) Error() string {
+	return "relay refused: " + e.Reason
+}
+
+func validID(id string) error {
+	if id == "" {
+		return errors.New("peer ID is empty")
+	}
+	if len(id) > maxIDLength {
+		return fmt.Errorf("peer ID longer than %d bytes", maxIDLength)
+	}
+	if strings.IndexFunc(id, func(r rune) bool { return unicode.IsSpace(r) || !unicode.IsPrint(r) }) >= 0 {
+		return fmt.Errorf("peer ID %q contains spaces or control characters", id)
+	}
+	return nil
+}
+
+func send(conn net.Conn, msgType string, payload any) error {
+	msg, err := wire.NewMessage(msgType, payload)
+	if err != nil {
+		return err
+	}
+	return wire.SendMessage(conn, wire.JSONCodec, msg)
+}
+
+// expect reads the next message into out, which must be of type want. A
+// refusal from the relay is returned as a RefusedError
+func expect(conn net.Conn, want string, out any) error {
+	msg, err := wire.ReceiveMessage(conn, wire.JSONCodec)
+	if err != nil {
+		return err
+	}
+	switch msg.Type {
+	case want:
+		return msg.Decode(out)
+	case msgError:
+		var r refusal
+		if err := msg.Decode(&r); err != nil {
+			return err
+		}
+		return &RefusedError{Reason: r.Reason}
+	default:
+		return fmt.Errorf("expected %s: %w", want, &wire.UnknownTypeError{Type: msg.Type})
+	}
+}
@@ -0,0 +1,348 @@
+package relay
+
+import (
+	"context"
+	"copy/internal/wire"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Server is the rendezvous point for peers that cannot reach each other
+// directly. Receivers register under a peer ID, controllers ask for a peer
+// by ID and the server splices the two connections. Peers run TLS over the
+// spliced stream, the server never sees their keys
+type Server struct {
+	ln net.Listener
+
+	mu      sync.Mutex
+	peers   map[string]*registration
+	pending map[string]chan net.Conn
+	conns   map[net.Conn]struct{}
+}
+
+// registration is a receiver's control connection, incoming controllers
+// are announced on it
+type registration struct {
+	id    string
+	claim string
+	conn  net.Conn
+	wmu   sync.Mutex
+}
+
+func (r *registration) announce(in *incoming) error {
+	r.wmu.Lock()
+	defer r.wmu.Unlock()
+	r.conn.SetWriteDeadline(time.Now().Add(setupTimeout))
+	return send(r.conn, msgIncoming, in)
+}
+
+// NewServer opens a relay on addr
+func NewServer(addr string) (*Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	return &Server{
+		ln:      ln,
+		peers:   make(map[string]*registration),
+		pending: make(map[string]chan net.Conn),
+		conns:   make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// Addr returns the address the relay listens on
+func (s *Server) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+// Serve relays until ctx is done, then closes every connection
+func (s *Server) Serve(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		s.ln.Close()
+	})
+	defer stop()
+	defer s.closeAll()
+
+	log.Printf("[relay] Listening on %s", s.ln.Addr())
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			log.Printf("[relay] Accept error: %v", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		s.track(conn)
+		go s.handle(ctx, conn)
+	}
+}
+
+// handle runs the setup exchange of one connection. Connections handed to
+// another goroutine are not closed here
+func (s *Server) handle(ctx context.Context, conn net.Conn) {
+	handedOff := false
+	defer func() {
+		if !handedOff {
+			s.untrack(conn)
+			conn.Close()
+		}
+	}()
+
+	conn.SetDeadline(time.Now().Add(setupTimeout))
+	msg, err := wire.ReceiveMessage(conn, wire.JSONCodec)
+	if err != nil {
+		log.Printf("[relay] Dropping %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+
+	switch msg.Type {
+	case msgRegister:
+		var req register
+		if err := msg.Decode(&req); err != nil {
+			return
+		}
+		s.serveRegistration(conn, &req)
+
+	case msgList:
+		send(conn, msgPeers, &peers{IDs: s.peerIDs()})
+
+	case msgConnect:
+		var req connectTo
+		if err := msg.Decode(&req); err != nil {
+			return
+		}
+		s.connect(ctx, conn, req.Target)
+
+	case msgAccept:
+		var req accept
+		if err := msg.Decode(&req); err != nil {
+			return
+		}
+		handedOff = s.accept(conn, req.Token)
+
+	default:
+		log.Printf("[relay] %s sent unexpected %s", conn.RemoteAddr(), msg.Type)
+		refuse(conn, "unexpected "+msg.Type)
+	}
+}
+
+// serveRegistration keeps a receiver registered until its connection
+// drops. A live registration is only replaced by a request carrying its
+// claim, that is the same receiver reconnecting before the relay noticed
+// the old connection is gone. Anyone else is refused, TCP keepalives free
+// the ID once a vanished receiver's connection times out
+func (s *Server) serveRegistration(conn net.Conn, req *register) {
+	id := req.ID
+	if err := validID(id); err != nil {
+		refuse(conn, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	old := s.peers[id]
+	if old != nil && subtle.ConstantTimeCompare([]byte(req.Claim), []byte(old.claim)) != 1 {
+		s.mu.Unlock()
+		log.Printf("[relay] Refusing %s from %s, it is registered already", id, conn.RemoteAddr())
+		refuse(conn, fmt.Sprintf("peer %q is already registered", id))
+		return
+	}
+	reg := &registration{id: id, conn: conn}
+	if old != nil {
+		reg.claim = old.claim
+	} else {
+		claim, err := newToken()
+		if err != nil {
+			s.mu.Unlock()
+			refuse(conn, "internal error")
+			return
+		}
+		reg.claim = claim
+	}
+	s.peers[id] = reg
+	s.mu.Unlock()
+
+	if old != nil {
+		log.Printf("[relay] %s re-registered from %s", id, conn.RemoteAddr())
+		old.conn.Close()
+	} else {
+		log.Printf("[relay] %s registered from %s", id, conn.RemoteAddr())
+	}
+	defer func() {
+		s.mu.Lock()
+		if s.peers[id] == reg {
+			delete(s.peers, id)
+			log.Printf("[relay] %s unregistered", id)
+		}
+		s.mu.Unlock()
+	}()
+
+	if err := send(conn, msgRegistered, &registered{Claim: reg.claim}); err != nil {
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	// Receivers send nothing after registering, reading only tells us when
+	// the connection goes away
+	io.Copy(io.Discard, conn)
+}
+
+// connect asks the receiver registered as target to open a stream for conn
+// and splices the two
+func (s *Server) connect(ctx context.Context, conn net.Conn, target string) {
+	s.mu.Lock()
+	reg := s.peers[target]
+	s.mu.Unlock()
+	if reg == nil {
+		refuse(conn, fmt.Sprintf("peer %q is not registered", target))
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		refuse(conn, "internal error")
+		return
+	}
+	ch := make(chan net.Conn, 1)
+	s.mu.Lock()
+	s.pending[token] = ch
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, token)
+		s.mu.Unlock()
+		// An accept that raced with us giving up is not spliced
+		select {
+		case late := <-ch:
+			s.untrack(late)
+			late.Close()
+		default:
+		}
+	}()
+
+	if err := reg.announce(&incoming{Token: token, From: conn.RemoteAddr().String()}); err != nil {
+		log.Printf("[relay] Failed to announce %s to %s: %v", conn.RemoteAddr(), target, err)
+		refuse(conn, fmt.Sprintf("peer %q is unreachable", target))
+		return
+	}
+
+	var other net.Conn
+	select {
+	case other = <-ch:
+	case <-time.After(setupTimeout):
+		refuse(conn, fmt.Sprintf("peer %q did not answer", target))
+		return
+	case <-ctx.Done():
+		return
+	}
+	defer func() {
+		s.untrack(other)
+		other.Close()
+	}()
+
+	if err := send(conn, msgReady, &ready{}); err != nil {
+		return
+	}
+	if err := send(other, msgReady, &ready{}); err != nil {
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	other.SetDeadline(time.Time{})
+
+	log.Printf("[relay] Splicing %s to %s", conn.RemoteAddr(), target)
+	toTarget, fromTarget := splice(conn, other)
+	log.Printf("[relay] Stream %s to %s closed (%d bytes out, %d bytes back)", conn.RemoteAddr(), target, toTarget, fromTarget)
+}
+
+// accept hands conn to the controller waiting on token, reporting whether
+// it was taken
+func (s *Server) accept(conn net.Conn, token string) bool {
+	s.mu.Lock()
+	ch, ok := s.pending[token]
+	delete(s.pending, token)
+	s.mu.Unlock()
+	if !ok {
+		refuse(conn, "unknown or expired token")
+		return false
+	}
+	ch <- conn
+	return true
+}
+
+func (s *Server) peerIDs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.peers))
+	for id := range s.peers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (s *Server) track(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns[conn] = struct{}{}
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}
+
+func (s *Server) closeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// splice copies between a and b until either side closes, then closes
+// both. It returns the bytes copied from a to b and from b to a
+func splice(a, b net.Conn) (int64, int64) {
+	var ab, ba int64
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		ab, _ = io.Copy(b, a)
+		b.Close()
+		a.Close()
+	}()
+	go func() {
+		defer wg.Done()
+		ba, _ = io.Copy(a, b)
+		a.Close()
+		b.Close()
+	}()
+	wg.Wait()
+	return ab, ba
+}
+
+func refuse(conn net.Conn, reason string) {
+	send(conn, msgError, &refusal{Reason: reason})
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
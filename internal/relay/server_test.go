@@ -0,0 +1,108 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func startRelay(t *testing.T) string {
+	t.Helper()
+	srv, err := NewServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go srv.Serve(ctx)
+	return srv.Addr().String()
+}
+
+// registerAs registers id at the relay, returning the registration
+// connection and the claim it was given
+func registerAs(t *testing.T, relayAddr, id, claim string) (net.Conn, string, error) {
+	t.Helper()
+	conn, err := net.Dial("tcp", relayAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if err := send(conn, msgRegister, &register{ID: id, Claim: claim}); err != nil {
+		t.Fatal(err)
+	}
+	var reply registered
+	if err := expect(conn, msgRegistered, &reply); err != nil {
+		return nil, "", err
+	}
+	return conn, reply.Claim, nil
+}
+
+func TestRegistrationClaim(t *testing.T) {
+	relayAddr := startRelay(t)
+
+	first, claim, err := registerAs(t, relayAddr, "office", "")
+	if err != nil {
+		t.Fatalf("first registration: %v", err)
+	}
+	if claim == "" {
+		t.Fatal("first registration got no claim")
+	}
+
+	tests := []struct {
+		name  string
+		claim string
+	}{
+		{"no claim", ""},
+		{"wrong claim", "0123456789abcdef0123456789abcdef"},
+		{"truncated claim", claim[:len(claim)-1]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := registerAs(t, relayAddr, "office", tt.claim)
+			var refused *RefusedError
+			if !errors.As(err, &refused) {
+				t.Fatalf("got %v, want a refusal", err)
+			}
+		})
+	}
+
+	// The owner reconnecting replaces its own registration
+	_, again, err := registerAs(t, relayAddr, "office", claim)
+	if err != nil {
+		t.Fatalf("re-registration with claim: %v", err)
+	}
+	if again != claim {
+		t.Errorf("claim changed on re-registration: %q, want %q", again, claim)
+	}
+	first.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := first.Read(make([]byte, 1)); err == nil {
+		t.Error("replaced registration was not closed")
+	}
+}
+
+func TestRegistrationFreedOnDisconnect(t *testing.T) {
+	relayAddr := startRelay(t)
+
+	conn, _, err := registerAs(t, relayAddr, "office", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	// The relay notices the drop asynchronously
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, _, err := registerAs(t, relayAddr, "office", "")
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ID still taken after the owner left: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
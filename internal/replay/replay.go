@@ -0,0 +1,98 @@
+package replay
+
+import (
+	"copy/internal/control"
+	"copy/internal/executor"
+	"copy/internal/model"
+	"copy/internal/wire"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+)
+
+// Options controls a replay
+type Options struct {
+	// Speed scales the original timing, 2 plays twice as fast. Zero or
+	// less replays without any delay
+	Speed float64
+	// DryRun prints the events instead of performing them
+	DryRun bool
+	// Out receives the dry-run output and the summary
+	Out io.Writer
+}
+
+// Run feeds the input events the receiver got in the capture at path into a
+// local receiver
+func Run(path string, opts Options) error {
+	capture, err := wire.OpenCapture(path)
+	if err != nil {
+		return err
+	}
+	defer capture.Close()
+
+	header := capture.Header()
+	session := header.Session
+	if session == nil {
+		// Without a recorded session assume everything was negotiated
+		session = &wire.Session{Capabilities: model.InputCapabilities}
+	}
+	fmt.Fprintf(opts.Out, "Replaying %s capture with %s from %s, capabilities %v\n",
+		header.Role, header.Peer, header.Start.Format(time.RFC3339), session.Capabilities)
+
+	// Input travels from controller to receiver, so which direction to
+	// replay depends on which side recorded
+	inbound := wire.DirIn
+	if header.Role == wire.RoleController {
+		inbound = wire.DirOut
+	}
+
+	var receiver *control.Receiver
+	var dryRun *executor.DryRunExecutor
+	if opts.DryRun {
+		dryRun = executor.NewDryRunExecutor(opts.Out)
+		receiver = control.NewReceiverWithExecutor(session, dryRun)
+	} else {
+		receiver, err = control.NewReceiver(session)
+		if err != nil {
+			return err
+		}
+	}
+	defer receiver.Close()
+
+	start := time.Now()
+	events := 0
+	for {
+		record, err := capture.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// A capture cut short by a crash is still worth replaying up to
+			// that point
+			log.Printf("[replay] Stopping at damaged record: %v", err)
+			break
+		}
+		if record.Dir != inbound || record.Msg.Type != wire.MsgInputEvent || record.Msg.Event == nil {
+			continue
+		}
+
+		if opts.Speed > 0 {
+			due := time.Duration(float64(record.At) / opts.Speed)
+			time.Sleep(time.Until(start.Add(due)))
+		}
+		if err := receiver.HandleEvent(record.Msg.Event); err != nil {
+			log.Printf("[replay] Event at %s failed: %v", record.At, err)
+		}
+		events++
+	}
+
+	fmt.Fprintf(opts.Out, "Replayed %d events in %s\n", events, time.Since(start).Round(time.Millisecond))
+	if dryRun != nil {
+		if held := dryRun.Held(); len(held) > 0 {
+			fmt.Fprintf(opts.Out, "Still held at the end: %v\n", held)
+		}
+	}
+	return nil
+}
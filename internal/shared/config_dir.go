@@ -0,0 +1,24 @@
+package shared
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const appDirName = "iocopy"
+
+// ConfigDir returns the per-user directory where iocopy persists its state,
+// creating it if it does not exist yet
+func ConfigDir() (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user config dir: %w", err)
+	}
+
+	dir := filepath.Join(base, appDirName)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create config dir %s: %w", dir, err)
+	}
+	return dir, nil
+}
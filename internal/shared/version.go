@@ -0,0 +1,5 @@
+package shared
+
+// Version is the application version reported to peers, release builds set it
+// with -ldflags "-X copy/internal/shared.Version=x.y.z"
+var Version = "dev"
@@ -1,7 +1,33 @@
 package ui
 
+import (
+	"copy/internal/hotkey"
+	"copy/internal/layout"
+	"copy/internal/wire"
+)
+
 // interface to inject application into UI to avoid circular dependencies
 type Application interface {
 	FindReachableIPs(port string) []string
-	RunControl(ip string, port string) error
+	RunControl(ip string, port string, code string) error
+	CancelControl()
+	RunReverseControl(addr, code, peer string) error
+	ReverseListenAddr() string
+	DialOut(addr string) error
+	DialOutTarget() string
+	LocalFingerprint() string
+	PairingCode() string
+	Sessions() []wire.SessionInfo
+	HandOver(id uint64) error
+	FloorHolder() uint64
+	KnownPeers() []wire.KnownPeer
+	RenamePeer(id, name string) error
+	RevokePeer(id string) error
+	AcceptKeyChange(addr, id string) error
+	Layout() (layout.Layout, error)
+	SaveLayout(l layout.Layout) error
+	RunLayout() error
+	SetRelativeMotion(on bool)
+	RelativeMotion() bool
+	Hotkeys() hotkey.Bindings
 }
@@ -2,8 +2,13 @@ package ui
 
 import (
 	"context"
+	"copy/internal/hotkey"
+	"copy/internal/layout"
 	"copy/internal/shared"
+	"copy/internal/wire"
 	"log"
+
+	wailsruntime "github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 type UI struct {
@@ -27,13 +32,136 @@ func (u *UI) ScanPeers() []string {
 	return u.app.FindReachableIPs(u.port)
 }
 
-// Called by frontend when user selects an IP
-func (u *UI) Connect(ip string) error {
+// Called by frontend when user selects an IP, code is the receiver's
+// pairing code and may be empty for peers we already paired with
+func (u *UI) Connect(ip string, code string) error {
 	log.Printf("[ui] Connecting to %s:%s", ip, u.port)
-	return u.app.RunControl(ip, u.port)
+	return u.app.RunControl(ip, u.port, code)
+}
+
+// WaitForPeer waits on addr for a receiver to connect out to us and
+// controls it, for receivers that cannot accept connections. code is the
+// receiver's pairing code and may be empty for peers we already paired with.
+// fingerprint is the receiver's, it may be empty for peers we already trust
+func (u *UI) WaitForPeer(addr string, code string, fingerprint string) error {
+	log.Printf("[ui] Waiting for a receiver on %s", addr)
+	return u.app.RunReverseControl(addr, code, fingerprint)
+}
+
+// ReverseListenAddr returns where to wait for receivers at startup, empty
+// unless set on the command line
+func (u *UI) ReverseListenAddr() string {
+	return u.app.ReverseListenAddr()
+}
+
+// DialOut makes this device connect out to the controller at addr, an
+// empty addr stops it
+func (u *UI) DialOut(addr string) error {
+	return u.app.DialOut(addr)
+}
+
+// DialOutTarget returns the controller this device connects out to, empty
+// when it does not
+func (u *UI) DialOutTarget() string {
+	return u.app.DialOutTarget()
+}
+
+// Cancel ends the control session started by Connect or WaitForPeer, also
+// while it is still connecting
+func (u *UI) Cancel() {
+	log.Printf("[ui] Cancelling control session")
+	u.app.CancelControl()
 }
 
 // Optional: expose local IP
 func (u *UI) LocalIP() string {
 	return shared.GetLocalIP()
 }
+
+// LocalFingerprint exposes this device's certificate fingerprint so users can
+// compare it with what the peer displays
+func (u *UI) LocalFingerprint() string {
+	return u.app.LocalFingerprint()
+}
+
+// PairingCode returns the code a controller must enter to pair with us
+func (u *UI) PairingCode() string {
+	return u.app.PairingCode()
+}
+
+// Sessions lists the controllers currently connected to this device
+func (u *UI) Sessions() []wire.SessionInfo {
+	return u.app.Sessions()
+}
+
+// HandOver gives control of this device to the waiting controller of
+// session id
+func (u *UI) HandOver(id uint64) error {
+	return u.app.HandOver(id)
+}
+
+// FloorHolder returns the session currently controlling this device, 0
+// when none does
+func (u *UI) FloorHolder() uint64 {
+	return u.app.FloorHolder()
+}
+
+// KnownPeers lists the devices whose identity this device trusts
+func (u *UI) KnownPeers() []wire.KnownPeer {
+	return u.app.KnownPeers()
+}
+
+// RenamePeer gives a known device a friendly name
+func (u *UI) RenamePeer(id string, name string) error {
+	return u.app.RenamePeer(id, name)
+}
+
+// RevokePeer stops trusting a known device, it has to pair again
+func (u *UI) RevokePeer(id string) error {
+	return u.app.RevokePeer(id)
+}
+
+// AcceptKeyChange trusts a new key at an address that belonged to another
+// known device
+func (u *UI) AcceptKeyChange(addr string, id string) error {
+	return u.app.AcceptKeyChange(addr, id)
+}
+
+// Layout returns the saved screen layout
+func (u *UI) Layout() (layout.Layout, error) {
+	return u.app.Layout()
+}
+
+// SaveLayout stores the screen layout edited in the UI
+func (u *UI) SaveLayout(l layout.Layout) error {
+	return u.app.SaveLayout(l)
+}
+
+// ConnectLayout controls every receiver of the saved layout at once
+func (u *UI) ConnectLayout() error {
+	return u.app.RunLayout()
+}
+
+// SetRelativeMotion chooses whether the receiver's pointer moves by deltas,
+// for games and apps that lock the pointer
+func (u *UI) SetRelativeMotion(on bool) {
+	u.app.SetRelativeMotion(on)
+}
+
+// RelativeMotion reports whether the receiver's pointer moves by deltas
+func (u *UI) RelativeMotion() bool {
+	return u.app.RelativeMotion()
+}
+
+// Hotkeys lists the hotkeys control sessions catch and their actions
+func (u *UI) Hotkeys() hotkey.Bindings {
+	return u.app.Hotkeys()
+}
+
+// Emit forwards an event to the frontend, it is a no-op until the UI started
+func (u *UI) Emit(event string, data ...interface{}) {
+	if u == nil || u.ctx == nil {
+		return
+	}
+	wailsruntime.EventsEmit(u.ctx, event, data...)
+}
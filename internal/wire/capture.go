@@ -0,0 +1,254 @@
+package wire
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Capture files start with captureMagic and a length prefixed JSON
+// CaptureHeader. Each record is then the microseconds since the previous
+// record, the direction and a length prefixed message in the binary codec,
+// all lengths and times as uvarints
+const captureMagic = "IOCAP\x01"
+
+// Direction tells whether a recorded message was received or sent
+type Direction byte
+
+const (
+	DirIn Direction = iota + 1
+	DirOut
+)
+
+func (d Direction) String() string {
+	switch d {
+	case DirIn:
+		return "in"
+	case DirOut:
+		return "out"
+	default:
+		return fmt.Sprintf("dir(%d)", byte(d))
+	}
+}
+
+// Capture roles
+const (
+	RoleController = "controller"
+	RoleReceiver   = "receiver"
+)
+
+// CaptureHeader describes the session a capture was taken from
+type CaptureHeader struct {
+	Role    string    `json:"role"`
+	Peer    string    `json:"peer"`
+	Start   time.Time `json:"start"`
+	Session *Session  `json:"session,omitempty"`
+}
+
+// Recorder writes messages to a capture file. A nil Recorder records
+// nothing, so callers need not check whether recording is enabled
+type Recorder struct {
+	mu   sync.Mutex
+	file io.WriteCloser
+	w    *bufio.Writer
+	err  error
+
+	start time.Time
+	last  int64 // Microseconds since start of the previous record
+}
+
+// CreateRecorder creates a capture file at path
+func CreateRecorder(path string, header CaptureHeader) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create capture: %w", err)
+	}
+	r, err := NewRecorder(file, header)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// NewRecorder writes the capture header to w and returns a recorder for the
+// session's messages
+func NewRecorder(w io.WriteCloser, header CaptureHeader) (*Recorder, error) {
+	if header.Start.IsZero() {
+		header.Start = time.Now()
+	}
+	data, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{
+		file:  w,
+		w:     bufio.NewWriter(w),
+		start: header.Start,
+	}
+	r.w.WriteString(captureMagic)
+	r.w.Write(binary.AppendUvarint(nil, uint64(len(data))))
+	r.w.Write(data)
+	if err := r.w.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write capture header: %w", err)
+	}
+	return r, nil
+}
+
+// Record appends msg to the capture. The first write error is logged and
+// ends recording, it never disturbs the session
+func (r *Recorder) Record(dir Direction, msg *Message) {
+	if r == nil {
+		return
+	}
+	data, err := BinaryCodec.Marshal(msg)
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+
+	at := max(time.Since(r.start).Microseconds(), r.last)
+	buf := binary.AppendUvarint(nil, uint64(at-r.last))
+	r.last = at
+	buf = append(buf, byte(dir))
+	buf = binary.AppendUvarint(buf, uint64(len(data)))
+	r.w.Write(buf)
+	r.w.Write(data)
+
+	// Flush every record so a capture survives the crash it is meant to
+	// explain
+	if err := r.w.Flush(); err != nil {
+		r.err = err
+		log.Printf("[wire] Recording stopped: %v", err)
+	}
+}
+
+// Close flushes and closes the capture
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if errors.Is(r.err, os.ErrClosed) {
+		return nil
+	}
+
+	err := r.err
+	if err == nil {
+		err = r.w.Flush()
+	}
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	r.err = os.ErrClosed
+	return err
+}
+
+// Record is one message read back from a capture
+type Record struct {
+	At  time.Duration // Since the start of the capture
+	Dir Direction
+	Msg *Message
+}
+
+// CaptureReader reads a capture file written by a Recorder
+type CaptureReader struct {
+	file   io.Closer
+	r      *bufio.Reader
+	header CaptureHeader
+	at     time.Duration
+}
+
+// OpenCapture opens the capture at path and reads its header
+func OpenCapture(path string) (*CaptureReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	cr := &CaptureReader{file: file, r: bufio.NewReader(file)}
+
+	magic := make([]byte, len(captureMagic))
+	if _, err := io.ReadFull(cr.r, magic); err != nil || string(magic) != captureMagic {
+		file.Close()
+		return nil, fmt.Errorf("%s is not a capture file", path)
+	}
+	data, err := cr.readChunk()
+	if err == nil {
+		err = json.Unmarshal(data, &cr.header)
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("malformed capture header: %w", err)
+	}
+	return cr, nil
+}
+
+// Header returns the description of the captured session
+func (cr *CaptureReader) Header() CaptureHeader {
+	return cr.header
+}
+
+// Next returns the next record, io.EOF after the last one
+func (cr *CaptureReader) Next() (*Record, error) {
+	delta, err := binary.ReadUvarint(cr.r)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := cr.r.ReadByte()
+	if err != nil {
+		return nil, truncated(err)
+	}
+	data, err := cr.readChunk()
+	if err != nil {
+		return nil, truncated(err)
+	}
+
+	var msg Message
+	if err := BinaryCodec.Unmarshal(data, &msg); err != nil {
+		return nil, &MalformedPayloadError{Err: err}
+	}
+	cr.at += time.Duration(delta) * time.Microsecond
+	return &Record{At: cr.at, Dir: Direction(dir), Msg: &msg}, nil
+}
+
+// Close closes the capture file
+func (cr *CaptureReader) Close() error {
+	return cr.file.Close()
+}
+
+func (cr *CaptureReader) readChunk() ([]byte, error) {
+	n, err := binary.ReadUvarint(cr.r)
+	if err != nil {
+		return nil, err
+	}
+	if n > DefaultMaxFrameSize {
+		return nil, &FrameTooLargeError{Size: uint32(min(n, uint64(^uint32(0)))), Limit: DefaultMaxFrameSize}
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(cr.r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// truncated reports a capture cut off mid-record, as left by a crash
+func truncated(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,169 @@
+package wire
+
+import (
+	"copy/internal/model"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCaptureRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.iocap")
+	header := CaptureHeader{
+		Role:    RoleController,
+		Peer:    "desk",
+		Start:   time.Now().Add(-time.Second).Round(0),
+		Session: &Session{Version: 1, Capabilities: []string{"binary"}},
+	}
+	rec, err := CreateRecorder(path, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := &model.InputEvent{Type: model.EventMouseMove, MouseMove: &model.MouseMoveEvent{X: 3, Y: 4}}
+	records := []struct {
+		dir Direction
+		msg *Message
+	}{
+		{DirOut, &Message{Type: MsgControlStart}},
+		{DirIn, &Message{Type: MsgControlAck, Data: `{"accepted":true}`}},
+		{DirOut, &Message{Type: MsgInputEvent, Event: event}},
+		{DirIn, &Message{Type: MsgPong, Data: "1700000000"}},
+	}
+	for _, r := range records {
+		rec.Record(r.dir, r.msg)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Close(); err != nil {
+		t.Errorf("second close: %v", err)
+	}
+	rec.Record(DirOut, &Message{Type: MsgPing}) // Dropped after close
+
+	cr, err := OpenCapture(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cr.Close()
+	got := cr.Header()
+	if got.Role != header.Role || got.Peer != header.Peer || !got.Start.Equal(header.Start) || !reflect.DeepEqual(got.Session, header.Session) {
+		t.Errorf("header %+v, want %+v", got, header)
+	}
+
+	var last time.Duration
+	for i, want := range records {
+		r, err := cr.Next()
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+		if r.Dir != want.dir || !reflect.DeepEqual(r.Msg, want.msg) {
+			t.Errorf("record %d: %s %+v, want %s %+v", i, r.Dir, r.Msg, want.dir, want.msg)
+		}
+		if r.At < last || r.At < time.Second {
+			t.Errorf("record %d at %s after %s, want monotonic from the header start", i, r.At, last)
+		}
+		last = r.At
+	}
+	if _, err := cr.Next(); err != io.EOF {
+		t.Errorf("after last record: %v, want EOF", err)
+	}
+}
+
+func TestCaptureDamaged(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "full.iocap")
+	rec, err := CreateRecorder(path, CaptureHeader{Role: RoleReceiver})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.Record(DirIn, &Message{Type: MsgControlStart})
+	rec.Record(DirIn, &Message{Type: MsgPing, Data: "1700000001"})
+	rec.Close()
+	full, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		openErr  bool
+		complete int
+		wantErr  error
+	}{
+		{"intact", full, false, 2, io.EOF},
+		{"cut mid-record", full[:len(full)-3], false, 1, io.ErrUnexpectedEOF},
+		{"not a capture", []byte("hello world"), true, 0, nil},
+		{"empty", nil, true, 0, nil},
+		{"cut in header", full[:len(captureMagic)+3], true, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".iocap")
+			if err := os.WriteFile(path, tt.data, 0600); err != nil {
+				t.Fatal(err)
+			}
+			cr, err := OpenCapture(path)
+			if tt.openErr {
+				if err == nil {
+					cr.Close()
+					t.Fatal("opened")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cr.Close()
+			for i := range tt.complete {
+				if _, err := cr.Next(); err != nil {
+					t.Fatalf("record %d: %v", i, err)
+				}
+			}
+			if _, err := cr.Next(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateRecorderExisting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "taken.iocap")
+	if err := os.WriteFile(path, []byte("keep"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if rec, err := CreateRecorder(path, CaptureHeader{}); err == nil {
+		rec.Close()
+		t.Fatal("overwrote an existing file")
+	}
+}
+
+func TestNilRecorder(t *testing.T) {
+	var rec *Recorder
+	rec.Record(DirOut, &Message{Type: MsgPing})
+	if err := rec.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDirectionString(t *testing.T) {
+	tests := []struct {
+		dir  Direction
+		want string
+	}{
+		{DirIn, "in"},
+		{DirOut, "out"},
+		{Direction(9), "dir(9)"},
+	}
+	for _, tt := range tests {
+		if got := tt.dir.String(); got != tt.want {
+			t.Errorf("%d: got %q, want %q", byte(tt.dir), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+var errDeadlineExceeded = os.ErrDeadlineExceeded
+
+// Channel is one logical stream of a Mux. It implements net.Conn so it can
+// be wrapped in a Conn like any other connection
+type Channel struct {
+	mux      *Mux
+	id       uint16
+	name     string
+	priority Priority
+
+	mu           sync.Mutex
+	buf          bytes.Buffer
+	unacked      uint32 // bytes read since the last window update
+	window       uint32 // bytes we may still send
+	localClosed  bool
+	remoteClosed bool
+
+	readable      chan struct{}
+	writable      chan struct{}
+	readDeadline  deadline
+	writeDeadline deadline
+	closeOnce     sync.Once
+}
+
+func newChannel(m *Mux, id uint16, name string, priority Priority) *Channel {
+	return &Channel{
+		mux:           m,
+		id:            id,
+		name:          name,
+		priority:      priority,
+		window:        initialWindow,
+		readable:      make(chan struct{}, 1),
+		writable:      make(chan struct{}, 1),
+		readDeadline:  makeDeadline(),
+		writeDeadline: makeDeadline(),
+	}
+}
+
+// Name returns the name the channel was opened with
+func (c *Channel) Name() string {
+	return c.name
+}
+
+// Priority returns the channel's priority
+func (c *Channel) Priority() Priority {
+	return c.priority
+}
+
+// Read reads data sent by the peer on this channel, granting the peer more
+// send window as it goes
+func (c *Channel) Read(b []byte) (int, error) {
+	for {
+		c.mu.Lock()
+		if c.buf.Len() > 0 {
+			n, _ := c.buf.Read(b)
+			c.unacked += uint32(n)
+			var grant uint32
+			if c.unacked >= initialWindow/2 && !c.remoteClosed {
+				grant, c.unacked = c.unacked, 0
+			}
+			c.mu.Unlock()
+
+			if grant > 0 {
+				c.mux.enqueue(c.priority, muxWindow, c.id, binary.BigEndian.AppendUint32(nil, grant))
+			}
+			return n, nil
+		}
+		switch {
+		case c.localClosed:
+			c.mu.Unlock()
+			return 0, net.ErrClosed
+		case c.remoteClosed:
+			c.mu.Unlock()
+			return 0, io.EOF
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-c.readable:
+		case <-c.readDeadline.wait():
+			return 0, errDeadlineExceeded
+		case <-c.mux.done:
+			return 0, c.mux.err
+		}
+	}
+}
+
+// Write sends b in chunks, waiting for window when the peer is not keeping
+// up. Concurrent writers must serialize, as Conn does
+func (c *Channel) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		c.mu.Lock()
+		switch {
+		case c.localClosed:
+			c.mu.Unlock()
+			return written, net.ErrClosed
+		case c.remoteClosed:
+			c.mu.Unlock()
+			return written, io.ErrClosedPipe
+		}
+		n := min(len(b), maxChunk, int(c.window))
+		if n == 0 {
+			c.mu.Unlock()
+			select {
+			case <-c.writable:
+			case <-c.writeDeadline.wait():
+				return written, errDeadlineExceeded
+			case <-c.mux.done:
+				return written, c.mux.err
+			}
+			continue
+		}
+		c.window -= uint32(n)
+		c.mu.Unlock()
+
+		if err := c.mux.send(c.priority, muxData, c.id, b[:n], c.writeDeadline.wait()); err != nil {
+			return written, err
+		}
+		written += n
+		b = b[n:]
+	}
+	return written, nil
+}
+
+// Close closes the channel, the peer reads io.EOF once it has consumed
+// what was already sent
+func (c *Channel) Close() error {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.localClosed = true
+		c.mu.Unlock()
+
+		c.mux.remove(c.id)
+		c.mux.enqueue(c.priority, muxClose, c.id, nil)
+		signal(c.readable)
+		signal(c.writable)
+	})
+	return nil
+}
+
+func (c *Channel) LocalAddr() net.Addr {
+	return c.mux.conn.LocalAddr()
+}
+
+func (c *Channel) RemoteAddr() net.Addr {
+	return c.mux.conn.RemoteAddr()
+}
+
+func (c *Channel) SetDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+	return nil
+}
+
+func (c *Channel) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+func (c *Channel) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
+	return nil
+}
+
+// deliver buffers data received from the peer. A peer that sends past the
+// window it was granted is breaking the protocol
+func (c *Channel) deliver(data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.localClosed {
+		return nil
+	}
+	if c.buf.Len()+len(data) > initialWindow {
+		return &MalformedPayloadError{Err: fmt.Errorf("channel %s overran its window", c.name)}
+	}
+	c.buf.Write(data)
+	signal(c.readable)
+	return nil
+}
+
+func (c *Channel) grant(n uint32) {
+	c.mu.Lock()
+	c.window += n
+	c.mu.Unlock()
+	signal(c.writable)
+}
+
+func (c *Channel) remoteClose() {
+	c.mu.Lock()
+	c.remoteClosed = true
+	c.mu.Unlock()
+	signal(c.readable)
+	signal(c.writable)
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// deadline is a settable deadline whose wait channel is closed once it
+// passes, the same approach net.Pipe uses
+type deadline struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{}
+}
+
+func makeDeadline() deadline {
+	return deadline{cancel: make(chan struct{})}
+}
+
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		// The timer fired, wait for it to close cancel
+		<-d.cancel
+	}
+	d.timer = nil
+
+	closed := isClosed(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() {
+			close(cancel)
+		})
+		return
+	}
+
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+func (d *deadline) wait() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -1,43 +1,146 @@
 package wire
 
 import (
+	"context"
+	"crypto/tls"
 	"net"
+	"time"
 )
 
+// DefaultDialTimeout bounds connecting to a peer that does not answer
+const DefaultDialTimeout = 5 * time.Second
+
+// Client is the controller side of a connection
 type Client struct {
-	conn net.Conn
+	*Conn
+	raw net.Conn
+	mux *Mux
 }
 
-func NewClient(ip, port string) (*Client, error) {
-	conn, err := connect(net.JoinHostPort(ip, port))
-	if err != nil {
-		return nil, err
+// Dialer opens client connections
+type Dialer struct {
+	// Security wraps connections in TLS unless nil or insecure
+	Security *Security
+	// Timeout bounds opening the stream, DefaultDialTimeout when zero
+	Timeout time.Duration
+	// HandshakeTimeout bounds the TLS handshake, HandshakeTimeout when
+	// zero
+	HandshakeTimeout time.Duration
+	// DialContext, if set, opens the stream instead of a direct TCP
+	// connection, for example through a relay. TLS still runs end to end
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// Dial connects to host:port and runs the TLS handshake. host may also be a
+// ws:// or wss:// address to carry the connection over WebSocket, port is
+// then the default when the address has none. Cancelling ctx abandons the
+// attempt at any point
+func (d *Dialer) Dial(ctx context.Context, host, port string) (*Client, error) {
+	timeout := d.Timeout
+	if timeout <= 0 {
+		timeout = DefaultDialTimeout
+	}
+	dial := d.DialContext
+	if dial == nil {
+		var dialer net.Dialer
+		dial = dialer.DialContext
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var conn net.Conn
+	var err error
+	tlsInside := d.Security.enabled()
+	if IsWebSocketAddr(host) {
+		u, err := parseWebSocketAddr(host, port)
+		if err != nil {
+			return nil, err
+		}
+		conn, err = d.dialWebSocket(dialCtx, u, dial)
+		if err != nil {
+			return nil, err
+		}
+		host = u.Hostname()
+		tlsInside = tlsInside && u.Scheme == schemeWS
+	} else {
+		conn, err = dial(dialCtx, "tcp", net.JoinHostPort(host, port))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return d.client(ctx, conn, host, tlsInside)
+}
+
+// Handshake sets up the client side on conn, a stream the peer opened to us
+// in reverse mode, as if we had dialed it. host is the peer's address, its
+// key is pinned under it. conn is closed when the handshake fails
+func (d *Dialer) Handshake(ctx context.Context, conn net.Conn, host string) (*Client, error) {
+	return d.client(ctx, conn, host, d.Security.enabled())
+}
+
+func (d *Dialer) client(ctx context.Context, conn net.Conn, host string, tlsInside bool) (*Client, error) {
+	if tlsInside {
+		conn = tls.Client(conn, d.Security.clientConfig(host))
+		if err := handshake(ctx, conn, d.HandshakeTimeout); err != nil {
+			conn.Close()
+			return nil, err
+		}
 	}
 
 	return &Client{
-		conn: conn,
+		Conn: NewConn(conn),
+		raw:  conn,
 	}, nil
 }
 
-// Read reads a message from the connection
-func (c *Client) Read() (*Message, error) {
-	var msg Message
-	if err := Receive(c.conn, &msg); err != nil {
-		return nil, err
-	}
-	return &msg, nil
+// NewClient dials host:port with the default timeout, wrapping the
+// connection in TLS unless sec is nil or insecure
+func NewClient(ctx context.Context, host, port string, sec *Security) (*Client, error) {
+	d := Dialer{Security: sec}
+	return d.Dial(ctx, host, port)
 }
 
-// Write sends a message to the connection
-func (c *Client) Write(msg *Message) error {
-	return Send(c.conn, msg)
+// PeerFingerprint returns the fingerprint of the server certificate, empty
+// for plaintext connections
+func (c *Client) PeerFingerprint() string {
+	return PeerFingerprint(c.raw)
 }
 
-// Close closes the connection
-func (c *Client) Close() error {
-	return c.conn.Close()
+// Multiplex starts multiplexing the connection and moves Read and Write to
+// a new channel called name, keeping the codec, limits and compression
+// threshold. Compression starts afresh on the channel. Other channels
+// can then be opened through Mux. Call it before StartHeartbeat
+func (c *Client) Multiplex(name string, priority Priority) error {
+	mux := NewMux(c.raw, true)
+	ch, err := mux.Open(name, priority)
+	if err != nil {
+		mux.Close()
+		return err
+	}
+
+	conn := NewConn(ch)
+	conn.SetCodec(c.codec)
+	conn.SetLimits(c.limits)
+	conn.SetRecorder(c.rec)
+	if c.comp != nil {
+		conn.SetCompression(c.comp.threshold)
+	}
+	c.Conn = conn
+	c.mux = mux
+	return nil
+}
+
+// Mux returns the multiplexer, nil until Multiplex was called
+func (c *Client) Mux() *Mux {
+	return c.mux
 }
 
-func connect(addr string) (net.Conn, error) {
-	return net.Dial("tcp", addr)
+// Close closes the connection, including every multiplexed channel
+func (c *Client) Close() error {
+	err := c.Conn.Close()
+	if c.mux != nil {
+		c.mux.Close()
+	}
+	return err
 }
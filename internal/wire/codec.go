@@ -0,0 +1,61 @@
+package wire
+
+import "encoding/json"
+
+// Codec encodes messages into frame payloads. Every connection starts with
+// the JSON codec, the hello exchange may switch it to a more compact one
+type Codec interface {
+	Name() string
+	Marshal(msg *Message) ([]byte, error)
+	Unmarshal(data []byte, msg *Message) error
+}
+
+const (
+	CodecJSON   = "json"
+	CodecBinary = "binary"
+
+	// CapBinaryCodec is advertised in the hello by peers that can decode
+	// the binary codec
+	CapBinaryCodec = "codec_binary"
+)
+
+var (
+	JSONCodec   Codec = jsonCodec{}
+	BinaryCodec Codec = binaryCodec{}
+)
+
+// CodecByName returns the codec called name, or nil if there is none
+func CodecByName(name string) Codec {
+	switch name {
+	case CodecJSON:
+		return JSONCodec
+	case CodecBinary:
+		return BinaryCodec
+	default:
+		return nil
+	}
+}
+
+// NegotiatedCodec picks the most compact codec both peers of session support
+func NegotiatedCodec(session *Session) Codec {
+	if session.Supports(CapBinaryCodec) {
+		return BinaryCodec
+	}
+	return JSONCodec
+}
+
+// jsonCodec encodes whole messages as JSON, it is human readable and handy
+// for debugging
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return CodecJSON
+}
+
+func (jsonCodec) Marshal(msg *Message) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+func (jsonCodec) Unmarshal(data []byte, msg *Message) error {
+	return json.Unmarshal(data, msg)
+}
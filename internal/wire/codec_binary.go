@@ -0,0 +1,328 @@
+package wire
+
+import (
+	"copy/internal/model"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Binary frames start with frameTagEvent. JSON frames always start with '{',
+// so the binary codec can still decode every other message as JSON
+const frameTagEvent = 0x01
+
+const (
+	binKeyboard byte = iota + 1
+	binMouseMove
+	binMouseClick
+	binMouseScroll
+	binMouseMoveNormalized
+	binMouseRelative
+)
+
+// relativeScale is how many steps of a relative motion delta make a pixel
+// in the binary layout
+const relativeScale = 256
+
+// errNotEncodable marks events carrying values the compact layout has no
+// code for, those are sent as JSON instead
+var errNotEncodable = errors.New("event not representable in binary layout")
+
+var binaryActions = []string{"press", "release", "double"}
+
+var binaryButtons = []string{"left", "right", "middle"}
+
+var binaryModifiers = []string{"ctrl", "shift", "alt", "meta"}
+
+// binaryKeys maps key names to compact codes (index + 1, 0 means the name
+// follows as a string). Only ever append to this list, existing indexes are
+// part of the protocol
+var binaryKeys = []string{
+	"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l", "m",
+	"n", "o", "p", "q", "r", "s", "t", "u", "v", "w", "x", "y", "z",
+	"0", "1", "2", "3", "4", "5", "6", "7", "8", "9",
+	"Return", "Escape", "Tab", "space", "BackSpace", "Delete",
+	"Control_L", "Control_R", "Shift_L", "Shift_R", "Alt_L", "Alt_R", "Super_L", "Super_R",
+	"Up", "Down", "Left", "Right", "Home", "End", "Page_Up", "Page_Down", "Insert", "Caps_Lock",
+	"F1", "F2", "F3", "F4", "F5", "F6", "F7", "F8", "F9", "F10", "F11", "F12",
+}
+
+var binaryKeyCodes = func() map[string]uint64 {
+	codes := make(map[string]uint64, len(binaryKeys))
+	for i, key := range binaryKeys {
+		codes[key] = uint64(i + 1)
+	}
+	return codes
+}()
+
+// binaryCodec packs input events into fixed layouts with varint coordinates
+// and key codes, other messages stay JSON
+type binaryCodec struct{}
+
+func (binaryCodec) Name() string {
+	return CodecBinary
+}
+
+func (binaryCodec) Marshal(msg *Message) ([]byte, error) {
+	if msg.Type != MsgInputEvent || msg.Event == nil || msg.Data != "" {
+		return json.Marshal(msg)
+	}
+
+	data, err := appendEvent([]byte{frameTagEvent}, msg.Event)
+	if errors.Is(err, errNotEncodable) {
+		return json.Marshal(msg)
+	}
+	return data, err
+}
+
+func (binaryCodec) Unmarshal(data []byte, msg *Message) error {
+	if len(data) == 0 || data[0] != frameTagEvent {
+		return json.Unmarshal(data, msg)
+	}
+
+	event, err := decodeEvent(data[1:])
+	if err != nil {
+		return err
+	}
+	*msg = Message{Type: MsgInputEvent, Event: event}
+	return nil
+}
+
+func appendEvent(buf []byte, event *model.InputEvent) ([]byte, error) {
+	switch event.Type {
+	case model.EventKeyboard:
+		kb := event.Keyboard
+		if kb == nil {
+			return nil, errNotEncodable
+		}
+		action, ok := indexOf(binaryActions, kb.Action)
+		if !ok {
+			return nil, errNotEncodable
+		}
+		var mods byte
+		for _, m := range kb.Modifiers {
+			bit, ok := indexOf(binaryModifiers, m)
+			if !ok {
+				return nil, errNotEncodable
+			}
+			mods |= 1 << bit
+		}
+		buf = append(buf, binKeyboard, byte(action), mods)
+		code := binaryKeyCodes[kb.Key]
+		buf = binary.AppendUvarint(buf, code)
+		if code == 0 {
+			buf = binary.AppendUvarint(buf, uint64(len(kb.Key)))
+			buf = append(buf, kb.Key...)
+		}
+		return buf, nil
+
+	case model.EventMouseMove:
+		mv := event.MouseMove
+		if mv == nil {
+			return nil, errNotEncodable
+		}
+		kind := binMouseMove
+		if mv.Normalized {
+			kind = binMouseMoveNormalized
+		}
+		buf = append(buf, kind)
+		buf = binary.AppendVarint(buf, int64(mv.X))
+		return binary.AppendVarint(buf, int64(mv.Y)), nil
+
+	case model.EventMouseClick:
+		cl := event.MouseClick
+		if cl == nil {
+			return nil, errNotEncodable
+		}
+		button, ok := indexOf(binaryButtons, cl.Button)
+		if !ok {
+			return nil, errNotEncodable
+		}
+		action, ok := indexOf(binaryActions, cl.Action)
+		if !ok {
+			return nil, errNotEncodable
+		}
+		var flags byte
+		if cl.IsDouble {
+			flags |= 1
+		}
+		if cl.Normalized {
+			flags |= 2
+		}
+		buf = append(buf, binMouseClick, byte(button), byte(action), flags)
+		buf = binary.AppendVarint(buf, int64(cl.X))
+		return binary.AppendVarint(buf, int64(cl.Y)), nil
+
+	case model.EventMouseRelative:
+		rel := event.MouseRelative
+		if rel == nil {
+			return nil, errNotEncodable
+		}
+		buf = append(buf, binMouseRelative)
+		buf = binary.AppendVarint(buf, int64(math.Round(rel.DX*relativeScale)))
+		return binary.AppendVarint(buf, int64(math.Round(rel.DY*relativeScale))), nil
+
+	case model.EventMouseScroll:
+		sc := event.MouseScroll
+		if sc == nil {
+			return nil, errNotEncodable
+		}
+		buf = append(buf, binMouseScroll)
+		buf = binary.AppendVarint(buf, int64(sc.DeltaX))
+		return binary.AppendVarint(buf, int64(sc.DeltaY)), nil
+
+	default:
+		return nil, errNotEncodable
+	}
+}
+
+func decodeEvent(data []byte) (*model.InputEvent, error) {
+	r := &byteReader{data: data}
+	kind := r.byte()
+
+	var event *model.InputEvent
+	switch kind {
+	case binKeyboard:
+		action := lookup(binaryActions, r.byte(), r)
+		mods := r.byte()
+		var modifiers []string
+		for bit, name := range binaryModifiers {
+			if mods&(1<<bit) != 0 {
+				modifiers = append(modifiers, name)
+			}
+		}
+		var key string
+		if code := r.uvarint(); code == 0 {
+			key = string(r.bytes(int(r.uvarint())))
+		} else if code <= uint64(len(binaryKeys)) {
+			key = binaryKeys[code-1]
+		} else {
+			r.fail(fmt.Errorf("unknown key code %d", code))
+		}
+		event = &model.InputEvent{
+			Type:     model.EventKeyboard,
+			Keyboard: &model.KeyboardEvent{Key: key, Action: action, Modifiers: modifiers},
+		}
+
+	case binMouseMove, binMouseMoveNormalized:
+		x, y := r.varint(), r.varint()
+		event = &model.InputEvent{
+			Type:      model.EventMouseMove,
+			MouseMove: &model.MouseMoveEvent{X: x, Y: y, Normalized: kind == binMouseMoveNormalized},
+		}
+
+	case binMouseClick:
+		button := lookup(binaryButtons, r.byte(), r)
+		action := lookup(binaryActions, r.byte(), r)
+		flags := r.byte()
+		x, y := r.varint(), r.varint()
+		event = &model.InputEvent{
+			Type: model.EventMouseClick,
+			MouseClick: &model.MouseClickEvent{
+				Button:     button,
+				Action:     action,
+				X:          x,
+				Y:          y,
+				IsDouble:   flags&1 != 0,
+				Normalized: flags&2 != 0,
+			},
+		}
+
+	case binMouseRelative:
+		dx, dy := r.varint(), r.varint()
+		event = &model.InputEvent{
+			Type:          model.EventMouseRelative,
+			MouseRelative: &model.MouseRelativeEvent{DX: float64(dx) / relativeScale, DY: float64(dy) / relativeScale},
+		}
+
+	case binMouseScroll:
+		dx, dy := r.varint(), r.varint()
+		event = &model.InputEvent{
+			Type:        model.EventMouseScroll,
+			MouseScroll: &model.MouseScrollEvent{DeltaX: dx, DeltaY: dy},
+		}
+
+	default:
+		r.fail(fmt.Errorf("unknown binary event kind %d", kind))
+	}
+
+	if r.err != nil {
+		return nil, fmt.Errorf("malformed binary event: %w", r.err)
+	}
+	if len(r.data) != 0 {
+		return nil, fmt.Errorf("malformed binary event: %d trailing bytes", len(r.data))
+	}
+	return event, nil
+}
+
+func indexOf(list []string, s string) (int, bool) {
+	for i, v := range list {
+		if v == s {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func lookup(list []string, i byte, r *byteReader) string {
+	if int(i) >= len(list) {
+		r.fail(fmt.Errorf("value %d out of range", i))
+		return ""
+	}
+	return list[i]
+}
+
+// byteReader decodes a binary event, remembering the first error so the
+// decoder can read a whole layout before checking
+type byteReader struct {
+	data []byte
+	err  error
+}
+
+func (r *byteReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *byteReader) byte() byte {
+	if len(r.data) < 1 {
+		r.fail(errors.New("unexpected end of event"))
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+func (r *byteReader) bytes(n int) []byte {
+	if n < 0 || len(r.data) < n {
+		r.fail(errors.New("unexpected end of event"))
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *byteReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.fail(errors.New("bad uvarint"))
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *byteReader) varint() int {
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.fail(errors.New("bad varint"))
+		return 0
+	}
+	r.data = r.data[n:]
+	return int(v)
+}
@@ -0,0 +1,145 @@
+package wire
+
+import (
+	"copy/internal/model"
+	"reflect"
+	"testing"
+)
+
+// codecEvents covers every binary layout, mixed the way a session sends
+// them: mostly moves, some clicks and keys, the odd scroll
+var codecEvents = []model.InputEvent{
+	{Type: model.EventMouseMove, MouseMove: &model.MouseMoveEvent{X: 640, Y: 480}},
+	{Type: model.EventMouseMove, MouseMove: &model.MouseMoveEvent{X: -1920, Y: 0}},
+	{Type: model.EventMouseMove, MouseMove: &model.MouseMoveEvent{X: 32767, Y: 65535, Normalized: true}},
+	{Type: model.EventMouseRelative, MouseRelative: &model.MouseRelativeEvent{DX: 1.5, DY: -0.25}},
+	{Type: model.EventMouseClick, MouseClick: &model.MouseClickEvent{Button: "left", Action: "press", X: 10, Y: 20}},
+	{Type: model.EventMouseClick, MouseClick: &model.MouseClickEvent{Button: "right", Action: "double", X: 1, Y: 2, IsDouble: true, Normalized: true}},
+	{Type: model.EventMouseScroll, MouseScroll: &model.MouseScrollEvent{DeltaX: -120, DeltaY: 240}},
+	{Type: model.EventKeyboard, Keyboard: &model.KeyboardEvent{Key: "a", Action: "press"}},
+	{Type: model.EventKeyboard, Keyboard: &model.KeyboardEvent{Key: "F12", Action: "release", Modifiers: []string{"ctrl", "shift", "alt", "meta"}}},
+	{Type: model.EventKeyboard, Keyboard: &model.KeyboardEvent{Key: "XF86AudioPlay", Action: "press", Modifiers: []string{"ctrl"}}},
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, codec := range []Codec{JSONCodec, BinaryCodec} {
+		for _, event := range codecEvents {
+			in := &Message{Type: MsgInputEvent, Event: &event}
+			data, err := codec.Marshal(in)
+			if err != nil {
+				t.Fatalf("%s: marshal %s: %v", codec.Name(), event.Type, err)
+			}
+			var out Message
+			if err := codec.Unmarshal(data, &out); err != nil {
+				t.Fatalf("%s: unmarshal %s: %v", codec.Name(), event.Type, err)
+			}
+			if !reflect.DeepEqual(&out, in) {
+				t.Errorf("%s: got %+v, want %+v", codec.Name(), out.Event, in.Event)
+			}
+		}
+	}
+}
+
+func TestBinaryCodecLayout(t *testing.T) {
+	tests := []struct {
+		name   string
+		msg    *Message
+		binary bool
+	}{
+		{"move", &Message{Type: MsgInputEvent, Event: &codecEvents[0]}, true},
+		{"keyboard", &Message{Type: MsgInputEvent, Event: &codecEvents[7]}, true},
+		{"control message", &Message{Type: MsgControlStart}, false},
+		{"payload alongside event", &Message{Type: MsgInputEvent, Data: `{"x":1}`, Event: &codecEvents[0]}, false},
+		{"text event", &Message{Type: MsgInputEvent, Event: &model.InputEvent{Type: model.EventText, Text: &model.TextEvent{Text: "hi"}}}, false},
+		{"unknown button", &Message{Type: MsgInputEvent, Event: &model.InputEvent{Type: model.EventMouseClick, MouseClick: &model.MouseClickEvent{Button: "back", Action: "press"}}}, false},
+		{"unknown action", &Message{Type: MsgInputEvent, Event: &model.InputEvent{Type: model.EventKeyboard, Keyboard: &model.KeyboardEvent{Key: "a", Action: "repeat"}}}, false},
+		{"unknown modifier", &Message{Type: MsgInputEvent, Event: &model.InputEvent{Type: model.EventKeyboard, Keyboard: &model.KeyboardEvent{Key: "a", Action: "press", Modifiers: []string{"hyper"}}}}, false},
+		{"missing body", &Message{Type: MsgInputEvent, Event: &model.InputEvent{Type: model.EventMouseMove}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := BinaryCodec.Marshal(tt.msg)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			if got := data[0] == frameTagEvent; got != tt.binary {
+				t.Fatalf("binary frame = %v, want %v (%q)", got, tt.binary, data)
+			}
+			var out Message
+			if err := BinaryCodec.Unmarshal(data, &out); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if !reflect.DeepEqual(&out, tt.msg) {
+				t.Errorf("got %+v, want %+v", out, tt.msg)
+			}
+		})
+	}
+}
+
+func TestBinaryCodecMalformed(t *testing.T) {
+	move, err := BinaryCodec.Marshal(&Message{Type: MsgInputEvent, Event: &codecEvents[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	named, err := BinaryCodec.Marshal(&Message{Type: MsgInputEvent, Event: &codecEvents[9]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"tag only", []byte{frameTagEvent}},
+		{"unknown kind", []byte{frameTagEvent, 0x7f, 0, 0}},
+		{"truncated move", move[:len(move)-1]},
+		{"trailing bytes", append(append([]byte{}, move...), 0)},
+		{"truncated key name", named[:len(named)-2]},
+		{"key code out of range", []byte{frameTagEvent, binKeyboard, 0, 0, 0x7f}},
+		{"action out of range", []byte{frameTagEvent, binKeyboard, 9, 0, 1}},
+		{"button out of range", []byte{frameTagEvent, binMouseClick, 9, 0, 0, 0, 0}},
+		{"unterminated varint", []byte{frameTagEvent, binMouseScroll, 0x80, 0x80}},
+		{"bad json", []byte(`{"type":`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out Message
+			if err := BinaryCodec.Unmarshal(tt.data, &out); err == nil {
+				t.Errorf("decoded %q as %+v, want error", tt.data, out)
+			}
+		})
+	}
+}
+
+func benchmarkCodec(b *testing.B, codec Codec) {
+	msgs := make([]*Message, len(codecEvents))
+	for i := range codecEvents {
+		msgs[i] = &Message{Type: MsgInputEvent, Event: &codecEvents[i]}
+	}
+
+	b.ReportAllocs()
+	var size int
+	for i := 0; i < b.N; i++ {
+		msg := msgs[i%len(msgs)]
+		data, err := codec.Marshal(msg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		size += len(data)
+		var out Message
+		if err := codec.Unmarshal(data, &out); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(size)/float64(b.N), "bytes/msg")
+}
+
+func BenchmarkJSONCodec(b *testing.B) {
+	benchmarkCodec(b, JSONCodec)
+}
+
+func BenchmarkBinaryCodec(b *testing.B) {
+	benchmarkCodec(b, BinaryCodec)
+}
@@ -0,0 +1,192 @@
+package wire
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+const (
+	// CapDeflate is advertised in the hello by peers that can inflate
+	// compressed frames
+	CapDeflate = "compress_deflate"
+
+	// DefaultCompressThreshold is the smallest encoded message worth
+	// compressing, input events stay well below it
+	DefaultCompressThreshold = 1024
+)
+
+// Compressed frames start with frameTagDeflate, then the size of the encoded
+// message as a uvarint and the deflate data. Codec output never starts with
+// it, so small messages can still go out uncompressed
+const frameTagDeflate = 0x02
+
+// maxInflateBacklog bounds the compressed bytes a frame may leave unread,
+// the flush marker and the end of the last block take a few. More means
+// the peer sent data that does not belong to the message
+const maxInflateBacklog = 16
+
+// errCompressionBroken is returned by writes after a compressed frame was
+// lost, the peer's window no longer matches ours
+var errCompressionBroken = errors.New("compressed stream broken by an earlier failed write")
+
+// CompressionStats counts the messages compressed in one direction
+type CompressionStats struct {
+	Messages int64
+	// Raw is the encoded size of those messages, Compressed what went over
+	// the wire for them
+	Raw        int64
+	Compressed int64
+}
+
+// Ratio returns the compressed size as a fraction of the raw size, 1 when
+// nothing was compressed
+func (s CompressionStats) Ratio() float64 {
+	if s.Raw == 0 {
+		return 1
+	}
+	return float64(s.Compressed) / float64(s.Raw)
+}
+
+func (s CompressionStats) String() string {
+	return fmt.Sprintf("%d messages, %d to %d bytes (%.0f%%)", s.Messages, s.Raw, s.Compressed, s.Ratio()*100)
+}
+
+type statsCounter struct {
+	messages   atomic.Int64
+	raw        atomic.Int64
+	compressed atomic.Int64
+}
+
+func (s *statsCounter) add(raw, compressed int) {
+	s.messages.Add(1)
+	s.raw.Add(int64(raw))
+	s.compressed.Add(int64(compressed))
+}
+
+func (s *statsCounter) snapshot() CompressionStats {
+	return CompressionStats{
+		Messages:   s.messages.Load(),
+		Raw:        s.raw.Load(),
+		Compressed: s.compressed.Load(),
+	}
+}
+
+// compression holds the deflate state of a stream. Each direction is one
+// deflate stream flushed after every compressed message, so later messages
+// reuse the window of earlier ones: a clipboard sent twice costs little
+// the second time. Frames must therefore be inflated in the order they
+// were deflated, which framing over a single stream guarantees
+type compression struct {
+	threshold int
+
+	// Write side, guarded by the Conn's write lock
+	out    bytes.Buffer
+	w      *flate.Writer
+	broken bool
+	sent   statsCounter
+
+	// Read side, only touched by the reading goroutine
+	in       bytes.Buffer
+	r        io.ReadCloser
+	received statsCounter
+}
+
+func newCompression(threshold int) *compression {
+	return &compression{threshold: threshold}
+}
+
+// wants reports whether data is large enough to be compressed
+func (c *compression) wants(data []byte) bool {
+	return len(data) >= c.threshold
+}
+
+// compress returns the compressed frame for data. The result is only valid
+// until the next call
+func (c *compression) compress(data []byte, maxSize uint32) ([]byte, error) {
+	if c.broken {
+		return nil, errCompressionBroken
+	}
+	// The peer refuses to inflate more than this, fail before the window
+	// moves on without it
+	if uint64(len(data)) > uint64(maxSize) {
+		return nil, &FrameTooLargeError{Size: uint32(min(len(data), int(^uint32(0)))), Limit: maxSize}
+	}
+
+	if c.w == nil {
+		w, err := flate.NewWriter(&c.out, flate.DefaultCompression)
+		if err != nil {
+			return nil, err
+		}
+		c.w = w
+	}
+
+	c.out.Reset()
+	c.out.WriteByte(frameTagDeflate)
+	var size [binary.MaxVarintLen64]byte
+	c.out.Write(size[:binary.PutUvarint(size[:], uint64(len(data)))])
+	if _, err := c.w.Write(data); err != nil {
+		c.broken = true
+		return nil, fmt.Errorf("failed to compress: %w", err)
+	}
+	if err := c.w.Flush(); err != nil {
+		c.broken = true
+		return nil, fmt.Errorf("failed to compress: %w", err)
+	}
+
+	c.sent.add(len(data), c.out.Len())
+	return c.out.Bytes(), nil
+}
+
+// lost marks the frame returned by the last compress as not sent
+func (c *compression) lost() {
+	c.broken = true
+}
+
+// decompress inflates a frame starting with frameTagDeflate. The declared
+// size is checked against maxSize before anything is inflated
+func (c *compression) decompress(frame []byte, maxSize uint32) ([]byte, error) {
+	size, n := binary.Uvarint(frame[1:])
+	if n <= 0 {
+		return nil, &MalformedPayloadError{Err: errors.New("compressed frame without size")}
+	}
+	if size > uint64(maxSize) {
+		return nil, &FrameTooLargeError{Size: uint32(min(size, uint64(^uint32(0)))), Limit: maxSize}
+	}
+
+	c.in.Write(frame[1+n:])
+	if c.r == nil {
+		c.r = flate.NewReader(&c.in)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return nil, &MalformedPayloadError{Err: fmt.Errorf("failed to inflate: %w", err)}
+	}
+	if c.in.Len() > maxInflateBacklog {
+		return nil, &MalformedPayloadError{Err: fmt.Errorf("compressed frame carries %d bytes past its message", c.in.Len())}
+	}
+
+	c.received.add(len(data), len(frame))
+	return data, nil
+}
+
+// SetCompression makes Write compress messages whose encoding is at least
+// threshold bytes and Read accept compressed messages. Both peers must have
+// negotiated CapDeflate, and the reading side must turn it on before the
+// first compressed message arrives. It cannot be turned off again
+func (c *Conn) SetCompression(threshold int) {
+	c.comp = newCompression(threshold)
+}
+
+// CompressionStats reports how much compression saved in each direction,
+// zero when compression is off
+func (c *Conn) CompressionStats() (sent, received CompressionStats) {
+	if c.comp == nil {
+		return CompressionStats{}, CompressionStats{}
+	}
+	return c.comp.sent.snapshot(), c.comp.received.snapshot()
+}
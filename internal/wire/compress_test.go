@@ -0,0 +1,161 @@
+package wire
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// deflateFrame compresses data on a fresh stream, declaring size instead of
+// its real length
+func deflateFrame(t *testing.T, data []byte, size uint64) []byte {
+	t.Helper()
+	frame, err := newCompression(0).compress(data, ^uint32(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, n := binary.Uvarint(frame[1:])
+	out := binary.AppendUvarint([]byte{frameTagDeflate}, size)
+	return append(out, frame[1+n:]...)
+}
+
+func TestCompressedConn(t *testing.T) {
+	a, b := tcpPair(t)
+	ca, cb := NewConn(a), NewConn(b)
+	ca.SetCompression(DefaultCompressThreshold)
+	cb.SetCompression(DefaultCompressThreshold)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	clipboard := strings.Repeat("the same clipboard text, again and again ", 200)
+	msgs := []*Message{
+		{Type: "custom", Data: "tiny"},
+		{Type: "clipboard", Data: clipboard},
+		{Type: "clipboard", Data: clipboard},
+		{Type: "control_ack", Data: "small again"},
+	}
+	go func() {
+		for _, msg := range msgs {
+			if ca.Write(ctx, msg) != nil {
+				return
+			}
+		}
+	}()
+	for i, want := range msgs {
+		got, err := cb.Read(ctx)
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		if got.Type != want.Type || got.Data != want.Data {
+			t.Fatalf("message %d came back as %s with %d bytes", i, got.Type, len(got.Data))
+		}
+	}
+
+	sent, _ := ca.CompressionStats()
+	_, received := cb.CompressionStats()
+	if sent.Messages != 2 || received.Messages != 2 {
+		t.Fatalf("compressed %d and inflated %d messages, want only the 2 large ones", sent.Messages, received.Messages)
+	}
+	if sent.Raw != received.Raw || sent.Ratio() >= 0.1 {
+		t.Errorf("sent %s, received %s", sent, received)
+	}
+}
+
+func TestCompressionWindow(t *testing.T) {
+	c := newCompression(0)
+	var data []byte
+	for i := range 400 {
+		data = strconv.AppendInt(data, int64(i*i*7919%100003), 10)
+	}
+	first, err := c.compress(data, DefaultMaxFrameSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstLen := len(first)
+	second, err := c.compress(data, DefaultMaxFrameSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The second copy refers back to the first through the shared window
+	if len(second) > firstLen/4 {
+		t.Errorf("repeat compressed to %d bytes, first copy took %d", len(second), firstLen)
+	}
+}
+
+func TestCompressLimits(t *testing.T) {
+	c := newCompression(0)
+	if _, err := c.compress(make([]byte, 100), 99); !isTooLarge(err) {
+		t.Fatalf("got %v, want FrameTooLargeError", err)
+	}
+	if _, err := c.compress(make([]byte, 10), 99); err != nil {
+		t.Fatalf("compress after refusing a large message: %v", err)
+	}
+
+	// A frame the peer never got desynchronizes the window for good
+	c.lost()
+	if _, err := c.compress(make([]byte, 10), 99); !errors.Is(err, errCompressionBroken) {
+		t.Errorf("compress after a lost frame: %v, want errCompressionBroken", err)
+	}
+}
+
+func TestDecompressMalformed(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 4096)
+	zeros := make([]byte, 1<<20)
+
+	tests := []struct {
+		name    string
+		frame   []byte
+		max     uint32
+		wantErr func(error) bool
+	}{
+		{"valid", deflateFrame(t, data, uint64(len(data))), 1 << 16, nil},
+		{"declared over limit", deflateFrame(t, data, uint64(len(data))), 1024, isTooLarge},
+		{"huge declared size", binary.AppendUvarint([]byte{frameTagDeflate}, 1<<40), DefaultMaxFrameSize, isTooLarge},
+		{"no size", []byte{frameTagDeflate}, 1 << 16, isMalformed},
+		{"declared larger than content", deflateFrame(t, data, uint64(len(data))+1), 1 << 16, isMalformed},
+		{"bomb under a small size", deflateFrame(t, zeros, 100), 1 << 16, isMalformed},
+		{"not deflate", append(binary.AppendUvarint([]byte{frameTagDeflate}, 10), 0xff, 0xff, 0xff), 1 << 16, isMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newCompression(0).decompress(tt.frame, tt.max)
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Fatalf("got %d bytes, %v", len(got), err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Error("inflated data differs")
+			}
+		})
+	}
+}
+
+func TestCompressionStats(t *testing.T) {
+	tests := []struct {
+		stats CompressionStats
+		ratio float64
+		str   string
+	}{
+		{CompressionStats{}, 1, "0 messages, 0 to 0 bytes (100%)"},
+		{CompressionStats{Messages: 2, Raw: 1000, Compressed: 250}, 0.25, "2 messages, 1000 to 250 bytes (25%)"},
+	}
+	for _, tt := range tests {
+		if got := tt.stats.Ratio(); got != tt.ratio {
+			t.Errorf("%+v: ratio %v, want %v", tt.stats, got, tt.ratio)
+		}
+		if got := tt.stats.String(); got != tt.str {
+			t.Errorf("got %q, want %q", got, tt.str)
+		}
+	}
+}
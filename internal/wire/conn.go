@@ -0,0 +1,225 @@
+package wire
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrPeerSilent is returned by Read when heartbeats are enabled and the peer
+// sent nothing within the configured timeout
+var ErrPeerSilent = errors.New("peer went silent")
+
+// Conn is a framed message connection. Writes are serialized so several
+// goroutines may send on it, and heartbeat traffic is handled transparently
+// by Read
+type Conn struct {
+	conn   net.Conn
+	codec  Codec
+	limits Limits
+	rec    *Recorder
+	comp   *compression
+	wmu    sync.Mutex
+
+	hbMu      sync.Mutex
+	heartbeat *heartbeat
+}
+
+// NewConn wraps conn, starting with the JSON codec and the default limits
+func NewConn(conn net.Conn) *Conn {
+	return &Conn{
+		conn:   conn,
+		codec:  JSONCodec,
+		limits: DefaultLimits(),
+	}
+}
+
+// SetCodec switches the codec used by Read and Write, typically to the one
+// negotiated in the hello exchange
+func (c *Conn) SetCodec(codec Codec) {
+	c.codec = codec
+}
+
+// SetLimits replaces the frame size limits and timeouts used by Read and
+// Write
+func (c *Conn) SetLimits(limits Limits) {
+	c.limits = limits
+}
+
+// SetRecorder records every application message read or written from now
+// on to rec. The conn closes rec when it is closed. Received input events
+// are left to the receiver to record once it has decided to execute them
+func (c *Conn) SetRecorder(rec *Recorder) {
+	c.rec = rec
+}
+
+// Recorder returns the session recorder, nil when not recording
+func (c *Conn) Recorder() *Recorder {
+	return c.rec
+}
+
+// NetConn returns the underlying network connection
+func (c *Conn) NetConn() net.Conn {
+	return c.conn
+}
+
+// RemoteAddr returns the address of the peer
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// Read reads the next application message, answering pings and consuming
+// pongs along the way. It returns ctx's error once ctx is done
+func (c *Conn) Read(ctx context.Context) (*Message, error) {
+	stop := interruptOnDone(ctx, c.conn.SetReadDeadline)
+	defer stop()
+
+	for {
+		hb := c.currentHeartbeat()
+		timeout := c.limits.ReadTimeout
+		if hb != nil {
+			timeout = hb.cfg.Timeout
+		}
+		c.conn.SetReadDeadline(ioDeadline(ctx, timeout))
+
+		msg, err := receiveMessage(c.conn, c.codec, c.limits, c.comp)
+		if err != nil {
+			if ctxErr := contextError(ctx); ctxErr != nil {
+				return nil, ctxErr
+			}
+			var netErr net.Error
+			if hb != nil && errors.As(err, &netErr) && netErr.Timeout() {
+				return nil, fmt.Errorf("%w for %s", ErrPeerSilent, hb.cfg.Timeout)
+			}
+			return nil, err
+		}
+
+		switch msg.Type {
+		case MsgPing:
+			if err := c.Write(ctx, &Message{Type: MsgPong, Data: msg.Data}); err != nil {
+				return nil, fmt.Errorf("failed to answer ping: %w", err)
+			}
+		case MsgPong:
+			if hb != nil {
+				hb.onPong(msg.Data)
+			}
+		case MsgInputEvent:
+			return msg, nil
+		default:
+			c.rec.Record(DirIn, msg)
+			return msg, nil
+		}
+	}
+}
+
+// Write sends a message to the connection, giving up once ctx is done
+func (c *Conn) Write(ctx context.Context, msg *Message) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	stop := interruptOnDone(ctx, c.conn.SetWriteDeadline)
+	defer stop()
+
+	timeout := c.limits.WriteTimeout
+	if hb := c.currentHeartbeat(); hb != nil {
+		timeout = hb.cfg.Timeout
+	}
+	c.conn.SetWriteDeadline(ioDeadline(ctx, timeout))
+
+	if err := sendMessage(c.conn, c.codec, msg, c.limits, c.comp); err != nil {
+		if ctxErr := contextError(ctx); ctxErr != nil {
+			return ctxErr
+		}
+		return err
+	}
+	if msg.Type != MsgPing && msg.Type != MsgPong {
+		c.rec.Record(DirOut, msg)
+	}
+	return nil
+}
+
+// Send builds a message of msgType around payload and writes it
+func (c *Conn) Send(ctx context.Context, msgType string, payload any) error {
+	msg, err := NewMessage(msgType, payload)
+	if err != nil {
+		return err
+	}
+	return c.Write(ctx, msg)
+}
+
+// Close stops heartbeats and closes the connection
+func (c *Conn) Close() error {
+	c.hbMu.Lock()
+	if c.heartbeat != nil {
+		c.heartbeat.stop()
+	}
+	c.hbMu.Unlock()
+	if c.comp != nil {
+		sent, received := c.CompressionStats()
+		if sent.Messages > 0 || received.Messages > 0 {
+			log.Printf("[wire] Compression with %s: sent %s, received %s", c.conn.RemoteAddr(), sent, received)
+		}
+	}
+	c.rec.Close()
+	return c.conn.Close()
+}
+
+func (c *Conn) currentHeartbeat() *heartbeat {
+	c.hbMu.Lock()
+	defer c.hbMu.Unlock()
+	return c.heartbeat
+}
+
+// aLongTimeAgo is a deadline in the past, setting it makes blocked I/O
+// return immediately
+var aLongTimeAgo = time.Unix(1, 0)
+
+// interruptOnDone makes I/O blocked on a connection return once ctx is done
+// by moving the deadline set by setDeadline into the past. The returned
+// function must be called once the I/O is over
+func interruptOnDone(ctx context.Context, setDeadline func(time.Time) error) func() {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+
+	fired := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		setDeadline(aLongTimeAgo)
+		close(fired)
+	})
+	return func() {
+		if !stop() {
+			// Wait so the past deadline cannot land on the next operation
+			<-fired
+		}
+	}
+}
+
+// ioDeadline returns the earlier of now+timeout and ctx's deadline, zero when
+// neither applies
+func ioDeadline(ctx context.Context, timeout time.Duration) time.Time {
+	var d time.Time
+	if timeout > 0 {
+		d = time.Now().Add(timeout)
+	}
+	if ctxDeadline, ok := ctx.Deadline(); ok && (d.IsZero() || ctxDeadline.Before(d)) {
+		d = ctxDeadline
+	}
+	return d
+}
+
+// contextError returns why ctx is over, also when its deadline has passed
+// but its timer has not fired yet
+func contextError(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if d, ok := ctx.Deadline(); ok && !time.Now().Before(d) {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
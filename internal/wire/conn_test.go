@@ -0,0 +1,182 @@
+package wire
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnReadContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		ctx     func() (context.Context, context.CancelFunc)
+		limit   time.Duration
+		wantErr func(error) bool
+	}{
+		{"canceled", func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(50*time.Millisecond, cancel)
+			return ctx, cancel
+		}, 0, func(err error) bool { return errors.Is(err, context.Canceled) }},
+		{"deadline", func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), 50*time.Millisecond)
+		}, 0, func(err error) bool { return errors.Is(err, context.DeadlineExceeded) }},
+		{"read timeout", func() (context.Context, context.CancelFunc) {
+			return context.WithCancel(context.Background())
+		}, 50 * time.Millisecond, func(err error) bool {
+			var netErr net.Error
+			return errors.As(err, &netErr) && netErr.Timeout() && !errors.Is(err, context.DeadlineExceeded)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := tcpPair(t)
+			ca, cb := NewConn(a), NewConn(b)
+			limits := DefaultLimits()
+			limits.ReadTimeout = tt.limit
+			cb.SetLimits(limits)
+
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			start := time.Now()
+			if _, err := cb.Read(ctx); !tt.wantErr(err) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("read gave up after %s", elapsed)
+			}
+
+			// An interrupted read leaves the connection usable
+			limits.ReadTimeout = 0
+			cb.SetLimits(limits)
+			ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := ca.Send(ctx, MsgControlStart, &ControlStart{}); err != nil {
+				t.Fatal(err)
+			}
+			if msg, err := cb.Read(ctx); err != nil || msg.Type != MsgControlStart {
+				t.Fatalf("read after interruption: %+v, %v", msg, err)
+			}
+		})
+	}
+}
+
+func TestConnWriteContext(t *testing.T) {
+	a, b := net.Pipe() // Unbuffered, nobody reading b blocks every write
+	defer a.Close()
+	defer b.Close()
+	c := NewConn(a)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if err := c.Send(ctx, MsgControlStart, &ControlStart{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+}
+
+// silentListener accepts connections and never says anything
+func silentListener(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		var conns []net.Conn
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				for _, c := range conns {
+					c.Close()
+				}
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	return port
+}
+
+func TestDialHandshakeBounds(t *testing.T) {
+	port := silentListener(t)
+	sec := newSecurity(t)
+
+	tests := []struct {
+		name    string
+		dialer  Dialer
+		ctx     func() (context.Context, context.CancelFunc)
+		wantErr error
+	}{
+		{"handshake timeout", Dialer{Security: sec, HandshakeTimeout: 50 * time.Millisecond}, func() (context.Context, context.CancelFunc) {
+			return context.WithCancel(context.Background())
+		}, context.DeadlineExceeded},
+		{"canceled", Dialer{Security: sec}, func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(50*time.Millisecond, cancel)
+			return ctx, cancel
+		}, context.Canceled},
+		{"canceled before dialing", Dialer{Security: sec}, func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			return ctx, cancel
+		}, context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			start := time.Now()
+			c, err := tt.dialer.Dial(ctx, "127.0.0.1", port)
+			if err == nil {
+				c.Close()
+				t.Fatal("dial succeeded against a silent peer")
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("dial gave up after %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestServerHandshakeTimeout(t *testing.T) {
+	srv, err := NewServer("127.0.0.1:0", newSecurity(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetHandshakeTimeout(50 * time.Millisecond)
+	served := make(chan struct{}, 1)
+	if err := srv.Start(context.Background(), func(context.Context, *ServerSession) {
+		served <- struct{}{}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	// Connect and never start the handshake
+	conn, err := net.DialTimeout("tcp", srv.ln.Addr().String(), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	start := time.Now()
+	if !closedByServer(conn) {
+		t.Fatal("server kept a connection that never shook hands")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("dropped after %s", elapsed)
+	}
+	select {
+	case <-served:
+		t.Error("handler ran without a handshake")
+	default:
+	}
+}
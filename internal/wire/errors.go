@@ -0,0 +1,66 @@
+package wire
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ProtocolError is implemented by errors caused by a peer violating the wire
+// protocol, as opposed to ordinary disconnects and network failures
+type ProtocolError interface {
+	error
+	protocolError()
+}
+
+// IsProtocolError reports whether err, or any error it wraps, is a
+// ProtocolError
+func IsProtocolError(err error) bool {
+	var perr ProtocolError
+	return errors.As(err, &perr)
+}
+
+// FrameTooLargeError is returned when a frame exceeds the configured limit.
+// Type is empty when the frame was rejected from its header alone
+type FrameTooLargeError struct {
+	Type  string
+	Size  uint32
+	Limit uint32
+}
+
+func (e *FrameTooLargeError) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("frame of %d bytes exceeds limit of %d", e.Size, e.Limit)
+	}
+	return fmt.Sprintf("%s frame of %d bytes exceeds limit of %d", e.Type, e.Size, e.Limit)
+}
+
+func (*FrameTooLargeError) protocolError() {}
+
+// MalformedPayloadError is returned when a frame cannot be decoded
+type MalformedPayloadError struct {
+	Err error
+}
+
+func (e *MalformedPayloadError) Error() string {
+	return fmt.Sprintf("malformed payload: %v", e.Err)
+}
+
+func (e *MalformedPayloadError) Unwrap() error {
+	return e.Err
+}
+
+func (*MalformedPayloadError) protocolError() {}
+
+// UnknownTypeError is returned for messages of a type the receiving side does
+// not handle
+type UnknownTypeError struct {
+	Type string
+}
+
+func (e *UnknownTypeError) Error() string {
+	return fmt.Sprintf("unknown message type %q", e.Type)
+}
+
+func (*UnknownTypeError) protocolError() {}
+
+func (*VersionMismatchError) protocolError() {}
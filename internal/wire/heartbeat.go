@@ -0,0 +1,128 @@
+package wire
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// CapHeartbeat is advertised in the hello by peers that answer pings
+	CapHeartbeat = "heartbeat"
+
+	DefaultHeartbeatInterval = 2 * time.Second
+	DefaultHeartbeatTimeout  = 6 * time.Second
+
+	// rttSmoothing is the weight of a new sample in the smoothed RTT, the
+	// same 1/8 TCP uses
+	rttSmoothing = 0.125
+)
+
+// HeartbeatConfig controls liveness probing on a Conn
+type HeartbeatConfig struct {
+	// Interval between pings
+	Interval time.Duration
+	// Timeout after which a silent peer is considered dead
+	Timeout time.Duration
+	// OnRTT, if set, is called with the smoothed round-trip time after each
+	// pong
+	OnRTT func(rtt time.Duration)
+}
+
+// DefaultHeartbeatConfig returns the heartbeat settings used when none are
+// configured
+func DefaultHeartbeatConfig() HeartbeatConfig {
+	return HeartbeatConfig{
+		Interval: DefaultHeartbeatInterval,
+		Timeout:  DefaultHeartbeatTimeout,
+	}
+}
+
+type heartbeat struct {
+	cfg    HeartbeatConfig
+	stopCh chan struct{}
+	once   sync.Once
+
+	mu  sync.Mutex
+	rtt time.Duration
+}
+
+// StartHeartbeat pings the peer every cfg.Interval and makes Read fail with
+// ErrPeerSilent when nothing arrives for cfg.Timeout. Both peers must have
+// negotiated CapHeartbeat. A failed ping closes the connection so that a
+// blocked Read returns
+func (c *Conn) StartHeartbeat(cfg HeartbeatConfig) {
+	hb := &heartbeat{
+		cfg:    cfg,
+		stopCh: make(chan struct{}),
+	}
+
+	c.hbMu.Lock()
+	if c.heartbeat != nil {
+		c.heartbeat.stop()
+	}
+	c.heartbeat = hb
+	c.hbMu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				ping := &Message{Type: MsgPing, Data: strconv.FormatInt(time.Now().UnixNano(), 10)}
+				if err := c.Write(context.Background(), ping); err != nil {
+					log.Printf("[wire] Heartbeat to %s failed: %v", c.RemoteAddr(), err)
+					c.Close()
+					return
+				}
+			case <-hb.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// RTT returns the smoothed round-trip time, zero until the first pong
+func (c *Conn) RTT() time.Duration {
+	hb := c.currentHeartbeat()
+	if hb == nil {
+		return 0
+	}
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	return hb.rtt
+}
+
+func (h *heartbeat) onPong(data string) {
+	sent, err := strconv.ParseInt(data, 10, 64)
+	if err != nil {
+		return
+	}
+	sample := time.Since(time.Unix(0, sent))
+	if sample < 0 {
+		return
+	}
+
+	h.mu.Lock()
+	if h.rtt == 0 {
+		h.rtt = sample
+	} else {
+		h.rtt += time.Duration(rttSmoothing * float64(sample-h.rtt))
+	}
+	rtt := h.rtt
+	h.mu.Unlock()
+
+	if h.cfg.OnRTT != nil {
+		h.cfg.OnRTT(rtt)
+	}
+}
+
+func (h *heartbeat) stop() {
+	h.once.Do(func() {
+		close(h.stopCh)
+	})
+}
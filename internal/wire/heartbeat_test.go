@@ -0,0 +1,126 @@
+package wire
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// tcpPair returns both ends of a loopback TCP connection
+func tcpPair(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := ln.Accept()
+		accepted <- conn
+	}()
+	a, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := <-accepted
+	if b == nil {
+		t.Fatal("accept failed")
+	}
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	return a, b
+}
+
+func TestHeartbeatRTT(t *testing.T) {
+	a, b := tcpPair(t)
+	ca, cb := NewConn(a), NewConn(b)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Reading answers pings on one side and takes pongs on the other
+	go func() {
+		for ctx.Err() == nil {
+			if _, err := cb.Read(ctx); err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		for ctx.Err() == nil {
+			if _, err := ca.Read(ctx); err != nil {
+				return
+			}
+		}
+	}()
+
+	rtts := make(chan time.Duration, 16)
+	ca.StartHeartbeat(HeartbeatConfig{
+		Interval: 10 * time.Millisecond,
+		Timeout:  time.Second,
+		OnRTT: func(rtt time.Duration) {
+			select {
+			case rtts <- rtt:
+			default:
+			}
+		},
+	})
+
+	select {
+	case rtt := <-rtts:
+		if rtt <= 0 || rtt > time.Second {
+			t.Errorf("implausible rtt %s", rtt)
+		}
+		if ca.RTT() <= 0 {
+			t.Error("RTT() is zero after a pong")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no pong within 5s")
+	}
+}
+
+func TestHeartbeatSilentPeer(t *testing.T) {
+	a, _ := tcpPair(t)
+	ca := NewConn(a)
+	ca.StartHeartbeat(HeartbeatConfig{Interval: 10 * time.Millisecond, Timeout: 100 * time.Millisecond})
+
+	start := time.Now()
+	_, err := ca.Read(context.Background())
+	if !errors.Is(err, ErrPeerSilent) {
+		t.Fatalf("got %v, want ErrPeerSilent", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("silent peer noticed after %s", elapsed)
+	}
+}
+
+func TestHeartbeatSmoothing(t *testing.T) {
+	sentAgo := func(d time.Duration) string {
+		return strconv.FormatInt(time.Now().Add(-d).UnixNano(), 10)
+	}
+
+	tests := []struct {
+		name string
+		pong string
+		want time.Duration
+	}{
+		{"first sample taken as is", sentAgo(80 * time.Millisecond), 80 * time.Millisecond},
+		{"later samples weigh an eighth", sentAgo(160 * time.Millisecond), 90 * time.Millisecond},
+		{"malformed ignored", "not a time", 90 * time.Millisecond},
+		{"future ignored", sentAgo(-time.Hour), 90 * time.Millisecond},
+	}
+
+	h := &heartbeat{}
+	for _, tt := range tests {
+		h.onPong(tt.pong)
+		if diff := h.rtt - tt.want; diff < 0 || diff > 20*time.Millisecond {
+			t.Errorf("%s: rtt %s, want about %s", tt.name, h.rtt, tt.want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package wire
+
+import (
+	"context"
+	"copy/internal/model"
+	"encoding/json"
+	"fmt"
+	"net"
+)
+
+const (
+	// ProtocolVersion is the wire protocol version spoken by this build
+	ProtocolVersion = 1
+	// MinProtocolVersion is the oldest peer version this build can talk to
+	MinProtocolVersion = 1
+)
+
+// Hello is the first message exchanged on every connection, it describes the
+// sending peer and what it supports
+type Hello struct {
+	ProtocolVersion    int                  `json:"protocol_version"`
+	MinProtocolVersion int                  `json:"min_protocol_version"`
+	AppVersion         string               `json:"app_version"`
+	OS                 string               `json:"os"`
+	Hostname           string               `json:"hostname"`
+	Screen             model.ScreenGeometry `json:"screen"`
+	Capabilities       []string             `json:"capabilities"`
+}
+
+// NewHello returns a hello for the current protocol version
+func NewHello(appVersion, os, hostname string, screen model.ScreenGeometry, capabilities []string) Hello {
+	return Hello{
+		ProtocolVersion:    ProtocolVersion,
+		MinProtocolVersion: MinProtocolVersion,
+		AppVersion:         appVersion,
+		OS:                 os,
+		Hostname:           hostname,
+		Screen:             screen,
+		Capabilities:       capabilities,
+	}
+}
+
+// VersionMismatchError is returned when the peers' protocol version ranges
+// do not overlap
+type VersionMismatchError struct {
+	Local  Hello
+	Remote Hello
+}
+
+func (e *VersionMismatchError) Error() string {
+	return fmt.Sprintf("incompatible protocol versions: local speaks %d (min %d, app %s), peer speaks %d (min %d, app %s)",
+		e.Local.ProtocolVersion, e.Local.MinProtocolVersion, e.Local.AppVersion,
+		e.Remote.ProtocolVersion, e.Remote.MinProtocolVersion, e.Remote.AppVersion)
+}
+
+// Capabilities returns the protocol features to advertise in the hello for
+// a peer that prefers codec
+func Capabilities(codec Codec) []string {
+	capabilities := []string{CapHeartbeat, CapMux}
+	if codec == BinaryCodec {
+		capabilities = append(capabilities, CapBinaryCodec)
+	}
+	return capabilities
+}
+
+// Session holds the outcome of a hello exchange
+type Session struct {
+	Local        Hello
+	Remote       Hello
+	Version      int
+	Capabilities []string
+}
+
+// Supports reports whether both peers advertised capability
+func (s *Session) Supports(capability string) bool {
+	for _, c := range s.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientHello sends local to the server and waits for its hello, giving up
+// once ctx is done
+func ClientHello(ctx context.Context, c *Client, local Hello) (*Session, error) {
+	msg, err := helloMessage(local)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Write(ctx, msg); err != nil {
+		return nil, fmt.Errorf("failed to send hello: %w", err)
+	}
+
+	msg, err = c.Read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hello: %w", err)
+	}
+	remote, err := parseHello(msg)
+	if err != nil {
+		return nil, err
+	}
+	return negotiate(local, remote)
+}
+
+// ServerHello waits for the client's hello and answers with local. The reply
+// is sent even when versions are incompatible so both sides can report it
+func ServerHello(conn net.Conn, local Hello) (*Session, error) {
+	remote, err := receiveHello(conn)
+	if err != nil {
+		return nil, err
+	}
+	if err := sendHello(conn, local); err != nil {
+		return nil, err
+	}
+	return negotiate(local, remote)
+}
+
+func sendHello(conn net.Conn, hello Hello) error {
+	msg, err := helloMessage(hello)
+	if err != nil {
+		return err
+	}
+	if err := SendMessage(conn, JSONCodec, msg); err != nil {
+		return fmt.Errorf("failed to send hello: %w", err)
+	}
+	return nil
+}
+
+func receiveHello(conn net.Conn) (Hello, error) {
+	msg, err := ReceiveMessage(conn, JSONCodec)
+	if err != nil {
+		return Hello{}, fmt.Errorf("failed to read hello: %w", err)
+	}
+	return parseHello(msg)
+}
+
+func helloMessage(hello Hello) (*Message, error) {
+	data, err := json.Marshal(hello)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{Type: MsgHello, Data: string(data)}, nil
+}
+
+func parseHello(msg *Message) (Hello, error) {
+	if msg.Type != MsgHello {
+		return Hello{}, fmt.Errorf("expected %s: %w", MsgHello, &UnknownTypeError{Type: msg.Type})
+	}
+
+	var hello Hello
+	if err := json.Unmarshal([]byte(msg.Data), &hello); err != nil {
+		return Hello{}, fmt.Errorf("hello: %w", &MalformedPayloadError{Err: err})
+	}
+	return hello, nil
+}
+
+func negotiate(local, remote Hello) (*Session, error) {
+	if remote.ProtocolVersion < local.MinProtocolVersion || local.ProtocolVersion < remote.MinProtocolVersion {
+		return nil, &VersionMismatchError{Local: local, Remote: remote}
+	}
+
+	version := local.ProtocolVersion
+	if remote.ProtocolVersion < version {
+		version = remote.ProtocolVersion
+	}
+
+	var capabilities []string
+	for _, c := range local.Capabilities {
+		for _, rc := range remote.Capabilities {
+			if c == rc {
+				capabilities = append(capabilities, c)
+				break
+			}
+		}
+	}
+
+	return &Session{
+		Local:        local,
+		Remote:       remote,
+		Version:      version,
+		Capabilities: capabilities,
+	}, nil
+}
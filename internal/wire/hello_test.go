@@ -0,0 +1,122 @@
+package wire
+
+import (
+	"context"
+	"copy/internal/model"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNegotiate(t *testing.T) {
+	hello := func(version, min int, caps ...string) Hello {
+		return Hello{ProtocolVersion: version, MinProtocolVersion: min, Capabilities: caps}
+	}
+
+	tests := []struct {
+		name     string
+		local    Hello
+		remote   Hello
+		version  int
+		caps     []string
+		mismatch bool
+	}{
+		{"same", hello(1, 1, "a", "b"), hello(1, 1, "b", "a"), 1, []string{"a", "b"}, false},
+		{"newer peer", hello(1, 1, "a"), hello(3, 1, "a"), 1, []string{"a"}, false},
+		{"older peer", hello(3, 2, "a"), hello(2, 1, "a"), 2, []string{"a"}, false},
+		{"disjoint capabilities", hello(1, 1, "a"), hello(1, 1, "b"), 1, nil, false},
+		{"no capabilities", hello(1, 1), hello(1, 1, "a"), 1, nil, false},
+		{"peer too old", hello(3, 2), hello(1, 1), 0, nil, true},
+		{"peer too new", hello(1, 1), hello(4, 2), 0, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session, err := negotiate(tt.local, tt.remote)
+			var mismatch *VersionMismatchError
+			if tt.mismatch {
+				if !errors.As(err, &mismatch) {
+					t.Fatalf("got %v, want VersionMismatchError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if session.Version != tt.version {
+				t.Errorf("version %d, want %d", session.Version, tt.version)
+			}
+			if !slices.Equal(session.Capabilities, tt.caps) {
+				t.Errorf("capabilities %q, want %q", session.Capabilities, tt.caps)
+			}
+			for _, c := range tt.caps {
+				if !session.Supports(c) {
+					t.Errorf("session does not support negotiated %s", c)
+				}
+			}
+			if session.Supports("unknown") {
+				t.Error("session supports a capability nobody advertised")
+			}
+		})
+	}
+}
+
+func TestHelloExchange(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	server := NewHello("2.0", "linux", "receiver", model.ScreenGeometry{Width: 1920, Height: 1080}, []string{CapHeartbeat, CapBinaryCodec})
+	client := NewHello("1.9", "windows", "controller", model.ScreenGeometry{Width: 1280, Height: 720}, []string{CapBinaryCodec, CapMux})
+
+	type result struct {
+		session *Session
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		session, err := ServerHello(b, server)
+		done <- result{session, err}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	session, err := ClientHello(ctx, &Client{Conn: NewConn(a)}, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := <-done
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+
+	if session.Remote.Hostname != "receiver" || res.session.Remote.Hostname != "controller" {
+		t.Errorf("hostnames: client saw %q, server saw %q", session.Remote.Hostname, res.session.Remote.Hostname)
+	}
+	if session.Remote.Screen != server.Screen {
+		t.Errorf("client saw screen %+v, want %+v", session.Remote.Screen, server.Screen)
+	}
+	for _, s := range []*Session{session, res.session} {
+		if !slices.Equal(s.Capabilities, []string{CapBinaryCodec}) {
+			t.Errorf("capabilities %q, want only %s", s.Capabilities, CapBinaryCodec)
+		}
+		if NegotiatedCodec(s) != BinaryCodec {
+			t.Errorf("negotiated %s, want binary", NegotiatedCodec(s).Name())
+		}
+	}
+}
+
+func TestHelloRejectsOtherMessages(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	go SendMessage(a, JSONCodec, &Message{Type: MsgControlStart})
+	_, err := ServerHello(b, NewHello("1", "linux", "receiver", model.ScreenGeometry{Width: 1, Height: 1}, nil))
+	var unknown *UnknownTypeError
+	if !errors.As(err, &unknown) {
+		t.Fatalf("got %v, want UnknownTypeError", err)
+	}
+}
@@ -0,0 +1,115 @@
+package wire
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	identityCertFile = "identity.crt"
+	identityKeyFile  = "identity.key"
+	identityValidity = 20 * 365 * 24 * time.Hour
+)
+
+// Identity is the self-signed certificate this installation presents to peers
+type Identity struct {
+	Certificate tls.Certificate
+	Fingerprint string
+}
+
+// LoadOrCreateIdentity loads the identity stored in dir, generating and
+// persisting a new one on first run
+func LoadOrCreateIdentity(dir string) (*Identity, error) {
+	certPath := filepath.Join(dir, identityCertFile)
+	keyPath := filepath.Join(dir, identityKeyFile)
+
+	if _, err := os.Stat(certPath); os.IsNotExist(err) {
+		log.Printf("[wire] No identity found, generating a new one in %s", dir)
+		if err := generateIdentity(certPath, keyPath); err != nil {
+			return nil, fmt.Errorf("failed to generate identity: %w", err)
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load identity: %w", err)
+	}
+
+	return &Identity{
+		Certificate: cert,
+		Fingerprint: Fingerprint(cert.Certificate[0]),
+	}, nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of a DER encoded certificate,
+// formatted in colon separated groups so it can be compared by eye
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	digest := hex.EncodeToString(sum[:])
+
+	groups := make([]string, 0, len(digest)/4)
+	for i := 0; i < len(digest); i += 4 {
+		groups = append(groups, digest[i:i+4])
+	}
+	return strings.Join(groups, ":")
+}
+
+func generateIdentity(certPath, keyPath string) error {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	hostname, _ := os.Hostname()
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "iocopy " + hostname},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(identityValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pub, priv)
+	if err != nil {
+		return err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return err
+	}
+
+	if err := writePEM(keyPath, "PRIVATE KEY", keyDER, 0o600); err != nil {
+		return err
+	}
+	return writePEM(certPath, "CERTIFICATE", der, 0o644)
+}
+
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return pem.Encode(f, &pem.Block{Type: blockType, Bytes: der})
+}
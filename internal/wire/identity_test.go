@@ -0,0 +1,89 @@
+package wire
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadOrCreateIdentity(t *testing.T) {
+	dir := t.TempDir()
+	id, err := LoadOrCreateIdentity(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(id.Certificate.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cert.PublicKey.(ed25519.PublicKey); !ok {
+		t.Errorf("identity key is %T, want ed25519", cert.PublicKey)
+	}
+	info, err := os.Stat(filepath.Join(dir, identityKeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		t.Errorf("private key readable by others: %v", perm)
+	}
+
+	// The same identity comes back on the next run
+	again, err := LoadOrCreateIdentity(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Fingerprint != id.Fingerprint {
+		t.Errorf("fingerprint changed across loads: %s, then %s", id.Fingerprint, again.Fingerprint)
+	}
+
+	other, err := LoadOrCreateIdentity(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Fingerprint == id.Fingerprint {
+		t.Error("two installations share a fingerprint")
+	}
+}
+
+func TestLoadOrCreateIdentityCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LoadOrCreateIdentity(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, identityKeyFile), []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// A broken key must not be silently replaced, that would change the
+	// identity every peer pinned
+	if _, err := LoadOrCreateIdentity(dir); err == nil {
+		t.Error("loaded an identity with a corrupt key")
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	der := []byte("certificate")
+	sum := sha256.Sum256(der)
+
+	fp := Fingerprint(der)
+	groups := strings.Split(fp, ":")
+	if len(groups) != 16 {
+		t.Fatalf("%s has %d groups, want 16", fp, len(groups))
+	}
+	for _, g := range groups {
+		if len(g) != 4 {
+			t.Fatalf("%s has a group of %d digits", fp, len(g))
+		}
+	}
+	if got := strings.ReplaceAll(fp, ":", ""); got != hex.EncodeToString(sum[:]) {
+		t.Errorf("%s is not the SHA-256 of the certificate", fp)
+	}
+	if Fingerprint([]byte("other")) == fp {
+		t.Error("different certificates share a fingerprint")
+	}
+}
@@ -0,0 +1,293 @@
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const KnownPeersFile = "known_peers"
+
+// ErrFingerprintMismatch is returned when a peer presents a certificate that
+// differs from the one pinned on first contact
+var ErrFingerprintMismatch = errors.New("peer certificate fingerprint does not match the pinned one")
+
+// ErrUnknownPeer is returned when editing a peer that is not in the store
+var ErrUnknownPeer = errors.New("unknown peer")
+
+// KnownPeer is a peer we have talked to. ID is the fingerprint of its
+// identity certificate, which carries its long-term ed25519 key
+type KnownPeer struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	LastAddr  string    `json:"last_addr"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	// Named is set once the user chose Name, it then stops following the
+	// peer's hostname
+	Named bool `json:"named,omitempty"`
+}
+
+// KeyChangedError is returned when an address that belonged to a known peer
+// presents a different key, either an impostor or a reinstalled peer. The
+// connection is refused until the user accepts the change
+type KeyChangedError struct {
+	Addr      string
+	Known     KnownPeer
+	Presented string
+}
+
+func (e *KeyChangedError) Error() string {
+	return fmt.Sprintf("%s belonged to %s (%s) but now presents key %s, accept the new key if this is expected",
+		e.Addr, e.Known.Name, e.Known.ID, e.Presented)
+}
+
+func (e *KeyChangedError) Is(target error) bool {
+	return target == ErrFingerprintMismatch
+}
+
+// KnownPeers is the trust store of peer identities. Keys are trusted once
+// they first pair and remembered by ID, so a peer keeps its identity when its
+// address changes
+type KnownPeers struct {
+	path  string
+	mu    sync.Mutex
+	peers map[string]*KnownPeer
+}
+
+// LoadKnownPeers reads the known peers file at path, an absent file is
+// treated as empty. The older "<host> <fingerprint>" format is converted
+func LoadKnownPeers(path string) (*KnownPeers, error) {
+	k := &KnownPeers{
+		path:  path,
+		peers: make(map[string]*KnownPeer),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return k, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open known peers: %w", err)
+	}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '[' {
+		if err := k.importLegacy(data, path); err != nil {
+			return nil, err
+		}
+		return k, nil
+	}
+
+	var peers []*KnownPeer
+	if err := json.Unmarshal(data, &peers); err != nil {
+		return nil, fmt.Errorf("failed to read known peers: %w", err)
+	}
+	for _, p := range peers {
+		k.peers[p.ID] = p
+	}
+	return k, nil
+}
+
+// importLegacy converts the host to fingerprint pins of older versions
+func (k *KnownPeers) importLegacy(data []byte, path string) error {
+	firstSeen := time.Now()
+	if info, err := os.Stat(path); err == nil {
+		firstSeen = info.ModTime()
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		host, fp := fields[0], fields[1]
+		k.peers[fp] = &KnownPeer{ID: fp, Name: host, LastAddr: host, FirstSeen: firstSeen, LastSeen: firstSeen}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read known peers: %w", err)
+	}
+	if len(k.peers) == 0 {
+		return nil
+	}
+	log.Printf("[wire] Converting %d known peers to the new format", len(k.peers))
+	return k.save()
+}
+
+// Lookup returns the ID of the peer last seen at addr
+func (k *KnownPeers) Lookup(addr string) (string, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if p := k.atAddr(addr); p != nil {
+		return p.ID, true
+	}
+	return "", false
+}
+
+// Known reports whether id is a trusted peer
+func (k *KnownPeers) Known(id string) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	_, ok := k.peers[id]
+	return ok
+}
+
+// Verify checks the key a peer presented at addr. An address that belongs
+// to a known peer only passes with that peer's key, whether or not the
+// presented one is known. Keys are not stored here, an unknown one is only
+// trusted once Observe records it after pairing
+func (k *KnownPeers) Verify(addr, id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if prev := k.atAddr(addr); prev != nil && prev.ID != id {
+		err := &KeyChangedError{Addr: addr, Known: *prev, Presented: id}
+		log.Printf("[wire] WARNING: %v", err)
+		return err
+	}
+	if _, ok := k.peers[id]; !ok {
+		log.Printf("[wire] %s presents unknown key %s, it is trusted once pairing succeeds", addr, id)
+	}
+	return nil
+}
+
+// AcceptKeyChange lets key id take addr after a KeyChangedError. The peers
+// last seen there keep their trust but no longer hold the address
+func (k *KnownPeers) AcceptKeyChange(addr, id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for _, p := range k.peers {
+		if p.LastAddr == addr && p.ID != id {
+			log.Printf("[wire] %s no longer belongs to %s (%s), accepting key %s", addr, p.Name, p.ID, id)
+			p.LastAddr = ""
+		}
+	}
+	return k.save()
+}
+
+// Observe records that peer id authenticated from addr under hostname
+// name, adding it if new. A name the user chose is kept. It returns a
+// KeyChangedError, after recording, when addr last belonged to another peer
+func (k *KnownPeers) Observe(id, name, addr string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	var changed error
+	if prev := k.atAddr(addr); prev != nil && prev.ID != id {
+		changed = &KeyChangedError{Addr: addr, Known: *prev, Presented: id}
+		log.Printf("[wire] WARNING: %v", changed)
+	}
+
+	now := time.Now()
+	p, ok := k.peers[id]
+	if !ok {
+		p = &KnownPeer{ID: id, Name: addr, FirstSeen: now}
+		k.peers[id] = p
+	}
+	if name != "" && !p.Named {
+		p.Name = name
+	}
+	p.LastAddr = addr
+	p.LastSeen = now
+	if err := k.save(); err != nil {
+		return err
+	}
+	return changed
+}
+
+// List returns the known peers, most recently seen first
+func (k *KnownPeers) List() []KnownPeer {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	peers := make([]KnownPeer, 0, len(k.peers))
+	for _, p := range k.peers {
+		peers = append(peers, *p)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].LastSeen.After(peers[j].LastSeen)
+	})
+	return peers
+}
+
+// Rename gives peer id a friendly name
+func (k *KnownPeers) Rename(id, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("name is empty")
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	p, ok := k.peers[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownPeer, id)
+	}
+	p.Name = name
+	p.Named = true
+	return k.save()
+}
+
+// Revoke forgets peer id, its key is no longer trusted and a different key
+// may take its address
+func (k *KnownPeers) Revoke(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.peers[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownPeer, id)
+	}
+	log.Printf("[wire] Revoking trust in %s", id)
+	delete(k.peers, id)
+	return k.save()
+}
+
+// atAddr returns the peer most recently seen at addr
+func (k *KnownPeers) atAddr(addr string) *KnownPeer {
+	if addr == "" {
+		return nil
+	}
+	var found *KnownPeer
+	for _, p := range k.peers {
+		if p.LastAddr == addr && (found == nil || p.LastSeen.After(found.LastSeen)) {
+			found = p
+		}
+	}
+	return found
+}
+
+func (k *KnownPeers) save() error {
+	peers := make([]*KnownPeer, 0, len(k.peers))
+	for _, p := range k.peers {
+		peers = append(peers, p)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].FirstSeen.Before(peers[j].FirstSeen)
+	})
+	data, err := json.MarshalIndent(peers, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write aside and rename so a crash cannot leave a truncated store
+	tmp := k.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write known peers: %w", err)
+	}
+	if err := os.Rename(tmp, k.path); err != nil {
+		return fmt.Errorf("failed to write known peers: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package wire
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestKnownPeers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), KnownPeersFile)
+	k, err := LoadKnownPeers(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	isChanged := func(err error) bool {
+		var changed *KeyChangedError
+		return errors.As(err, &changed) && errors.Is(err, ErrFingerprintMismatch)
+	}
+	isUnknown := func(err error) bool { return errors.Is(err, ErrUnknownPeer) }
+
+	// Steps run in order against one store
+	tests := []struct {
+		name    string
+		do      func() error
+		wantErr func(error) bool
+	}{
+		{"first use passes", func() error { return k.Verify("10.0.0.1", "key-a") }, nil},
+		{"passing is not trusting", func() error {
+			if _, ok := k.Lookup("10.0.0.1"); ok {
+				return errors.New("key stored before pairing")
+			}
+			return nil
+		}, nil},
+		{"pairing records the key", func() error { return k.Observe("key-a", "", "10.0.0.1") }, nil},
+		{"same key again", func() error { return k.Verify("10.0.0.1", "key-a") }, nil},
+		{"other key at a known address", func() error { return k.Verify("10.0.0.1", "key-b") }, isChanged},
+		{"known key at a new address", func() error { return k.Verify("10.0.0.9", "key-a") }, nil},
+		{"observe takes the hostname", func() error { return k.Observe("key-a", "desk", "10.0.0.2") }, nil},
+		{"rename", func() error { return k.Rename("key-a", " office ") }, nil},
+		{"observe keeps a chosen name", func() error { return k.Observe("key-a", "desk", "10.0.0.2") }, nil},
+		{"rename to nothing", func() error { return k.Rename("key-a", "  ") }, func(err error) bool { return err != nil }},
+		{"rename unknown", func() error { return k.Rename("key-z", "x") }, isUnknown},
+		{"observe another key at a taken address", func() error { return k.Observe("key-c", "laptop", "10.0.0.2") }, isChanged},
+		{"known key at another peer's address", func() error { return k.Verify("10.0.0.2", "key-a") }, isChanged},
+		{"accept the change", func() error { return k.AcceptKeyChange("10.0.0.2", "key-a") }, nil},
+		{"accepted key passes", func() error { return k.Verify("10.0.0.2", "key-a") }, nil},
+		{"pairing moves the peer", func() error { return k.Observe("key-a", "desk", "10.0.0.3") }, nil},
+		{"revoke", func() error { return k.Revoke("key-a") }, nil},
+		{"revoke twice", func() error { return k.Revoke("key-a") }, isUnknown},
+		{"address is free after revoke", func() error { return k.Verify("10.0.0.3", "key-b") }, nil},
+		{"new key pairs", func() error { return k.Observe("key-b", "tablet", "10.0.0.3") }, nil},
+	}
+
+	for _, tt := range tests {
+		err := tt.do()
+		if tt.wantErr == nil && err != nil || tt.wantErr != nil && !tt.wantErr(err) {
+			t.Fatalf("%s: unexpected error %v", tt.name, err)
+		}
+	}
+
+	peers := make(map[string]KnownPeer)
+	for _, p := range k.List() {
+		peers[p.ID] = p
+	}
+	if len(peers) != 2 {
+		t.Fatalf("store holds %+v, want key-b and key-c", peers)
+	}
+	if c := peers["key-c"]; c.Name != "laptop" || c.LastAddr != "" {
+		t.Errorf("peer that gave up its address recorded as %+v", c)
+	}
+	if !k.Known("key-c") || k.Known("key-a") {
+		t.Error("known keys do not match the store")
+	}
+	if id, ok := k.Lookup("10.0.0.3"); !ok || id != "key-b" {
+		t.Errorf("lookup 10.0.0.3 = %q, %v", id, ok)
+	}
+	if _, ok := k.Lookup("10.0.0.2"); ok {
+		t.Error("address given up on accepting is still held")
+	}
+
+	// Everything survives a reload
+	reloaded, err := LoadKnownPeers(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := reloaded.List(), k.List(); !equalPeers(got, want) {
+		t.Errorf("reloaded %+v, want %+v", got, want)
+	}
+}
+
+func TestKnownPeersNamed(t *testing.T) {
+	k, err := LoadKnownPeers(filepath.Join(t.TempDir(), KnownPeersFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.Observe("key-a", "desk", "10.0.0.1")
+	k.Rename("key-a", "office")
+	k.Observe("key-a", "desk-renamed", "10.0.0.3")
+
+	p := k.List()[0]
+	if p.Name != "office" || !p.Named || p.LastAddr != "10.0.0.3" {
+		t.Errorf("got %+v, want the chosen name at the new address", p)
+	}
+}
+
+func TestLoadKnownPeers(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]string // ID to name
+		wantErr bool
+	}{
+		{"empty file", "", map[string]string{}, false},
+		{"legacy pins", "# pinned hosts\ndesk aa:bb\n\nbroken line here\nlaptop cc:dd\n", map[string]string{"aa:bb": "desk", "cc:dd": "laptop"}, false},
+		{"current format", `[{"id":"aa:bb","name":"desk","last_addr":"10.0.0.1"}]`, map[string]string{"aa:bb": "desk"}, false},
+		{"corrupt", `[{"id":`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), KnownPeersFile)
+			if err := os.WriteFile(path, []byte(tt.data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			k, err := LoadKnownPeers(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err != nil {
+				return
+			}
+			got := make(map[string]string)
+			for _, p := range k.List() {
+				got[p.ID] = p.Name
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+
+			// Legacy pins are rewritten in the current format
+			if len(tt.want) > 0 {
+				data, err := os.ReadFile(path)
+				if err != nil || len(data) == 0 || data[0] != '[' {
+					t.Errorf("store not in the current format: %q, %v", data, err)
+				}
+			}
+		})
+	}
+
+	k, err := LoadKnownPeers(filepath.Join(t.TempDir(), "missing"))
+	if err != nil || len(k.List()) != 0 {
+		t.Errorf("missing file: %+v, %v", k, err)
+	}
+}
+
+func equalPeers(a, b []KnownPeer) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID || a[i].Name != b[i].Name || a[i].LastAddr != b[i].LastAddr ||
+			a[i].Named != b[i].Named || !a[i].LastSeen.Equal(b[i].LastSeen) {
+			return false
+		}
+	}
+	return true
+}
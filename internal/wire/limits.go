@@ -0,0 +1,57 @@
+package wire
+
+import "time"
+
+const (
+	DefaultMaxFrameSize = 1 << 20 // 1 MiB
+	DefaultReadTimeout  = 0       // No idle limit unless heartbeats are on
+	DefaultWriteTimeout = 10 * time.Second
+
+	// HandshakeTimeout bounds the TLS, hello and pairing exchanges unless
+	// configured otherwise
+	HandshakeTimeout = 15 * time.Second
+)
+
+// Limits bounds what a peer may send on a connection
+type Limits struct {
+	// MaxFrameSize is checked against the length header before anything is
+	// allocated, it must be at least as large as every PerType entry
+	MaxFrameSize uint32
+	// PerType holds tighter limits for individual message types, checked
+	// once the frame is decoded
+	PerType map[string]uint32
+	// ReadTimeout, if non-zero, fails a Read that waits longer for a frame
+	ReadTimeout time.Duration
+	// WriteTimeout, if non-zero, fails a Write that cannot complete in time
+	WriteTimeout time.Duration
+}
+
+// DefaultLimits returns the limits applied to new connections
+func DefaultLimits() Limits {
+	return Limits{
+		MaxFrameSize: DefaultMaxFrameSize,
+		PerType: map[string]uint32{
+			MsgHello:        16 << 10,
+			MsgControlStart: 256,
+			MsgControlAck:   256,
+			MsgInputEvent:   4 << 10,
+			MsgUDPOffer:     256,
+			MsgUDPReady:     64,
+			MsgBye:          256,
+			MsgFloor:        512,
+			MsgPointer:      128,
+			MsgPing:         64,
+			MsgPong:         64,
+		},
+		ReadTimeout:  DefaultReadTimeout,
+		WriteTimeout: DefaultWriteTimeout,
+	}
+}
+
+func (l Limits) check(msgType string, size int) error {
+	limit, ok := l.PerType[msgType]
+	if ok && uint32(size) > limit {
+		return &FrameTooLargeError{Type: msgType, Size: uint32(size), Limit: limit}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// rawConn returns a connection that yields data and then EOF
+func rawConn(t *testing.T, data []byte) net.Conn {
+	t.Helper()
+	a, b := net.Pipe()
+	go func() {
+		a.Write(data)
+		a.Close()
+	}()
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func frameHeader(payload string) []byte {
+	return binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+}
+
+func TestReadFrameLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		max     uint32
+		want    string
+		wantErr func(error) bool
+	}{
+		{"fits", append(frameHeader("hello"), "hello"...), 5, "hello", nil},
+		{"empty", frameHeader(""), 5, "", nil},
+		{"header over limit", binary.BigEndian.AppendUint32(nil, 6), 5, "", isTooLarge},
+		{"huge header", []byte{0xff, 0xff, 0xff, 0xff}, DefaultMaxFrameSize, "", isTooLarge},
+		{"short header", []byte{0, 0}, 5, "", isEOF},
+		{"truncated payload", append(frameHeader("hello"), "hel"...), 5, "", isEOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := readFrame(rawConn(t, tt.data), tt.max)
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Fatalf("got %q, %v", data, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("got %q, want %q", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestReceiveMessageLimits(t *testing.T) {
+	limits := DefaultLimits()
+	tests := []struct {
+		name    string
+		payload string
+		wantErr func(error) bool
+	}{
+		{"control start", `{"type":"control_start"}`, nil},
+		{"ping over its limit", `{"type":"ping","data":"` + strings.Repeat("1", 100) + `"}`, isTooLarge},
+		{"unlisted type", `{"type":"custom","data":"` + strings.Repeat("x", 64<<10) + `"}`, nil},
+		{"bad json", `{"type":`, isMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := rawConn(t, append(frameHeader(tt.payload), tt.payload...))
+			msg, err := receiveMessage(conn, JSONCodec, limits, nil)
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Fatalf("got %+v, %v", msg, err)
+				}
+				if !IsProtocolError(err) {
+					t.Errorf("%v is not a protocol error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestWriteFrameLimit(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	err := writeFrame(a, make([]byte, 6), 5)
+	if !isTooLarge(err) {
+		t.Fatalf("got %v, want FrameTooLargeError", err)
+	}
+}
+
+func TestIsProtocolError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&FrameTooLargeError{Size: 2, Limit: 1}, true},
+		{&MalformedPayloadError{Err: errors.New("x")}, true},
+		{&UnknownTypeError{Type: "x"}, true},
+		{&VersionMismatchError{}, true},
+		{errors.Join(errors.New("read"), &UnknownTypeError{Type: "x"}), true},
+		{io.EOF, false},
+		{ErrPeerSilent, false},
+	}
+	for _, tt := range tests {
+		if got := IsProtocolError(tt.err); got != tt.want {
+			t.Errorf("IsProtocolError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func isTooLarge(err error) bool {
+	var tooLarge *FrameTooLargeError
+	return errors.As(err, &tooLarge)
+}
+
+func isMalformed(err error) bool {
+	var malformed *MalformedPayloadError
+	return errors.As(err, &malformed)
+}
+
+func isEOF(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -1,6 +1,85 @@
 package wire
 
+import (
+	"copy/internal/model"
+	"encoding/json"
+	"fmt"
+)
+
+// Message kinds. Handshake and heartbeat kinds are consumed inside this
+// package, the rest are dispatched through a Router
+const (
+	MsgHello        = "hello"
+	MsgPing         = "ping"
+	MsgPong         = "pong"
+	MsgControlStart = "control_start"
+	MsgControlAck   = "control_ack"
+	MsgInputEvent   = "input_event"
+	MsgBye          = "bye"
+	MsgFloor        = "floor"
+)
+
 type Message struct {
-	Type string `json:"type"`
-	Data string `json:"data"`
+	Type  string            `json:"type"`
+	Data  string            `json:"data,omitempty"`
+	Event *model.InputEvent `json:"event,omitempty"` // Set for input_event messages
+}
+
+// ControlStart is sent by the controller to open a control session
+type ControlStart struct{}
+
+// ControlAck is the receiver's answer to ControlStart
+type ControlAck struct{}
+
+// Bye tells the peer the session is ending on purpose and it should not
+// try to reconnect
+type Bye struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// Floor tells a controller whether it holds input on the receiver. State is
+// granted, queued or revoked, Holder names whoever holds it now
+type Floor struct {
+	State  string `json:"state"`
+	Holder string `json:"holder,omitempty"`
+}
+
+// NewMessage builds a message of msgType carrying payload. Input events go
+// in the typed Event field, anything else is JSON encoded into Data
+func NewMessage(msgType string, payload any) (*Message, error) {
+	msg := &Message{Type: msgType}
+	switch p := payload.(type) {
+	case nil:
+	case *model.InputEvent:
+		msg.Event = p
+	case model.InputEvent:
+		msg.Event = &p
+	default:
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s payload: %w", msgType, err)
+		}
+		msg.Data = string(data)
+	}
+	return msg, nil
+}
+
+// Decode fills out with the message payload. A message without payload
+// leaves out at its zero value
+func (m *Message) Decode(out any) error {
+	if event, ok := out.(*model.InputEvent); ok {
+		if m.Event == nil {
+			return &MalformedPayloadError{Err: fmt.Errorf("%s without event", m.Type)}
+		}
+		*event = *m.Event
+		return nil
+	}
+
+	if m.Data == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(m.Data), out); err != nil {
+		return &MalformedPayloadError{Err: fmt.Errorf("%s: %w", m.Type, err)}
+	}
+	return nil
 }
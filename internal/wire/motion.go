@@ -0,0 +1,225 @@
+package wire
+
+import (
+	"copy/internal/model"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// CapUDPMotion is advertised by peers that can carry pointer motion and
+// scrolling over UDP next to the reliable connection
+const CapUDPMotion = "udp_motion"
+
+// Messages negotiating the UDP side channel on the reliable connection
+const (
+	// MsgUDPOffer is sent by the receiver with the port and key to use
+	MsgUDPOffer = "udp_offer"
+	// MsgUDPReady is sent by the receiver once a datagram got through
+	MsgUDPReady = "udp_ready"
+)
+
+// Datagrams are frameTagMotion, an 8 byte big endian sequence number and
+// the sealed event. The sequence number doubles as the AEAD nonce, so it
+// never repeats under one key
+const (
+	frameTagMotion   = 0x02
+	motionHeaderSize = 9
+	motionKeySize    = 32
+	maxDatagram      = 1500
+)
+
+// UDPOffer is the payload of MsgUDPOffer
+type UDPOffer struct {
+	Port int    `json:"port"`
+	Key  []byte `json:"key"`
+}
+
+// UDPReady is the payload of MsgUDPReady
+type UDPReady struct{}
+
+// MotionSender sends sealed motion events to a receiver's MotionListener.
+// It is safe for concurrent use
+type MotionSender struct {
+	conn  *net.UDPConn
+	aead  cipher.AEAD
+	seq   atomic.Uint64
+	ready atomic.Bool
+}
+
+// DialMotion prepares to send motion to the port offered by the receiver
+// at host
+func DialMotion(host string, offer *UDPOffer) (*MotionSender, error) {
+	aead, err := motionAEAD(offer.Key)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.ParseIP(host), Port: offer.Port})
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial udp: %w", err)
+	}
+	return &MotionSender{conn: conn, aead: aead}, nil
+}
+
+// Probe sends an empty datagram so the receiver can confirm the path works
+func (s *MotionSender) Probe() error {
+	return s.send(nil)
+}
+
+// Send sends a pointer move or scroll event
+func (s *MotionSender) Send(event *model.InputEvent) error {
+	if !MotionEvent(event.Type) {
+		return fmt.Errorf("%s events do not go over udp", event.Type)
+	}
+	payload, err := appendEvent(nil, event)
+	if err != nil {
+		return err
+	}
+	return s.send(payload)
+}
+
+func (s *MotionSender) send(payload []byte) error {
+	header := make([]byte, motionHeaderSize, motionHeaderSize+len(payload)+s.aead.Overhead())
+	header[0] = frameTagMotion
+	seq := s.seq.Add(1)
+	binary.BigEndian.PutUint64(header[1:], seq)
+
+	datagram := s.aead.Seal(header, motionNonce(seq), payload, header)
+	_, err := s.conn.Write(datagram)
+	return err
+}
+
+// SetReady records that the receiver confirmed the path
+func (s *MotionSender) SetReady() {
+	s.ready.Store(true)
+}
+
+// Ready reports whether the receiver confirmed the path
+func (s *MotionSender) Ready() bool {
+	return s.ready.Load()
+}
+
+// Close closes the UDP socket
+func (s *MotionSender) Close() error {
+	return s.conn.Close()
+}
+
+// MotionListener receives motion datagrams for one session
+type MotionListener struct {
+	conn *net.UDPConn
+	aead cipher.AEAD
+
+	mu      sync.Mutex
+	lastSeq uint64
+}
+
+// ListenMotion opens a UDP port for one session and returns the offer to
+// send to the controller
+func ListenMotion() (*MotionListener, *UDPOffer, error) {
+	key := make([]byte, motionKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate udp key: %w", err)
+	}
+	aead, err := motionAEAD(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to listen on udp: %w", err)
+	}
+	offer := &UDPOffer{
+		Port: conn.LocalAddr().(*net.UDPAddr).Port,
+		Key:  key,
+	}
+	return &MotionListener{conn: conn, aead: aead}, offer, nil
+}
+
+// Read returns the next fresh event. Datagrams that fail authentication or
+// arrive after a newer one are discarded. A probe yields a nil event
+func (l *MotionListener) Read() (*model.InputEvent, error) {
+	buf := make([]byte, maxDatagram)
+	for {
+		n, err := l.conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		event, err := l.open(buf[:n])
+		if err != nil {
+			continue
+		}
+		return event, nil
+	}
+}
+
+func (l *MotionListener) open(datagram []byte) (*model.InputEvent, error) {
+	if len(datagram) < motionHeaderSize || datagram[0] != frameTagMotion {
+		return nil, errors.New("not a motion datagram")
+	}
+	header := datagram[:motionHeaderSize]
+	seq := binary.BigEndian.Uint64(header[1:])
+
+	payload, err := l.aead.Open(nil, motionNonce(seq), datagram[motionHeaderSize:], header)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	stale := seq <= l.lastSeq
+	if !stale {
+		l.lastSeq = seq
+	}
+	l.mu.Unlock()
+	if stale {
+		return nil, errors.New("stale datagram")
+	}
+
+	if len(payload) == 0 {
+		return nil, nil
+	}
+	event, err := decodeEvent(payload)
+	if err != nil {
+		return nil, err
+	}
+	if !MotionEvent(event.Type) {
+		return nil, fmt.Errorf("%s events do not go over udp", event.Type)
+	}
+	return event, nil
+}
+
+// Close closes the UDP port
+func (l *MotionListener) Close() error {
+	return l.conn.Close()
+}
+
+// MotionEvent reports whether events of eventType may use the UDP path.
+// Everything else must arrive reliably and in order. Relative motion is
+// not a motion event here, a lost delta is lost for good where a lost
+// absolute move is superseded by the next one
+func MotionEvent(eventType string) bool {
+	return eventType == model.EventMouseMove || eventType == model.EventMouseScroll
+}
+
+func motionAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != motionKeySize {
+		return nil, fmt.Errorf("bad udp key size %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func motionNonce(seq uint64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], seq)
+	return nonce
+}
@@ -0,0 +1,180 @@
+package wire
+
+import (
+	"bytes"
+	"copy/internal/model"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testMotionKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, motionKeySize)
+}
+
+// seal builds the datagram a sender using key would send as seq
+func seal(t *testing.T, key []byte, seq uint64, event *model.InputEvent) []byte {
+	t.Helper()
+	aead, err := motionAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload []byte
+	if event != nil {
+		if payload, err = appendEvent(nil, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	header := make([]byte, motionHeaderSize)
+	header[0] = frameTagMotion
+	binary.BigEndian.PutUint64(header[1:], seq)
+	return aead.Seal(header, motionNonce(seq), payload, header)
+}
+
+func TestMotionRoundTrip(t *testing.T) {
+	l, offer, err := ListenMotion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s, err := DialMotion("127.0.0.1", offer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	l.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	if err := s.Probe(); err != nil {
+		t.Fatal(err)
+	}
+	if event, err := l.Read(); err != nil || event != nil {
+		t.Fatalf("probe read as %+v, %v", event, err)
+	}
+
+	move := &model.InputEvent{Type: model.EventMouseMove, MouseMove: &model.MouseMoveEvent{X: 12, Y: -3}}
+	if err := s.Send(move); err != nil {
+		t.Fatal(err)
+	}
+	event, err := l.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(event, move) {
+		t.Errorf("got %+v, want %+v", event, move)
+	}
+}
+
+func TestMotionSendReliableEvents(t *testing.T) {
+	s := &MotionSender{}
+	for _, event := range []*model.InputEvent{
+		{Type: model.EventMouseRelative, MouseRelative: &model.MouseRelativeEvent{DX: 1}},
+		{Type: model.EventKeyboard, Keyboard: &model.KeyboardEvent{Key: "a", Action: "press"}},
+		{Type: model.EventMouseClick, MouseClick: &model.MouseClickEvent{Button: "left", Action: "press"}},
+	} {
+		if err := s.Send(event); err == nil {
+			t.Errorf("%s event accepted for udp", event.Type)
+		}
+	}
+}
+
+func TestMotionOpen(t *testing.T) {
+	key := testMotionKey(1)
+	move := &model.InputEvent{Type: model.EventMouseMove, MouseMove: &model.MouseMoveEvent{X: 1, Y: 2}}
+	relative := &model.InputEvent{Type: model.EventMouseRelative, MouseRelative: &model.MouseRelativeEvent{DX: 1}}
+	keyboard := &model.InputEvent{Type: model.EventKeyboard, Keyboard: &model.KeyboardEvent{Key: "a", Action: "press"}}
+
+	tampered := seal(t, key, 20, move)
+	tampered[len(tampered)-1] ^= 1
+	renumbered := seal(t, key, 21, move)
+	binary.BigEndian.PutUint64(renumbered[1:], 22)
+
+	// Steps run in order against one listener, which starts at seq 0
+	tests := []struct {
+		name     string
+		datagram []byte
+		wantErr  bool
+	}{
+		{"first", seal(t, key, 5, move), false},
+		{"replayed", seal(t, key, 5, move), true},
+		{"older", seal(t, key, 4, move), true},
+		{"gap", seal(t, key, 10, move), false},
+		{"probe", seal(t, key, 11, nil), false},
+		{"other key", seal(t, testMotionKey(2), 12, move), true},
+		{"tampered", tampered, true},
+		{"renumbered", renumbered, true},
+		{"truncated", seal(t, key, 23, move)[:motionHeaderSize+3], true},
+		{"header only", seal(t, key, 24, move)[:motionHeaderSize], true},
+		{"wrong tag", append([]byte{frameTagEvent}, seal(t, key, 25, move)[1:]...), true},
+		{"relative motion", seal(t, key, 26, relative), true},
+		{"keyboard", seal(t, key, 27, keyboard), true},
+		{"after rejects", seal(t, key, 28, move), false},
+	}
+
+	aead, err := motionAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &MotionListener{aead: aead}
+	for _, tt := range tests {
+		_, err := l.open(tt.datagram)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestMotionNonces(t *testing.T) {
+	sink, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	s, err := DialMotion("127.0.0.1", &UDPOffer{Port: sink.LocalAddr().(*net.UDPAddr).Port, Key: testMotionKey(3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	const senders, perSender = 4, 25
+	var wg sync.WaitGroup
+	for range senders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range perSender {
+				s.Probe()
+			}
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[uint64]bool)
+	buf := make([]byte, maxDatagram)
+	sink.SetReadDeadline(time.Now().Add(time.Second))
+	for len(seen) < senders*perSender {
+		n, err := sink.Read(buf)
+		if err != nil {
+			// Loopback may drop under load, what arrived must still be unique
+			break
+		}
+		seq := binary.BigEndian.Uint64(buf[1:n])
+		if seq == 0 || seen[seq] {
+			t.Fatalf("sequence number %d used twice or zero, it is the AEAD nonce", seq)
+		}
+		seen[seq] = true
+	}
+	if len(seen) == 0 {
+		t.Fatal("no datagrams arrived")
+	}
+}
+
+func TestMotionAEADKeySize(t *testing.T) {
+	for _, size := range []int{0, 16, 31, 33} {
+		if _, err := motionAEAD(make([]byte, size)); err == nil {
+			t.Errorf("accepted a %d byte key", size)
+		}
+	}
+}
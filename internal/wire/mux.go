@@ -0,0 +1,323 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+)
+
+// CapMux is advertised in the hello by peers that can multiplex channels
+// over one connection
+const CapMux = "mux"
+
+// Priority orders channels competing for the connection, lower values are
+// sent first
+type Priority uint8
+
+const (
+	// PriorityInput is for keyboard and pointer traffic
+	PriorityInput Priority = iota
+	// PriorityNormal is for interactive features such as clipboard sync
+	PriorityNormal
+	// PriorityBulk is for transfers that may take many frames
+	PriorityBulk
+
+	numPriorities
+)
+
+// Mux frame types, every frame starts with the type and a big endian
+// channel id
+const (
+	muxOpen byte = iota + 1
+	muxData
+	muxWindow
+	muxClose
+)
+
+const (
+	muxHeaderSize = 3
+
+	// maxChunk bounds a data frame, so a bulk transfer gives the connection
+	// up often enough for input to cut in
+	maxChunk = 16 << 10
+	// initialWindow is how much a channel may send before the peer has to
+	// grant more
+	initialWindow = 256 << 10
+
+	maxMuxFrame   = muxHeaderSize + maxChunk
+	acceptBacklog = 16
+)
+
+// ErrMuxClosed is returned by channels of a Mux that was closed locally
+var ErrMuxClosed = errors.New("mux closed")
+
+// Mux carries independent, flow-controlled channels over one connection.
+// Frames queued on higher priority channels are always written first
+type Mux struct {
+	conn net.Conn
+
+	mu       sync.Mutex
+	channels map[uint16]*Channel
+	nextID   uint16
+	queues   [numPriorities][]*muxFrame
+
+	wake     chan struct{}
+	acceptCh chan *Channel
+
+	done      chan struct{}
+	err       error
+	closeOnce sync.Once
+}
+
+type muxFrame struct {
+	data []byte
+	sent chan error
+}
+
+// NewMux starts multiplexing conn. The two ends must pass different values
+// for client so their channel ids never collide
+func NewMux(conn net.Conn, client bool) *Mux {
+	m := &Mux{
+		conn:     conn,
+		channels: make(map[uint16]*Channel),
+		nextID:   2,
+		wake:     make(chan struct{}, 1),
+		acceptCh: make(chan *Channel, acceptBacklog),
+		done:     make(chan struct{}),
+	}
+	if client {
+		m.nextID = 1
+	}
+
+	go m.readLoop()
+	go m.writeLoop()
+	return m
+}
+
+// Open creates a channel called name. The peer receives it from Accept
+func (m *Mux) Open(name string, priority Priority) (*Channel, error) {
+	if len(name) > 255 {
+		return nil, fmt.Errorf("channel name too long: %d bytes", len(name))
+	}
+	if priority >= numPriorities {
+		return nil, fmt.Errorf("invalid channel priority %d", priority)
+	}
+
+	m.mu.Lock()
+	id, err := m.allocateID()
+	if err != nil {
+		m.mu.Unlock()
+		return nil, err
+	}
+	ch := newChannel(m, id, name, priority)
+	m.channels[id] = ch
+	m.mu.Unlock()
+
+	payload := append([]byte{byte(priority)}, name...)
+	if err := m.send(priority, muxOpen, id, payload, nil); err != nil {
+		m.remove(id)
+		return nil, fmt.Errorf("failed to open channel %s: %w", name, err)
+	}
+	return ch, nil
+}
+
+// Accept waits for the peer to open a channel
+func (m *Mux) Accept() (*Channel, error) {
+	select {
+	case ch := <-m.acceptCh:
+		return ch, nil
+	case <-m.done:
+		return nil, m.err
+	}
+}
+
+// Done is closed once the mux stops, Err then tells why
+func (m *Mux) Done() <-chan struct{} {
+	return m.done
+}
+
+// Err returns why the mux stopped, nil while it is running
+func (m *Mux) Err() error {
+	select {
+	case <-m.done:
+		return m.err
+	default:
+		return nil
+	}
+}
+
+// Close closes every channel and the underlying connection
+func (m *Mux) Close() error {
+	m.fail(ErrMuxClosed)
+	return nil
+}
+
+func (m *Mux) fail(err error) {
+	m.closeOnce.Do(func() {
+		m.err = err
+		close(m.done)
+		m.conn.Close()
+	})
+}
+
+// allocateID returns a free id of our parity, m.mu must be held
+func (m *Mux) allocateID() (uint16, error) {
+	for range 1 << 15 {
+		id := m.nextID
+		m.nextID += 2
+		if _, ok := m.channels[id]; !ok {
+			return id, nil
+		}
+	}
+	return 0, errors.New("no free channel ids")
+}
+
+func (m *Mux) channel(id uint16) *Channel {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.channels[id]
+}
+
+func (m *Mux) remove(id uint16) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.channels, id)
+}
+
+// enqueue queues a frame for the writer without waiting for it
+func (m *Mux) enqueue(priority Priority, typ byte, id uint16, payload []byte) *muxFrame {
+	data := make([]byte, muxHeaderSize+len(payload))
+	data[0] = typ
+	binary.BigEndian.PutUint16(data[1:], id)
+	copy(data[muxHeaderSize:], payload)
+	f := &muxFrame{data: data, sent: make(chan error, 1)}
+
+	m.mu.Lock()
+	m.queues[priority] = append(m.queues[priority], f)
+	m.mu.Unlock()
+
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+	return f
+}
+
+// send queues a frame and waits until it is written, the mux stops or
+// cancel is closed
+func (m *Mux) send(priority Priority, typ byte, id uint16, payload []byte, cancel <-chan struct{}) error {
+	f := m.enqueue(priority, typ, id, payload)
+	select {
+	case err := <-f.sent:
+		return err
+	case <-m.done:
+		return m.err
+	case <-cancel:
+		return errDeadlineExceeded
+	}
+}
+
+// next pops the oldest frame of the highest priority queue, blocking while
+// all queues are empty
+func (m *Mux) next() (*muxFrame, bool) {
+	for {
+		m.mu.Lock()
+		for p := range m.queues {
+			if q := m.queues[p]; len(q) > 0 {
+				m.queues[p] = q[1:]
+				m.mu.Unlock()
+				return q[0], true
+			}
+		}
+		m.mu.Unlock()
+
+		select {
+		case <-m.wake:
+		case <-m.done:
+			return nil, false
+		}
+	}
+}
+
+func (m *Mux) writeLoop() {
+	for {
+		f, ok := m.next()
+		if !ok {
+			return
+		}
+		err := writeFrame(m.conn, f.data, maxMuxFrame)
+		f.sent <- err
+		if err != nil {
+			m.fail(err)
+			return
+		}
+	}
+}
+
+func (m *Mux) readLoop() {
+	for {
+		data, err := readFrame(m.conn, maxMuxFrame)
+		if err == nil {
+			err = m.handle(data)
+		}
+		if err != nil {
+			m.fail(err)
+			return
+		}
+	}
+}
+
+func (m *Mux) handle(data []byte) error {
+	if len(data) < muxHeaderSize {
+		return &MalformedPayloadError{Err: fmt.Errorf("mux frame of %d bytes", len(data))}
+	}
+	typ, id, payload := data[0], binary.BigEndian.Uint16(data[1:]), data[muxHeaderSize:]
+
+	switch typ {
+	case muxOpen:
+		if len(payload) < 1 || Priority(payload[0]) >= numPriorities {
+			return &MalformedPayloadError{Err: fmt.Errorf("bad open for channel %d", id)}
+		}
+		m.mu.Lock()
+		if _, ok := m.channels[id]; ok {
+			m.mu.Unlock()
+			return &MalformedPayloadError{Err: fmt.Errorf("channel %d opened twice", id)}
+		}
+		ch := newChannel(m, id, string(payload[1:]), Priority(payload[0]))
+		m.channels[id] = ch
+		m.mu.Unlock()
+
+		select {
+		case m.acceptCh <- ch:
+		default:
+			log.Printf("[wire] Refusing channel %s, accept backlog full", ch.name)
+			ch.Close()
+		}
+
+	case muxData:
+		// Data for a channel we already closed is still in flight, drop it
+		if ch := m.channel(id); ch != nil {
+			return ch.deliver(payload)
+		}
+
+	case muxWindow:
+		if len(payload) != 4 {
+			return &MalformedPayloadError{Err: fmt.Errorf("bad window update for channel %d", id)}
+		}
+		if ch := m.channel(id); ch != nil {
+			ch.grant(binary.BigEndian.Uint32(payload))
+		}
+
+	case muxClose:
+		if ch := m.channel(id); ch != nil {
+			ch.remoteClose()
+		}
+
+	default:
+		return &UnknownTypeError{Type: fmt.Sprintf("mux frame %d", typ)}
+	}
+	return nil
+}
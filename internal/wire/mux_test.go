@@ -0,0 +1,210 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// muxPair multiplexes both ends of a loopback connection
+func muxPair(t *testing.T) (client, server *Mux) {
+	t.Helper()
+	a, b := tcpPair(t)
+	client, server = NewMux(a, true), NewMux(b, false)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+// idleMux is a mux without reader and writer, for driving its internals
+func idleMux() *Mux {
+	return &Mux{
+		channels: make(map[uint16]*Channel),
+		wake:     make(chan struct{}, 1),
+		acceptCh: make(chan *Channel, acceptBacklog),
+		done:     make(chan struct{}),
+	}
+}
+
+func muxFrameData(typ byte, id uint16, payload []byte) []byte {
+	data := []byte{typ, 0, 0}
+	binary.BigEndian.PutUint16(data[1:], id)
+	return append(data, payload...)
+}
+
+func TestMuxChannels(t *testing.T) {
+	client, server := muxPair(t)
+
+	input, err := client.Open("input", PriorityInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bulk, err := client.Open("bulk", PriorityBulk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accepted := make(map[string]*Channel)
+	for range 2 {
+		ch, err := server.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		accepted[ch.Name()] = ch
+	}
+	if ch := accepted["bulk"]; ch == nil || ch.Priority() != PriorityBulk {
+		t.Fatalf("bulk channel arrived as %+v", ch)
+	}
+
+	// Channels are independent in both directions
+	go input.Write([]byte("keys"))
+	go accepted["bulk"].Write([]byte("file"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(accepted["input"], buf); err != nil || string(buf) != "keys" {
+		t.Fatalf("input read %q, %v", buf, err)
+	}
+	if _, err := io.ReadFull(bulk, buf); err != nil || string(buf) != "file" {
+		t.Fatalf("bulk read %q, %v", buf, err)
+	}
+
+	// Closing one end reaches the other as EOF, the rest keeps working
+	bulk.Close()
+	if _, err := accepted["bulk"].Read(buf); !errors.Is(err, io.EOF) {
+		t.Errorf("read after remote close: %v, want EOF", err)
+	}
+	if _, err := bulk.Read(buf); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("read after local close: %v, want ErrClosed", err)
+	}
+	go accepted["input"].Write([]byte("more"))
+	if _, err := io.ReadFull(input, buf); err != nil || string(buf) != "more" {
+		t.Fatalf("input read after closing bulk %q, %v", buf, err)
+	}
+}
+
+func TestMuxFlowControl(t *testing.T) {
+	client, server := muxPair(t)
+	ch, err := client.Open("bulk", PriorityBulk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, err := server.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 3*initialWindow/16)
+
+	// Nobody reads, so the writer stalls once the window is used up
+	ch.SetWriteDeadline(time.Now().Add(200 * time.Millisecond))
+	n, err := ch.Write(payload)
+	if !errors.Is(err, errDeadlineExceeded) {
+		t.Fatalf("write without reader: %d bytes, %v, want deadline exceeded", n, err)
+	}
+	if n != initialWindow {
+		t.Fatalf("wrote %d bytes without window updates, want %d", n, initialWindow)
+	}
+
+	// Reading grants more window and the rest goes through
+	ch.SetWriteDeadline(time.Time{})
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := ch.Write(payload[n:])
+		errCh <- err
+	}()
+	got := make([]byte, len(payload))
+	if _, err := io.ReadFull(peer, got); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Error("payload corrupted on the way")
+	}
+}
+
+func TestMuxWindowOverrun(t *testing.T) {
+	a, b := tcpPair(t)
+	m := NewMux(b, false)
+	defer m.Close()
+
+	// A peer ignoring flow control sends past the window it was granted
+	writeFrame(a, muxFrameData(muxOpen, 1, append([]byte{byte(PriorityBulk)}, "bulk"...)), maxMuxFrame)
+	chunk := make([]byte, maxChunk)
+	go func() {
+		for range initialWindow/maxChunk + 1 {
+			if writeFrame(a, muxFrameData(muxData, 1, chunk), maxMuxFrame) != nil {
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-m.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("mux kept running after a window overrun")
+	}
+	if !isMalformed(m.Err()) {
+		t.Errorf("mux stopped with %v, want MalformedPayloadError", m.Err())
+	}
+}
+
+func TestMuxMalformedFrames(t *testing.T) {
+	tests := []struct {
+		name    string
+		frames  [][]byte
+		wantErr func(error) bool
+	}{
+		{"open", [][]byte{muxFrameData(muxOpen, 1, []byte{byte(PriorityInput), 'x'})}, nil},
+		{"short frame", [][]byte{{muxData, 0}}, isMalformed},
+		{"open without priority", [][]byte{muxFrameData(muxOpen, 1, nil)}, isMalformed},
+		{"open with bad priority", [][]byte{muxFrameData(muxOpen, 1, []byte{byte(numPriorities)})}, isMalformed},
+		{"opened twice", [][]byte{
+			muxFrameData(muxOpen, 1, []byte{byte(PriorityInput)}),
+			muxFrameData(muxOpen, 1, []byte{byte(PriorityInput)}),
+		}, isMalformed},
+		{"short window update", [][]byte{muxFrameData(muxWindow, 1, []byte{1})}, isMalformed},
+		{"data for unknown channel", [][]byte{muxFrameData(muxData, 9, []byte("late"))}, nil},
+		{"close for unknown channel", [][]byte{muxFrameData(muxClose, 9, nil)}, nil},
+		{"unknown frame type", [][]byte{muxFrameData(0x7f, 1, nil)}, isUnknownType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := idleMux()
+			var err error
+			for _, f := range tt.frames {
+				if err = m.handle(f); err != nil {
+					break
+				}
+			}
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !tt.wantErr(err) {
+				t.Errorf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestMuxPriority(t *testing.T) {
+	m := idleMux()
+	m.enqueue(PriorityBulk, muxData, 1, []byte("bulk 1"))
+	m.enqueue(PriorityNormal, muxData, 3, []byte("normal"))
+	m.enqueue(PriorityBulk, muxData, 1, []byte("bulk 2"))
+	m.enqueue(PriorityInput, muxData, 5, []byte("input"))
+
+	for _, want := range []string{"input", "normal", "bulk 1", "bulk 2"} {
+		f, ok := m.next()
+		if !ok {
+			t.Fatal("queue ran dry")
+		}
+		if got := string(f.data[muxHeaderSize:]); got != want {
+			t.Fatalf("sent %q, want %q", got, want)
+		}
+	}
+}
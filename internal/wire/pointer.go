@@ -0,0 +1,16 @@
+package wire
+
+// CapPointer is advertised by a controller switching at screen edges and by
+// receivers that can tell it where their pointer is
+const CapPointer = "pointer_report"
+
+// MsgPointer is sent by the receiver after moving its pointer, so an edge
+// switching controller knows when the pointer is back at the edge facing it
+const MsgPointer = "pointer"
+
+// Pointer is the payload of MsgPointer, the pointer position on the
+// receiver's screen
+type Pointer struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
@@ -0,0 +1,151 @@
+package wire
+
+import (
+	"context"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	minReverseBackoff = time.Second
+	maxReverseBackoff = 30 * time.Second
+
+	// stableReverseSession is how long a reverse connection must last for
+	// the next one to be dialed right away. Shorter ones usually mean the
+	// controller was not waiting for us
+	stableReverseSession = 10 * time.Second
+)
+
+// ReverseAddr is the address of a ReverseListener: the controller it dials
+type ReverseAddr string
+
+func (a ReverseAddr) Network() string {
+	return "reverse"
+}
+
+func (a ReverseAddr) String() string {
+	return "controller " + string(a)
+}
+
+// ReverseListener hands the server connections that it dials out to a
+// controller, for receivers behind NAT or a firewall that refuses inbound
+// connections. Once connected the roles are the usual ones: the controller
+// runs the client side of TLS, hello and pairing. It keeps one connection
+// open at a time and dials again when it closes
+type ReverseListener struct {
+	addr    string
+	timeout time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// closed receives how long the previous connection lasted once it is
+	// closed
+	closed  chan time.Duration
+	backoff time.Duration
+}
+
+// ListenReverse returns a listener that dials the controller at addr, each
+// attempt bounded by dialTimeout or DefaultDialTimeout when zero. An
+// unreachable controller is retried rather than reported
+func ListenReverse(addr string, dialTimeout time.Duration) *ReverseListener {
+	if dialTimeout <= 0 {
+		dialTimeout = DefaultDialTimeout
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &ReverseListener{
+		addr:    addr,
+		timeout: dialTimeout,
+		ctx:     ctx,
+		cancel:  cancel,
+		closed:  make(chan time.Duration, 1),
+		backoff: minReverseBackoff,
+	}
+	l.closed <- stableReverseSession
+	return l
+}
+
+// Accept waits for the previous connection to close, then dials the
+// controller until it answers
+func (l *ReverseListener) Accept() (net.Conn, error) {
+	var lasted time.Duration
+	select {
+	case lasted = <-l.closed:
+	case <-l.ctx.Done():
+		return nil, net.ErrClosed
+	}
+
+	if lasted >= stableReverseSession {
+		l.backoff = minReverseBackoff
+	} else if !l.wait() {
+		return nil, net.ErrClosed
+	}
+
+	for {
+		conn, err := l.dial()
+		if err == nil {
+			log.Printf("[server] Connected out to controller %s", l.addr)
+			return &reverseConn{Conn: conn, closed: l.closed, since: time.Now()}, nil
+		}
+		if l.ctx.Err() != nil {
+			return nil, net.ErrClosed
+		}
+		log.Printf("[server] Controller %s unreachable: %v, retrying in %s", l.addr, err, l.backoff)
+		if !l.wait() {
+			return nil, net.ErrClosed
+		}
+	}
+}
+
+// Close stops dialing. A connection already handed out stays open
+func (l *ReverseListener) Close() error {
+	l.cancel()
+	return nil
+}
+
+// Addr returns the controller address dialed
+func (l *ReverseListener) Addr() net.Addr {
+	return ReverseAddr(l.addr)
+}
+
+func (l *ReverseListener) dial() (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(l.ctx, l.timeout)
+	defer cancel()
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", l.addr)
+}
+
+// wait sleeps for the current backoff and doubles it, reporting false when
+// the listener was closed meanwhile
+func (l *ReverseListener) wait() bool {
+	select {
+	case <-time.After(l.backoff):
+	case <-l.ctx.Done():
+		return false
+	}
+	l.backoff = min(l.backoff*2, maxReverseBackoff)
+	return true
+}
+
+// reverseConn lets the listener dial again once the connection is closed
+type reverseConn struct {
+	net.Conn
+	closed chan<- time.Duration
+	since  time.Time
+	once   sync.Once
+}
+
+func (c *reverseConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() {
+		c.closed <- time.Since(c.since)
+	})
+	return err
+}
+
+// NetConn returns the dialed connection
+func (c *reverseConn) NetConn() net.Conn {
+	return c.Conn
+}
@@ -0,0 +1,151 @@
+package wire
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// controllerListener is where a reverse listener dials to
+func controllerListener(t *testing.T) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return ln
+}
+
+func TestReverseListener(t *testing.T) {
+	ln := controllerListener(t)
+	l := ListenReverse(ln.Addr().String(), time.Second)
+	defer l.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	// The first connection is dialed right away
+	first := <-accepted
+	if first == nil {
+		t.Fatal("accept failed")
+	}
+	theirs, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer theirs.Close()
+	if got, want := theirs.RemoteAddr().String(), first.LocalAddr().String(); got != want {
+		t.Errorf("controller sees %s, want %s", got, want)
+	}
+
+	// One connection at a time
+	select {
+	case <-accepted:
+		t.Fatal("dialed again while the first connection is open")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// A short session backs off before dialing again
+	closedAt := time.Now()
+	first.Close()
+	first.Close() // Closing twice must not let two dials through
+	select {
+	case second := <-accepted:
+		if second == nil {
+			t.Fatal("accept failed")
+		}
+		defer second.Close()
+		if waited := time.Since(closedAt); waited < minReverseBackoff {
+			t.Errorf("dialed again after %s, want a backoff of %s", waited, minReverseBackoff)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no new connection after the first closed")
+	}
+	select {
+	case <-accepted:
+		t.Error("a double close dialed twice")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if l.Addr().Network() != "reverse" || l.Addr().String() != "controller "+ln.Addr().String() {
+		t.Errorf("address %s %s", l.Addr().Network(), l.Addr())
+	}
+}
+
+func TestReverseListenerClose(t *testing.T) {
+	// Nothing listens there, so Accept keeps retrying until closed
+	ln := controllerListener(t)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	l := ListenReverse(addr, 50*time.Millisecond)
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := l.Accept()
+		errCh <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	l.Close()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Errorf("got %v, want ErrClosed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("accept kept retrying after close")
+	}
+}
+
+func TestReverseSession(t *testing.T) {
+	receiver := newSecurity(t)
+	srv, err := NewServer("127.0.0.1:0", receiver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Start(context.Background(), echo); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	// The receiver dials out, the controller still runs the client side
+	ln := controllerListener(t)
+	if err := srv.Serve(ListenReverse(ln.Addr().String(), time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	d := Dialer{Security: newSecurity(t)}
+	c, err := d.Handshake(ctx, conn, "receiver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if got := c.PeerFingerprint(); got != receiver.Identity.Fingerprint {
+		t.Errorf("pinned %s, want the receiver's %s", got, receiver.Identity.Fingerprint)
+	}
+
+	if err := c.Send(ctx, MsgControlStart, &ControlStart{}); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := c.Read(ctx); err != nil || msg.Type != MsgControlStart {
+		t.Fatalf("echo came back as %+v, %v", msg, err)
+	}
+}
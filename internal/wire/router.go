@@ -0,0 +1,80 @@
+package wire
+
+import (
+	"context"
+	"fmt"
+)
+
+// Handler processes one message received on c. Returning an error ends the
+// connection being served
+type Handler func(ctx context.Context, c *Conn, msg *Message) error
+
+// Middleware wraps every Handler of a Router
+type Middleware func(next Handler) Handler
+
+// Router dispatches messages to the handler registered for their type.
+// Types nobody registered are rejected with an UnknownTypeError
+type Router struct {
+	handlers   map[string]Handler
+	middleware []Middleware
+}
+
+// NewRouter returns an empty router
+func NewRouter() *Router {
+	return &Router{
+		handlers: make(map[string]Handler),
+	}
+}
+
+// Use appends middleware, the first one added sees messages first
+func (r *Router) Use(middleware ...Middleware) {
+	r.middleware = append(r.middleware, middleware...)
+}
+
+// Handle registers h for messages of msgType
+func (r *Router) Handle(msgType string, h Handler) {
+	if _, ok := r.handlers[msgType]; ok {
+		panic(fmt.Sprintf("wire: handler for %s registered twice", msgType))
+	}
+	r.handlers[msgType] = h
+}
+
+// Register registers h for messages of msgType, decoding their payload into
+// a T first
+func Register[T any](r *Router, msgType string, h func(ctx context.Context, c *Conn, payload *T) error) {
+	r.Handle(msgType, func(ctx context.Context, c *Conn, msg *Message) error {
+		var payload T
+		if err := msg.Decode(&payload); err != nil {
+			return err
+		}
+		return h(ctx, c, &payload)
+	})
+}
+
+// Dispatch runs the handler for msg through the middleware
+func (r *Router) Dispatch(ctx context.Context, c *Conn, msg *Message) error {
+	h, ok := r.handlers[msg.Type]
+	if !ok {
+		h = func(context.Context, *Conn, *Message) error {
+			return &UnknownTypeError{Type: msg.Type}
+		}
+	}
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		h = r.middleware[i](h)
+	}
+	return h(ctx, c, msg)
+}
+
+// Serve reads messages from c and dispatches them until reading or a
+// handler fails, or ctx is done
+func (r *Router) Serve(ctx context.Context, c *Conn) error {
+	for {
+		msg, err := c.Read(ctx)
+		if err != nil {
+			return err
+		}
+		if err := r.Dispatch(ctx, c, msg); err != nil {
+			return err
+		}
+	}
+}
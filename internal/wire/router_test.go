@@ -0,0 +1,115 @@
+package wire
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRouterDispatch(t *testing.T) {
+	var calls []string
+	r := NewRouter()
+	r.Use(
+		func(next Handler) Handler {
+			return func(ctx context.Context, c *Conn, msg *Message) error {
+				calls = append(calls, "outer")
+				return next(ctx, c, msg)
+			}
+		},
+		func(next Handler) Handler {
+			return func(ctx context.Context, c *Conn, msg *Message) error {
+				calls = append(calls, "inner")
+				if msg.Type == MsgControlAck {
+					return nil // Dropped before any handler
+				}
+				return next(ctx, c, msg)
+			}
+		},
+	)
+	Register(r, MsgBye, func(_ context.Context, _ *Conn, bye *Bye) error {
+		calls = append(calls, "bye:"+bye.Reason)
+		return nil
+	})
+
+	byeMsg, err := NewMessage(MsgBye, &Bye{Reason: "done"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		msg     *Message
+		calls   []string
+		wantErr func(error) bool
+	}{
+		{"typed payload", byeMsg, []string{"outer", "inner", "bye:done"}, nil},
+		{"middleware drops", &Message{Type: MsgControlAck}, []string{"outer", "inner"}, nil},
+		{"unknown type", &Message{Type: "custom"}, []string{"outer", "inner"}, isUnknownType},
+		{"malformed payload", &Message{Type: MsgBye, Data: "{"}, []string{"outer", "inner"}, isMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = nil
+			err := r.Dispatch(context.Background(), nil, tt.msg)
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !tt.wantErr(err) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !slices.Equal(calls, tt.calls) {
+				t.Errorf("calls %q, want %q", calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestRouterDuplicateHandler(t *testing.T) {
+	r := NewRouter()
+	r.Handle(MsgPing, func(context.Context, *Conn, *Message) error { return nil })
+	defer func() {
+		if recover() == nil {
+			t.Error("second handler for the same type was accepted")
+		}
+	}()
+	r.Handle(MsgPing, func(context.Context, *Conn, *Message) error { return nil })
+}
+
+func TestRouterServe(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	stop := errors.New("stop")
+	var starts int
+	r := NewRouter()
+	Register(r, MsgControlStart, func(context.Context, *Conn, *ControlStart) error {
+		starts++
+		return nil
+	})
+	Register(r, MsgBye, func(context.Context, *Conn, *Bye) error {
+		return stop
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() {
+		peer := NewConn(a)
+		peer.Send(ctx, MsgControlStart, &ControlStart{})
+		peer.Send(ctx, MsgControlStart, &ControlStart{})
+		peer.Send(ctx, MsgBye, &Bye{})
+	}()
+
+	if err := r.Serve(ctx, NewConn(b)); !errors.Is(err, stop) {
+		t.Fatalf("got %v, want the handler's error", err)
+	}
+	if starts != 2 {
+		t.Errorf("%d control starts handled, want 2", starts)
+	}
+}
+
+func isUnknownType(err error) bool {
+	var unknown *UnknownTypeError
+	return errors.As(err, &unknown)
+}
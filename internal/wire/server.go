@@ -1,20 +1,94 @@
 package wire
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net"
+	"sort"
+	"sync"
+	"time"
 )
 
+// ErrServerClosed is returned by Start after Shutdown or Close
+var ErrServerClosed = errors.New("server closed")
+
+const (
+	minAcceptBackoff = 5 * time.Millisecond
+	maxAcceptBackoff = time.Second
+)
+
+// ConnHandler serves one accepted connection. ctx is canceled when the
+// server shuts down, the handler should then say goodbye and return
+type ConnHandler func(ctx context.Context, sess *ServerSession)
+
 type Server struct {
 	addr   string
+	sec    *Security
 	ln     net.Listener
-	conn   net.Conn
-	onConn func(*Server, net.Conn)
+	extra  []net.Listener
+	onConn ConnHandler
+
+	hsTimeout time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	sessions map[uint64]*ServerSession
+	nextID   uint64
+	closing  bool
+
+	banMu sync.Mutex
+	bans  map[string]time.Time
+}
+
+// SessionInfo describes an active connection for display
+type SessionInfo struct {
+	ID          uint64    `json:"id"`
+	RemoteAddr  string    `json:"remote_addr"`
+	Fingerprint string    `json:"fingerprint"`
+	Hostname    string    `json:"hostname"`
+	Since       time.Time `json:"since"`
+}
+
+// ServerSession is a connection tracked by the server for as long as its
+// handler runs
+type ServerSession struct {
+	raw  net.Conn
+	conn net.Conn
+
+	mu   sync.Mutex
+	info SessionInfo
+}
+
+// Conn returns the accepted connection, with TLS and WebSocket framing
+// already taken care of
+func (s *ServerSession) Conn() net.Conn {
+	return s.conn
+}
+
+// SetPeer records who is on the other end once the handshake told us
+func (s *ServerSession) SetPeer(fingerprint, hostname string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.info.Fingerprint = fingerprint
+	s.info.Hostname = hostname
 }
 
-func NewServer(addr string) (*Server, error) {
+// Info returns a snapshot of the session description
+func (s *ServerSession) Info() SessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.info
+}
+
+// NewServer listens on addr, accepting TLS connections unless sec is nil or
+// insecure. Raw TCP and WebSocket clients are both served on addr
+func NewServer(addr string, sec *Security) (*Server, error) {
 	ln, err := net.Listen("tcp", addr)
 	if err != nil {
 		// Check if it's a port already in use error
@@ -28,74 +102,271 @@ func NewServer(addr string) (*Server, error) {
 	}
 
 	return &Server{
-		addr: addr,
-		ln:   ln,
+		addr:     addr,
+		sec:      sec,
+		ln:       ln,
+		sessions: make(map[uint64]*ServerSession),
+		bans:     make(map[string]time.Time),
 	}, nil
 }
 
-// Start starts the server and accepts connections
-func (s *Server) Start(onConn func(*Server, net.Conn)) error {
+// SetHandshakeTimeout bounds how long an accepted connection gets to finish
+// WebSocket and TLS setup, HandshakeTimeout when zero. Call it before Start
+func (s *Server) SetHandshakeTimeout(timeout time.Duration) {
+	s.hsTimeout = timeout
+}
+
+// handshakeTimeout returns the configured handshake bound
+func (s *Server) handshakeTimeout() time.Duration {
+	if s.hsTimeout > 0 {
+		return s.hsTimeout
+	}
+	return HandshakeTimeout
+}
+
+// Start accepts connections in the background, running onConn for each in
+// its own goroutine. Canceling ctx has the same effect as Close
+func (s *Server) Start(ctx context.Context, onConn ConnHandler) error {
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
 	s.onConn = onConn
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	s.mu.Unlock()
+
 	go func() {
-		for {
-			conn, err := s.ln.Accept()
-			if err != nil {
-				log.Printf("[server] Accept error: %v", err)
-				continue
-			}
-			remoteAddr := conn.RemoteAddr()
-			log.Printf("[server] New connection accepted from %s", remoteAddr)
-
-			// Handle connection immediately in a separate goroutine to avoid blocking
-			if s.onConn != nil {
-				// Call handler in a goroutine to ensure it doesn't block accepting new connections
-				go func(c net.Conn) {
-					s.onConn(s, c)
-				}(conn)
-			} else {
-				conn.Close()
-			}
-		}
+		<-s.ctx.Done()
+		s.closeListeners()
 	}()
+	go s.acceptLoop(s.ln)
+
 	log.Printf("[server] Listening on %s", s.addr)
 	return nil
 }
 
-// SetConn sets the active connection for this server instance
-func (s *Server) SetConn(conn net.Conn) {
-	s.conn = conn
+// Serve accepts connections from ln as well, treated like those of the main
+// listener, for example streams arriving through a relay. It must be called
+// after Start, the server closes ln when it stops
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing || s.ctx == nil {
+		ln.Close()
+		return ErrServerClosed
+	}
+
+	s.extra = append(s.extra, ln)
+	go s.acceptLoop(ln)
+
+	log.Printf("[server] Also listening on %s", ln.Addr())
+	return nil
+}
+
+func (s *Server) acceptLoop(ln net.Listener) {
+	backoff := minAcceptBackoff
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// Usually running out of file descriptors, give it a moment
+			// instead of spinning
+			log.Printf("[server] Accept error: %v, retrying in %s", err, backoff)
+			time.Sleep(backoff)
+			backoff = min(backoff*2, maxAcceptBackoff)
+			continue
+		}
+		backoff = minAcceptBackoff
+
+		remoteAddr := conn.RemoteAddr()
+		if s.banned(remoteAddr) {
+			log.Printf("[server] Refused banned peer %s", remoteAddr)
+			conn.Close()
+			continue
+		}
+		log.Printf("[server] New connection accepted from %s", remoteAddr)
+
+		sess := s.track(conn)
+		if sess == nil {
+			conn.Close()
+			return
+		}
+		go s.serve(sess)
+	}
 }
 
-// Read reads a message from the active connection
-func (s *Server) Read() (*Message, error) {
-	if s.conn == nil {
-		return nil, fmt.Errorf("no active connection")
+// track registers a new session, or returns nil when shutting down
+func (s *Server) track(conn net.Conn) *ServerSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return nil
 	}
-	var msg Message
-	if err := Receive(s.conn, &msg); err != nil {
-		if err == io.EOF {
-			log.Printf("[server] Connection closed by peer")
+
+	s.nextID++
+	sess := &ServerSession{
+		raw: conn,
+		info: SessionInfo{
+			ID:         s.nextID,
+			RemoteAddr: conn.RemoteAddr().String(),
+			Since:      time.Now(),
+		},
+	}
+	s.sessions[sess.info.ID] = sess
+	s.wg.Add(1)
+	return sess
+}
+
+func (s *Server) serve(sess *ServerSession) {
+	defer func() {
+		if sess.conn != nil {
+			sess.conn.Close()
 		}
+		sess.raw.Close()
+		s.mu.Lock()
+		delete(s.sessions, sess.info.ID)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+
+	conn, err := s.upgrade(sess.raw)
+	if err != nil {
+		log.Printf("[server] Rejected %s: %v", sess.raw.RemoteAddr(), err)
+		return
+	}
+	sess.conn = conn
+	s.onConn(s.ctx, sess)
+}
+
+// upgrade brings an accepted connection up to where the protocol starts.
+// WebSocket framing is detected on both sides of TLS: ws:// peers run TLS
+// inside the WebSocket, wss:// peers the WebSocket inside TLS
+func (s *Server) upgrade(raw net.Conn) (net.Conn, error) {
+	timeout := s.handshakeTimeout()
+	raw.SetDeadline(time.Now().Add(timeout))
+	defer raw.SetDeadline(time.Time{})
+
+	conn, err := sniff(raw)
+	if err != nil {
+		return nil, err
+	}
+	if !s.sec.enabled() {
+		return conn, nil
+	}
+	_, isWebSocket := conn.(*wsConn)
+
+	// The upgrade clears deadlines
+	raw.SetDeadline(time.Now().Add(timeout))
+	conn = tls.Server(conn, s.sec.serverConfig())
+	if err := handshake(s.ctx, conn, timeout); err != nil {
 		return nil, err
 	}
-	return &msg, nil
+	if isWebSocket {
+		return conn, nil
+	}
+	return sniff(conn)
 }
 
-// Write sends a message to the active connection
-func (s *Server) Write(msg *Message) error {
-	if s.conn == nil {
-		return fmt.Errorf("no active connection")
+// Sessions lists the connections currently being served
+func (s *Server) Sessions() []SessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	infos := make([]SessionInfo, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		infos = append(infos, sess.Info())
 	}
-	return Send(s.conn, msg)
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
 }
 
-// Close closes the active connection and listener
-func (s *Server) Close() error {
-	if s.conn != nil {
-		s.conn.Close()
+// Ban refuses new connections from ip for d, typically after the peer broke
+// the protocol
+func (s *Server) Ban(ip string, d time.Duration) {
+	s.banMu.Lock()
+	defer s.banMu.Unlock()
+	s.bans[ip] = time.Now().Add(d)
+}
+
+func (s *Server) banned(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
 	}
-	if s.ln != nil {
-		return s.ln.Close()
+	ip := tcpAddr.IP.String()
+
+	s.banMu.Lock()
+	defer s.banMu.Unlock()
+	until, ok := s.bans[ip]
+	if !ok {
+		return false
 	}
+	if time.Now().After(until) {
+		delete(s.bans, ip)
+		return false
+	}
+	return true
+}
+
+// Shutdown stops accepting, cancels the context of every handler so they
+// can wind their sessions down, and waits for them to return. If ctx ends
+// first the remaining connections are closed and ctx's error returned
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stop()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.closeSessions()
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting and closes every connection without waiting for
+// the handlers
+func (s *Server) Close() error {
+	s.stop()
+	s.closeSessions()
 	return nil
 }
+
+func (s *Server) stop() {
+	s.mu.Lock()
+	s.closing = true
+	cancel := s.cancel
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	s.closeListeners()
+}
+
+func (s *Server) closeListeners() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ln.Close()
+	for _, ln := range s.extra {
+		ln.Close()
+	}
+}
+
+func (s *Server) closeSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sess := range s.sessions {
+		sess.raw.Close()
+	}
+}
@@ -0,0 +1,188 @@
+package wire
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// plainServer starts a server without TLS on a loopback port
+func plainServer(t *testing.T, onConn ConnHandler) (*Server, string) {
+	t.Helper()
+	srv, err := NewServer("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Start(context.Background(), onConn); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv, srv.ln.Addr().String()
+}
+
+// knock connects to addr and sends the bytes the server sniffs before
+// handing the connection over
+func knock(t *testing.T, addr string) net.Conn {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if _, err := conn.Write([]byte("knock")); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// closedByServer reports whether the server hung up on conn
+func closedByServer(conn net.Conn) bool {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err := conn.Read(make([]byte, 1))
+	var netErr net.Error
+	return err != nil && !(errors.As(err, &netErr) && netErr.Timeout())
+}
+
+func TestServerShutdown(t *testing.T) {
+	started := make(chan struct{})
+	returned := make(chan struct{})
+	srv, addr := plainServer(t, func(ctx context.Context, sess *ServerSession) {
+		close(started)
+		<-ctx.Done() // A well behaved handler says goodbye here
+		close(returned)
+	})
+	knock(t, addr)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	select {
+	case <-returned:
+	default:
+		t.Error("shutdown returned before the handler")
+	}
+	if len(srv.Sessions()) != 0 {
+		t.Errorf("sessions left after shutdown: %+v", srv.Sessions())
+	}
+
+	if _, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+		t.Error("still accepting after shutdown")
+	}
+	if err := srv.Start(context.Background(), nil); !errors.Is(err, ErrServerClosed) {
+		t.Errorf("start after shutdown: %v, want ErrServerClosed", err)
+	}
+}
+
+func TestServerShutdownDeadline(t *testing.T) {
+	started := make(chan struct{})
+	srv, addr := plainServer(t, func(_ context.Context, sess *ServerSession) {
+		close(started)
+		io.Copy(io.Discard, sess.Conn()) // Ignores ctx, only a close ends it
+	})
+	conn := knock(t, addr)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("shutdown: %v, want deadline exceeded", err)
+	}
+	if !closedByServer(conn) {
+		t.Error("connection left open after the shutdown deadline")
+	}
+}
+
+func TestServerSessions(t *testing.T) {
+	release := make(chan struct{})
+	srv, addr := plainServer(t, func(_ context.Context, sess *ServerSession) {
+		sess.SetPeer("fp-"+sess.Conn().RemoteAddr().String(), "host")
+		<-release
+	})
+	defer close(release)
+
+	a, b := knock(t, addr), knock(t, addr)
+	var infos []SessionInfo
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if infos = srv.Sessions(); len(infos) == 2 && infos[0].Fingerprint != "" && infos[1].Fingerprint != "" {
+			break
+		}
+	}
+	if len(infos) != 2 {
+		t.Fatalf("%d sessions, want 2", len(infos))
+	}
+	if infos[0].ID >= infos[1].ID {
+		t.Errorf("sessions not ordered by id: %+v", infos)
+	}
+	remotes := map[string]bool{infos[0].RemoteAddr: true, infos[1].RemoteAddr: true}
+	for _, c := range []net.Conn{a, b} {
+		if !remotes[c.LocalAddr().String()] {
+			t.Errorf("no session for %s in %+v", c.LocalAddr(), infos)
+		}
+	}
+	if infos[0].Fingerprint != "fp-"+infos[0].RemoteAddr || infos[0].Hostname != "host" {
+		t.Errorf("SetPeer not reflected: %+v", infos[0])
+	}
+}
+
+func TestServerBan(t *testing.T) {
+	tests := []struct {
+		name   string
+		ban    time.Duration
+		refuse bool
+	}{
+		{"banned", time.Minute, true},
+		{"expired", -time.Second, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			served := make(chan struct{}, 1)
+			srv, addr := plainServer(t, func(context.Context, *ServerSession) {
+				served <- struct{}{}
+			})
+			srv.Ban("127.0.0.1", tt.ban)
+			conn := knock(t, addr)
+
+			if tt.refuse {
+				if !closedByServer(conn) {
+					t.Fatal("banned peer kept its connection")
+				}
+				select {
+				case <-served:
+					t.Error("banned peer reached the handler")
+				default:
+				}
+				return
+			}
+			select {
+			case <-served:
+			case <-time.After(5 * time.Second):
+				t.Fatal("peer with an expired ban was not served")
+			}
+		})
+	}
+}
+
+func TestServerServeBeforeStart(t *testing.T) {
+	srv, err := NewServer("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Serve(ln); !errors.Is(err, ErrServerClosed) {
+		t.Fatalf("serve before start: %v, want ErrServerClosed", err)
+	}
+	if _, err := ln.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("listener left open: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package wire
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Security holds the transport encryption settings shared by clients and
+// servers. A nil Security, or one with Insecure set, means plaintext
+type Security struct {
+	Identity   *Identity
+	KnownPeers *KnownPeers
+	Insecure   bool
+}
+
+func (s *Security) enabled() bool {
+	return s != nil && !s.Insecure
+}
+
+func (s *Security) clientConfig(host string) *tls.Config {
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{s.Identity.Certificate},
+		// Peers use self-signed certificates, chain verification is
+		// replaced by fingerprint pinning below
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if err := checkIdentity(rawCerts); err != nil {
+				return err
+			}
+			return s.KnownPeers.Verify(host, Fingerprint(rawCerts[0]))
+		},
+	}
+}
+
+func (s *Security) serverConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{s.Identity.Certificate},
+		// Controllers present their own identity so the receiver can show
+		// and remember who is connected
+		ClientAuth: tls.RequireAnyClientCert,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return checkIdentity(rawCerts)
+		},
+	}
+}
+
+// checkIdentity makes sure a peer presented an identity certificate like
+// ours: self-signed with an ed25519 key. The handshake itself proves the
+// peer holds that key
+func checkIdentity(rawCerts [][]byte) error {
+	if len(rawCerts) == 0 {
+		return errors.New("peer presented no certificate")
+	}
+	cert, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return fmt.Errorf("malformed peer certificate: %w", err)
+	}
+	if _, ok := cert.PublicKey.(ed25519.PublicKey); !ok {
+		return fmt.Errorf("peer identity is a %T, not an ed25519 key", cert.PublicKey)
+	}
+	if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+		return fmt.Errorf("peer identity is not self-signed: %w", err)
+	}
+	return nil
+}
+
+// handshake runs the TLS handshake on conn if it is a TLS connection,
+// bounded by ctx and timeout, HandshakeTimeout when zero
+func handshake(ctx context.Context, conn net.Conn, timeout time.Duration) error {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+
+	if timeout <= 0 {
+		timeout = HandshakeTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return fmt.Errorf("tls handshake failed: %w", err)
+	}
+	return nil
+}
+
+// PeerFingerprint returns the certificate fingerprint of the remote side of
+// conn, or an empty string for plaintext connections. TLS is looked for
+// under WebSocket framing too
+func PeerFingerprint(conn net.Conn) string {
+	var tlsConn *tls.Conn
+	for conn != nil && tlsConn == nil {
+		tlsConn, _ = conn.(*tls.Conn)
+		conn = unwrap(conn)
+	}
+	if tlsConn == nil {
+		return ""
+	}
+	certs := tlsConn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return ""
+	}
+	return Fingerprint(certs[0].Raw)
+}
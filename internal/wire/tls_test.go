@@ -0,0 +1,165 @@
+package wire
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newSecurity returns TLS settings with a fresh identity and an empty
+// trust store
+func newSecurity(t *testing.T) *Security {
+	t.Helper()
+	id, err := LoadOrCreateIdentity(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	known, err := LoadKnownPeers(filepath.Join(t.TempDir(), KnownPeersFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Security{Identity: id, KnownPeers: known}
+}
+
+// startServer serves on a loopback port until the test ends, returning the
+// port. A nil onConn drains each connection
+func startServer(t *testing.T, sec *Security, onConn ConnHandler) string {
+	t.Helper()
+	srv, err := NewServer("127.0.0.1:0", sec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if onConn == nil {
+		onConn = func(_ context.Context, sess *ServerSession) {
+			io.Copy(io.Discard, sess.Conn())
+		}
+	}
+	if err := srv.Start(context.Background(), onConn); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	_, port, _ := net.SplitHostPort(srv.ln.Addr().String())
+	return port
+}
+
+func TestTLSPinning(t *testing.T) {
+	first, second := newSecurity(t), newSecurity(t)
+	firstPort := startServer(t, first, nil)
+	secondPort := startServer(t, second, nil)
+
+	client := newSecurity(t)
+	dial := func(port string) (*Client, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		d := Dialer{Security: client}
+		return d.Dial(ctx, "127.0.0.1", port)
+	}
+
+	// Passes on first use, then is pinned once pairing records it
+	for i := 0; i < 2; i++ {
+		c, err := dial(firstPort)
+		if err != nil {
+			t.Fatalf("dial %d: %v", i, err)
+		}
+		if got := c.PeerFingerprint(); got != first.Identity.Fingerprint {
+			t.Errorf("dial %d: fingerprint %s, want %s", i, got, first.Identity.Fingerprint)
+		}
+		c.Close()
+		if err := client.KnownPeers.Observe(c.PeerFingerprint(), "", "127.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Another key at the same address is refused
+	if c, err := dial(secondPort); !errors.Is(err, ErrFingerprintMismatch) {
+		if c != nil {
+			c.Close()
+		}
+		t.Fatalf("dial with changed key: got %v, want ErrFingerprintMismatch", err)
+	}
+
+	// Until the old key is revoked
+	if err := client.KnownPeers.Revoke(first.Identity.Fingerprint); err != nil {
+		t.Fatal(err)
+	}
+	c, err := dial(secondPort)
+	if err != nil {
+		t.Fatalf("dial after revoke: %v", err)
+	}
+	c.Close()
+}
+
+func TestTLSPlaintextRefused(t *testing.T) {
+	port := startServer(t, newSecurity(t), nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	d := Dialer{Security: &Security{Insecure: true}}
+	c, err := d.Dial(ctx, "127.0.0.1", port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// The server expects a TLS hello and drops the connection
+	c.Send(ctx, MsgPing, nil)
+	if _, err := c.Read(ctx); err == nil {
+		t.Error("plaintext peer was served by a TLS server")
+	}
+}
+
+func TestCheckIdentity(t *testing.T) {
+	selfSigned := func(pub, priv any) []byte {
+		t.Helper()
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "test"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, pub, priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der
+	}
+
+	edPub, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	_, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		certs   [][]byte
+		wantErr bool
+	}{
+		{"ed25519 self-signed", [][]byte{selfSigned(edPub, edPriv)}, false},
+		{"no certificate", nil, true},
+		{"garbage", [][]byte{[]byte("not a certificate")}, true},
+		{"ecdsa key", [][]byte{selfSigned(&ecKey.PublicKey, ecKey)}, true},
+		{"signed by another key", [][]byte{selfSigned(edPub, otherPriv)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkIdentity(tt.certs)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocketPath is where servers accept WebSocket connections
+const WebSocketPath = "/iocopy"
+
+const (
+	schemeWS  = "ws"
+	schemeWSS = "wss"
+)
+
+// wsCloseTimeout bounds sending the close frame
+const wsCloseTimeout = time.Second
+
+// IsWebSocketAddr reports whether addr is a ws:// or wss:// peer address
+// rather than a host
+func IsWebSocketAddr(addr string) bool {
+	return strings.HasPrefix(addr, schemeWS+"://") || strings.HasPrefix(addr, schemeWSS+"://")
+}
+
+// parseWebSocketAddr completes a ws:// or wss:// address with the default
+// port and path
+func parseWebSocketAddr(addr, port string) (*url.URL, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer address %q: %w", addr, err)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid peer address %q: no host", addr)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = WebSocketPath
+	}
+	return u, nil
+}
+
+// dialWebSocket opens a WebSocket stream to u, honouring HTTP proxy
+// settings from the environment. For wss the TLS handshake is pinned like a
+// direct connection, there is no second TLS layer inside
+func (d *Dialer) dialWebSocket(ctx context.Context, u *url.URL, dial func(ctx context.Context, network, addr string) (net.Conn, error)) (net.Conn, error) {
+	dialer := websocket.Dialer{
+		NetDialContext: dial,
+		Proxy:          http.ProxyFromEnvironment,
+	}
+	if u.Scheme == schemeWSS {
+		if !d.Security.enabled() {
+			return nil, errors.New("wss:// needs TLS, use ws:// when running insecure")
+		}
+		dialer.TLSClientConfig = d.Security.clientConfig(u.Hostname())
+	}
+
+	ws, resp, err := dialer.DialContext(ctx, u.String(), nil)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("websocket upgrade at %s refused: %s", u, resp.Status)
+		}
+		return nil, err
+	}
+	return &wsConn{ws: ws}, nil
+}
+
+// wsConn carries a byte stream over WebSocket binary messages. Like TLS, a
+// timed out read or write breaks the connection
+type wsConn struct {
+	ws *websocket.Conn
+	r  io.Reader
+}
+
+func (c *wsConn) Read(p []byte) (int, error) {
+	for {
+		if c.r == nil {
+			typ, r, err := c.ws.NextReader()
+			if err != nil {
+				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					return 0, io.EOF
+				}
+				return 0, err
+			}
+			if typ != websocket.BinaryMessage {
+				return 0, fmt.Errorf("unexpected websocket message type %d", typ)
+			}
+			c.r = r
+		}
+
+		n, err := c.r.Read(p)
+		if err == io.EOF {
+			// End of this message, the stream continues in the next one
+			c.r = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (c *wsConn) Write(p []byte) (int, error) {
+	if err := c.ws.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *wsConn) Close() error {
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	c.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsCloseTimeout))
+	return c.ws.Close()
+}
+
+func (c *wsConn) LocalAddr() net.Addr                { return c.ws.LocalAddr() }
+func (c *wsConn) RemoteAddr() net.Addr               { return c.ws.RemoteAddr() }
+func (c *wsConn) SetReadDeadline(t time.Time) error  { return c.ws.SetReadDeadline(t) }
+func (c *wsConn) SetWriteDeadline(t time.Time) error { return c.ws.SetWriteDeadline(t) }
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	if err := c.ws.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.ws.SetWriteDeadline(t)
+}
+
+// NetConn returns the connection the WebSocket runs on
+func (c *wsConn) NetConn() net.Conn {
+	return c.ws.NetConn()
+}
+
+// wsUpgrader accepts WebSocket clients. Browsers send an Origin, peers are
+// authenticated by TLS and pairing instead so any origin is allowed
+var wsUpgrader = websocket.Upgrader{
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// sniff looks at the first bytes of conn. A WebSocket upgrade request is
+// answered and the WebSocket stream returned, anything else is returned
+// as is, bytes read included
+func sniff(conn net.Conn) (net.Conn, error) {
+	r := bufio.NewReader(conn)
+	head, err := r.Peek(4)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(head, []byte("GET ")) {
+		return &peekedConn{Conn: conn, r: r}, nil
+	}
+
+	req, err := http.ReadRequest(r)
+	if err != nil {
+		return nil, fmt.Errorf("malformed http request: %w", err)
+	}
+	w := &hijackWriter{conn: conn, brw: bufio.NewReadWriter(r, bufio.NewWriter(conn)), header: make(http.Header)}
+	if req.URL.Path != WebSocketPath {
+		http.NotFound(w, req)
+		return nil, fmt.Errorf("http request for %s", req.URL.Path)
+	}
+	ws, err := wsUpgrader.Upgrade(w, req, nil)
+	if err != nil {
+		return nil, fmt.Errorf("websocket upgrade failed: %w", err)
+	}
+	return &wsConn{ws: ws}, nil
+}
+
+// peekedConn replays the bytes sniff looked at before reading on
+type peekedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *peekedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// NetConn returns the sniffed connection
+func (c *peekedConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// hijackWriter is the minimal http.ResponseWriter the upgrader needs on a
+// connection that did not come through net/http
+type hijackWriter struct {
+	conn        net.Conn
+	brw         *bufio.ReadWriter
+	header      http.Header
+	wroteHeader bool
+}
+
+func (w *hijackWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *hijackWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	fmt.Fprintf(w.brw, "HTTP/1.1 %d %s\r\n", status, http.StatusText(status))
+	w.header.Set("Connection", "close")
+	w.header.Write(w.brw)
+	w.brw.WriteString("\r\n")
+}
+
+func (w *hijackWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	n, err := w.brw.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, w.brw.Flush()
+}
+
+func (w *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.conn, w.brw, nil
+}
+
+// unwrap returns the connection under conn for the wrappers used on
+// accepted and dialed streams, nil when conn wraps nothing
+func unwrap(conn net.Conn) net.Conn {
+	if u, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		return u.NetConn()
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package wire
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// echo sends every message it reads straight back
+func echo(ctx context.Context, sess *ServerSession) {
+	c := NewConn(sess.Conn())
+	for {
+		msg, err := c.Read(ctx)
+		if err != nil {
+			return
+		}
+		if err := c.Write(ctx, msg); err != nil {
+			return
+		}
+	}
+}
+
+func TestParseWebSocketAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		want    string
+		wantErr bool
+	}{
+		{"ws://desk", "ws://desk:8080/iocopy", false},
+		{"wss://desk:443", "wss://desk:443/iocopy", false},
+		{"ws://desk/", "ws://desk:8080/iocopy", false},
+		{"wss://proxy.lan/peers/desk", "wss://proxy.lan:8080/peers/desk", false},
+		{"ws://[::1]", "ws://[::1]:8080/iocopy", false},
+		{"ws://", "", true},
+		{"ws://desk:port:x", "", true},
+	}
+	for _, tt := range tests {
+		u, err := parseWebSocketAddr(tt.addr, "8080")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: unexpected error %v", tt.addr, err)
+			continue
+		}
+		if err == nil && u.String() != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.addr, u, tt.want)
+		}
+	}
+}
+
+func TestIsWebSocketAddr(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"ws://desk":   true,
+		"wss://desk":  true,
+		"desk":        false,
+		"192.168.1.2": false,
+		"wsdesk":      false,
+		"http://desk": false,
+	} {
+		if got := IsWebSocketAddr(addr); got != want {
+			t.Errorf("IsWebSocketAddr(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestWebSocketTransport(t *testing.T) {
+	secure, insecure := newSecurity(t), &Security{Insecure: true}
+	securePort := startServer(t, secure, echo)
+	insecurePort := startServer(t, insecure, echo)
+
+	tests := []struct {
+		name    string
+		client  *Security
+		host    string
+		port    string
+		pinned  bool
+		wantErr bool
+	}{
+		{"raw tcp", newSecurity(t), "127.0.0.1", securePort, true, false},
+		{"ws with tls inside", newSecurity(t), "ws://127.0.0.1", securePort, true, false},
+		{"wss", newSecurity(t), "wss://127.0.0.1", securePort, true, false},
+		{"ws insecure", insecure, "ws://127.0.0.1", insecurePort, false, false},
+		{"wss insecure", insecure, "wss://127.0.0.1", insecurePort, false, true},
+		{"ws with explicit port", newSecurity(t), "ws://127.0.0.1:" + securePort, "1", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			d := Dialer{Security: tt.client}
+			c, err := d.Dial(ctx, tt.host, tt.port)
+			if tt.wantErr {
+				if err == nil {
+					c.Close()
+					t.Fatal("dial succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			if got := c.PeerFingerprint(); tt.pinned && got != secure.Identity.Fingerprint || !tt.pinned && got != "" {
+				t.Errorf("peer fingerprint %q", got)
+			}
+			// Large enough to span several WebSocket messages and reads
+			want := &Message{Type: "custom", Data: fmt.Sprintf("%0*d", 100<<10, 7)}
+			if err := c.Write(ctx, want); err != nil {
+				t.Fatal(err)
+			}
+			got, err := c.Read(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Type != want.Type || got.Data != want.Data {
+				t.Errorf("echo came back as %s with %d bytes", got.Type, len(got.Data))
+			}
+		})
+	}
+}
+
+func TestWebSocketWrongPath(t *testing.T) {
+	port := startServer(t, nil, echo)
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", port), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprint(conn, "GET /elsewhere HTTP/1.1\r\nHost: desk\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status %s, want 404", resp.Status)
+	}
+}
@@ -7,34 +7,114 @@ import (
 	"net"
 )
 
+// Send writes msg as a JSON frame
 func Send(conn net.Conn, msg any) error {
 	data, err := json.Marshal(msg)
 	if err != nil {
 		return err
 	}
+	return writeFrame(conn, data, DefaultMaxFrameSize)
+}
 
-	lenBuf := make([]byte, 4)
-	binary.BigEndian.PutUint32(lenBuf, uint32(len(data)))
+// Receive reads a JSON frame into out
+func Receive(conn net.Conn, out any) error {
+	data, err := readFrame(conn, DefaultMaxFrameSize)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return &MalformedPayloadError{Err: err}
+	}
+	return nil
+}
+
+// SendMessage writes msg encoded with codec
+func SendMessage(conn net.Conn, codec Codec, msg *Message) error {
+	return sendMessage(conn, codec, msg, DefaultLimits(), nil)
+}
 
-	if _, err = conn.Write(lenBuf); err != nil {
+// ReceiveMessage reads a frame and decodes it with codec, enforcing the
+// default limits
+func ReceiveMessage(conn net.Conn, codec Codec) (*Message, error) {
+	return receiveMessage(conn, codec, DefaultLimits(), nil)
+}
+
+// sendMessage encodes msg with codec and writes it as one frame, compressed
+// with comp when it is large enough. comp may be nil
+func sendMessage(conn net.Conn, codec Codec, msg *Message, limits Limits, comp *compression) error {
+	data, err := codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if comp == nil || !comp.wants(data) {
+		return writeFrame(conn, data, limits.MaxFrameSize)
+	}
+
+	frame, err := comp.compress(data, limits.MaxFrameSize)
+	if err != nil {
+		return err
+	}
+	if err := writeFrame(conn, frame, limits.MaxFrameSize); err != nil {
+		comp.lost()
 		return err
 	}
-	_, err = conn.Write(data)
+	return nil
+}
+
+// receiveMessage reads a frame and decodes it with codec, inflating it with
+// comp first if it is compressed. comp may be nil
+func receiveMessage(conn net.Conn, codec Codec, limits Limits, comp *compression) (*Message, error) {
+	data, err := readFrame(conn, limits.MaxFrameSize)
+	if err != nil {
+		return nil, err
+	}
+	if comp != nil && len(data) > 0 && data[0] == frameTagDeflate {
+		if data, err = comp.decompress(data, limits.MaxFrameSize); err != nil {
+			return nil, err
+		}
+	}
+
+	var msg Message
+	if err := codec.Unmarshal(data, &msg); err != nil {
+		return nil, &MalformedPayloadError{Err: err}
+	}
+	if err := limits.check(msg.Type, len(data)); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+func writeFrame(conn net.Conn, data []byte, maxSize uint32) error {
+	if uint64(len(data)) > uint64(maxSize) {
+		return &FrameTooLargeError{Size: uint32(min(len(data), int(^uint32(0)))), Limit: maxSize}
+	}
+
+	// Length prefix and payload go out in one write so a frame never spans
+	// two TLS records unnecessarily
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+
+	_, err := conn.Write(frame)
 	return err
 }
 
-func Receive(conn net.Conn, out any) error {
+func readFrame(conn net.Conn, maxSize uint32) ([]byte, error) {
 	lenBuf := make([]byte, 4)
 	if _, err := io.ReadFull(conn, lenBuf); err != nil {
-		return err
+		return nil, err
 	}
 
+	// The length comes straight from the network, check it before
+	// allocating anything
 	n := binary.BigEndian.Uint32(lenBuf)
+	if n > maxSize {
+		return nil, &FrameTooLargeError{Size: n, Limit: maxSize}
+	}
 	data := make([]byte, n)
 
 	if _, err := io.ReadFull(conn, data); err != nil {
-		return err
+		return nil, err
 	}
-
-	return json.Unmarshal(data, out)
+	return data, nil
 }
@@ -2,17 +2,96 @@ package main
 
 import (
 	"copy/internal/app"
+	"copy/internal/control"
+	"copy/internal/wire"
 	"flag"
 	"log"
+	"os"
+	"time"
 )
 
 const defaultPort = "8080"
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		if err := runReplay(os.Args[2:]); err != nil {
+			log.Fatalf("replay failed, %s", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "ctl" {
+		if err := runCtl(os.Args[2:]); err != nil {
+			log.Fatalf("ctl failed, %s", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "relay" {
+		if err := runRelay(os.Args[2:]); err != nil {
+			log.Fatalf("relay failed, %s", err)
+		}
+		return
+	}
+
 	port := flag.String("port", defaultPort, "Port to listen on and connect to")
+	insecure := flag.Bool("insecure", false, "Disable TLS and talk plaintext (peers must use the same setting)")
+	codec := flag.String("codec", wire.CodecBinary, "Preferred input event codec: binary, or json for debugging")
+	compressThreshold := flag.Int("compress-threshold", wire.DefaultCompressThreshold, "Compress messages of at least this many bytes when the peer supports it (0 disables)")
+	dialTimeout := flag.Duration("dial-timeout", wire.DefaultDialTimeout, "Give up connecting to a peer after this long")
+	handshakeTimeout := flag.Duration("handshake-timeout", wire.HandshakeTimeout, "Give up on a peer that has not finished TLS, hello and pairing after this long")
+	idleTimeout := flag.Duration("idle-timeout", 0, "Drop a peer without heartbeats after this long without traffic (0 disables)")
+	heartbeat := flag.Duration("heartbeat", wire.DefaultHeartbeatInterval, "Interval between liveness pings")
+	peerTimeout := flag.Duration("peer-timeout", wire.DefaultHeartbeatTimeout, "Drop a peer after this long without traffic")
+	reconnect := flag.Duration("reconnect-timeout", time.Minute, "How long to keep redialing a lost peer (0 disables reconnect)")
+	record := flag.String("record", "", "Directory to write a capture of every session to, for bug reports and replay")
+	switchEdge := flag.String("switch-edge", "", "Edge of this screen the receiver sits behind: left, right, top or bottom. Input goes to the receiver when the pointer crosses it (default all input)")
+	deadCorner := flag.Int("dead-corner", control.DefaultDeadCorner, "Pixels at each end of a screen edge that do not switch screens")
+	pointerMapping := flag.String("pointer-mapping", control.MapStretch, "How the pointer lands on a receiver screen of another size: stretch, clamp (1:1 pixels) or letterbox (keep aspect ratio)")
+	relative := flag.Bool("relative", false, "Move the receiver's pointer by deltas instead of to positions, for games and apps that lock the pointer (the relative hotkey toggles)")
+	hotkeys := flag.String("hotkeys", "", "Comma separated action=chord bindings over the defaults, e.g. \"paste=ctrl+alt+v,peer:2=ctrl+alt+2\". Actions: release, relative, lock, local, peer:N, ctrl-alt-del, paste. An empty chord unbinds")
+	floor := flag.String("floor", control.FloorQueue, "When another controller already has input: queue or reject newcomers")
+	priorityPeer := flag.String("priority-peer", "", "Fingerprint or IP of a controller that may always take over input")
+	relayAddr := flag.String("relay", "", "host:port of an iocopy relay to register at and reach peers on other networks through")
+	relayID := flag.String("relay-id", "", "Peer ID to register under at the relay (default hostname)")
+	reverseTo := flag.String("reverse-to", "", "host[:port] of a controller to connect out to, for receivers that cannot accept connections (default port 8081)")
+	reverseListen := flag.String("reverse-listen", "", "Address to wait on for receivers connecting out to us, e.g. :8081")
+	reversePeer := flag.String("reverse-peer", "", "Fingerprint of the receiver to accept on -reverse-listen (default any peer we already trust)")
+	ctlSocket := flag.String("ctl-socket", defaultSocket(), "Unix socket to serve the local control API on, for iocopy ctl (empty disables)")
+	udpMotion := flag.Bool("udp-motion", true, "Send pointer motion and scrolling over UDP when the peer allows it")
 	flag.Parse()
 
-	app, err := app.NewApp(*port)
+	app, err := app.NewApp(app.Config{
+		Port:     *port,
+		Insecure: *insecure,
+		Codec:    *codec,
+
+		CompressThreshold: *compressThreshold,
+
+		DialTimeout:      *dialTimeout,
+		HandshakeTimeout: *handshakeTimeout,
+		IdleTimeout:      *idleTimeout,
+
+		HeartbeatInterval: *heartbeat,
+		PeerTimeout:       *peerTimeout,
+		ReconnectTimeout:  *reconnect,
+		UDPMotion:         *udpMotion,
+		RecordDir:         *record,
+		SwitchEdge:        *switchEdge,
+		DeadCorner:        *deadCorner,
+		PointerMapping:    *pointerMapping,
+		RelativeMotion:    *relative,
+		Hotkeys:           *hotkeys,
+		FloorPolicy:       *floor,
+		PriorityPeer:      *priorityPeer,
+
+		RelayAddr: *relayAddr,
+		RelayID:   *relayID,
+
+		ReverseTo:     *reverseTo,
+		ReverseListen: *reverseListen,
+		ReversePeer:   *reversePeer,
+
+		ControlSocket: *ctlSocket,
+	})
 	if err != nil {
 		log.Fatalf("failed to create new app, %s", err)
 	}
@@ -23,6 +23,8 @@ const (
 	INPUT_KEYBOARD         = 1
 	INPUT_MOUSE            = 0
 	KEYEVENTF_KEYUP        = 0x0002
+	KEYEVENTF_UNICODE      = 0x0004
+	MOUSEEVENTF_MOVE       = 0x0001
 	MOUSEEVENTF_LEFTDOWN   = 0x0002
 	MOUSEEVENTF_LEFTUP     = 0x0004
 	MOUSEEVENTF_RIGHTDOWN  = 0x0008
@@ -32,4 +34,9 @@ const (
 	MOUSEEVENTF_WHEEL      = 0x0800
 	MOUSEEVENTF_ABSOLUTE   = 0x8000
 	VK_MENU                = 0x12 // Alt key
+
+	SM_CXSCREEN = 0
+	SM_CYSCREEN = 1
+
+	CF_UNICODETEXT = 13
 )
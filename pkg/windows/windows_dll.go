@@ -30,10 +30,17 @@ var (
 	ProcPostQuitMessage            *windows.LazyProc
 	ProcSetForegroundWindow        *windows.LazyProc
 	ProcSetLayeredWindowAttributes *windows.LazyProc
+	ProcOpenClipboard              *windows.LazyProc
+	ProcCloseClipboard             *windows.LazyProc
+	ProcGetClipboardData           *windows.LazyProc
 	Gdi32                          *windows.LazyDLL
 	ProcCreateSolidBrush           *windows.LazyProc
 	Kernel32                       *windows.LazyDLL
 	ProcGetModuleHandle            *windows.LazyProc
+	ProcGlobalLock                 *windows.LazyProc
+	ProcGlobalUnlock               *windows.LazyProc
+	Sas                            *windows.LazyDLL
+	ProcSendSAS                    *windows.LazyProc
 )
 
 func InitWindowsDLLs() error {
@@ -65,12 +72,20 @@ func InitWindowsDLLs() error {
 	ProcPostQuitMessage = User32.NewProc("PostQuitMessage")
 	ProcSetForegroundWindow = User32.NewProc("SetForegroundWindow")
 	ProcSetLayeredWindowAttributes = User32.NewProc("SetLayeredWindowAttributes")
+	ProcOpenClipboard = User32.NewProc("OpenClipboard")
+	ProcCloseClipboard = User32.NewProc("CloseClipboard")
+	ProcGetClipboardData = User32.NewProc("GetClipboardData")
 
 	Gdi32 = windows.NewLazyDLL("gdi32.dll")
 	ProcCreateSolidBrush = Gdi32.NewProc("CreateSolidBrush")
 
 	Kernel32 = windows.NewLazyDLL("kernel32.dll")
 	ProcGetModuleHandle = Kernel32.NewProc("GetModuleHandleW")
+	ProcGlobalLock = Kernel32.NewProc("GlobalLock")
+	ProcGlobalUnlock = Kernel32.NewProc("GlobalUnlock")
+
+	Sas = windows.NewLazyDLL("sas.dll")
+	ProcSendSAS = Sas.NewProc("SendSAS")
 
 	return nil
 }
@@ -41,12 +41,34 @@ var (
 	ProcMouseEvent interface {
 		Call(...uintptr) (uintptr, uintptr, error)
 	}
+	ProcGetSystemMetrics interface {
+		Call(...uintptr) (uintptr, uintptr, error)
+	}
 	ProcGetModuleHandle interface {
 		Call(...uintptr) (uintptr, uintptr, error)
 	}
 	ProcGetLastError interface {
 		Call(...uintptr) (uintptr, uintptr, error)
 	}
+	ProcOpenClipboard interface {
+		Call(...uintptr) (uintptr, uintptr, error)
+	}
+	ProcCloseClipboard interface {
+		Call(...uintptr) (uintptr, uintptr, error)
+	}
+	ProcGetClipboardData interface {
+		Call(...uintptr) (uintptr, uintptr, error)
+	}
+	ProcGlobalLock interface {
+		Call(...uintptr) (uintptr, uintptr, error)
+	}
+	ProcGlobalUnlock interface {
+		Call(...uintptr) (uintptr, uintptr, error)
+	}
+	ProcSendSAS interface {
+		Find() error
+		Call(...uintptr) (uintptr, uintptr, error)
+	}
 	Kernel32 interface {
 		NewProc(string) *windows.LazyProc
 	}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"copy/internal/relay"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+)
+
+// runRelay implements `iocopy relay [flags]`
+func runRelay(args []string) error {
+	fs := flag.NewFlagSet("relay", flag.ExitOnError)
+	listen := fs.String("listen", net.JoinHostPort("", relay.DefaultPort), "Address to accept peers on, 127.0.0.1:port for local testing")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s relay [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	server, err := relay.NewServer(*listen)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return server.Serve(ctx)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"copy/internal/replay"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runReplay implements `iocopy replay [flags] capture`
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	speed := fs.Float64("speed", 1, "Playback speed relative to the recording, 0 replays without delays")
+	dryRun := fs.Bool("dry-run", false, "Print the events instead of performing them")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s replay [flags] capture\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	return replay.Run(fs.Arg(0), replay.Options{
+		Speed:  *speed,
+		DryRun: *dryRun,
+		Out:    os.Stdout,
+	})
+}